@@ -2,171 +2,100 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
-	"sort"
-)
+	"time"
 
-type Asset string
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/backtest"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/internal/synthetic"
+)
 
 const (
-	RUB  Asset = "RUB"
-	GOLD Asset = "GOLD"
-	USD  Asset = "USD"
-	OZON Asset = "OZON"
-	SBER Asset = "SBER"
+	GOLD dto.Isin = "GOLD"
+	USD  dto.Isin = "USD"
+	OZON dto.Isin = "OZON"
+	SBER dto.Isin = "SBER"
 )
 
-type Portfolio struct {
-	Actives map[Asset]float32
-}
-
-type MarketState struct {
-	Portfolio Portfolio
-	Prices    map[Asset]float32
-	History   map[Asset][]float32
-}
-
-func (m *MarketState) Act(from Asset, to Asset) bool {
-	// Проверяем, есть ли актив в портфеле
-	amount, exists := m.Portfolio.Actives[from]
-	if !exists || amount <= 0 {
-		// fmt.Printf("Не удалось перевести %s -> %s: недостаточно средств\n", from, to)
-		return false // Нечего переводить
-	}
-	// Проверяем наличие цены актива
-	fromPrice, fromExists := m.Prices[from]
-	toPrice, toExists := m.Prices[to]
-	if !fromExists || !toExists || toPrice == 0 {
-		// fmt.Printf("Не удалось перевести %s -> %s: отсутствуют цены\n", from, to)
-		return false // Невозможно рассчитать перевод
-	}
-
-	// Рассчитываем количество нового актива
-	valueInRUB := amount * fromPrice  // Стоимость в RUB
-	newAmount := valueInRUB / toPrice // Количество нового актива
-
-	// Логируем сделку
-	fmt.Printf("Перевод: %s -> %s | %.4f %s (%.2f RUB) -> %.4f %s\n",
-		from, to, amount, from, valueInRUB, newAmount, to)
-
-	// Обновляем портфель
-	delete(m.Portfolio.Actives, from)    // Полностью убираем старый актив
-	m.Portfolio.Actives[to] += newAmount // Добавляем новый актив
-	return true
-}
-
-type Market struct {
-	State MarketState
-}
-
-func NewMarket(initialPortfolio map[Asset]float32, initialPrices map[Asset]float32) *Market {
-	portfolio := Portfolio{
-		Actives: make(map[Asset]float32),
-	}
-	for asset, price := range initialPortfolio {
-		portfolio.Actives[asset] = price
-	}
-	state := MarketState{
-		Prices:  make(map[Asset]float32),
-		History: make(map[Asset][]float32),
-	}
-	for asset, price := range initialPrices {
-		state.Portfolio = portfolio
-		state.Prices[asset] = price
-		state.History[asset] = []float32{price}
+// Стресс-тест попарной стратегии на синтетических рынках, которых не было в истории
+func main() {
+	base := synthetic.Options{
+		Start:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Days:        756,
+		StepsPerDay: 8,
+		Seed:        1,
+		Assets: []synthetic.Asset{
+			{Isin: GOLD, Price: 8357, Drift: 0.08, Volatility: 0.15, Volume: 50000},
+			{Isin: USD, Price: 89.1, Drift: 0.05, Volatility: 0.12, Volume: 1000000},
+			{Isin: OZON, Price: 4004, Drift: 0.15, Volatility: 0.5, Volume: 20000},
+			{Isin: SBER, Price: 313, Drift: 0.12, Volatility: 0.3, Volume: 500000},
+		},
+		Correlation: [][]float64{
+			{1, 0.3, -0.1, -0.1},
+			{0.3, 1, -0.2, -0.3},
+			{-0.1, -0.2, 1, 0.5},
+			{-0.1, -0.3, 0.5, 1},
+		},
 	}
 
-	return &Market{State: state}
-}
+	jumps := base
+	jumps.Jumps = synthetic.Jumps{Intensity: 3, Mean: -0.04, StdDev: 0.06}
 
-func getRandomChange(min, max float32) float32 {
-	return min + rand.Float32()*(max-min)
-}
+	garch := base
+	garch.GARCH = synthetic.GARCH{Alpha: 0.1, Beta: 0.85}
 
-func (m *Market) SimulateNextStep() {
-	changes := map[Asset][2]float32{
-		RUB:  {0, 0},
-		GOLD: {-500, 500},
-		USD:  {-5, 5},
-		OZON: {-800, 800},
-		SBER: {-100, 100},
+	crisis := base
+	crisis.Regimes = []synthetic.Regime{
+		{Name: "calm", Drift: 0, VolatilityScale: 1},
+		{Name: "crisis", Drift: -0.6, VolatilityScale: 2.5},
 	}
-
-	beforeAfter := map[Asset][3]float32{}
-
-	// меняем цены и вычисляем изменения
-	for asset, changeRange := range changes {
-		before := m.State.Prices[asset]
-		after := before + getRandomChange(changeRange[0], changeRange[1])
-		m.State.Prices[asset] = after
-		// fmt.Printf("%s: %.2f -> %.2f\n", asset, before, after)
-		change := (after - before) / before * 100
-		beforeAfter[asset] = [3]float32{before, after, change}
-		m.State.History[asset] = append(m.State.History[asset], after)
+	crisis.Transitions = [][]float64{
+		{0.99, 0.01},
+		{0.05, 0.95},
 	}
-	fmt.Println("--------------")
-	fmt.Println(beforeAfter)
 
-	// Структура для хранения результатов
-	type DiffResult struct {
-		Asset1         Asset
-		Asset2         Asset
-		DiffPercentage float32
+	scenarios := []struct {
+		name    string
+		options synthetic.Options
+	}{
+		{"GBM", base},
+		{"Jumps", jumps},
+		{"GARCH", garch},
+		{"Crisis regimes", crisis},
 	}
-
-	var diffs []DiffResult
-
-	for asset, change := range beforeAfter {
-		for asset2, change2 := range beforeAfter {
-			diff := (change[2] - change2[2])
-			if diff == 0 {
-				continue
-			}
-			diffs = append(diffs, DiffResult{Asset1: asset, Asset2: asset2, DiffPercentage: diff})
-			fmt.Printf("%s -> %s: %.2f, %.2f -> %.2f%%\n",
-				asset, asset2, change[2], change2[2], diff)
+	for _, s := range scenarios {
+		market, err := synthetic.Generate(s.options)
+		if err != nil {
+			fmt.Println(s.name, err)
+			continue
 		}
-	}
-
-	// Сортируем по убыванию разницы
-	sort.Slice(diffs, func(i, j int) bool {
-		return diffs[i].DiffPercentage > diffs[j].DiffPercentage
-	})
-
-	// Выводим `X` наибольших значений
-	fmt.Println("Изменения:")
-	isAct := false
-	for i := 0; i < len(diffs); i++ {
-
-		fmt.Printf("%s -> %s: %.2f%%\n", diffs[i].Asset1, diffs[i].Asset2, diffs[i].DiffPercentage)
-		// переводим актив из дорогого в дешевый?
-		if !isAct {
-			isAct = m.State.Act(diffs[i].Asset1, diffs[i].Asset2)
+		bars := backtest.GroupCandlesByTime(market.Candles)
+		broker := backtest.NewSimBroker(1000, backtest.Execution{Commission: backtest.TinkoffTariffs["investor"]})
+		result := backtest.NewEngine(broker, backtest.NewPairwiseStrategy(backtest.PairwiseOptions{Exclude: []dto.Isin{GOLD}})).Run(bars)
+
+		rub := dto.Numeraire{Name: "RUB"}
+		fmt.Printf("%s:\n", s.name)
+		printMetrics(backtest.CalculateMetrics("Strategy", result.Equity, result.Fills, rub))
+		for _, m := range []struct {
+			name   string
+			method backtest.WeightMethod
+		}{
+			{"Equal", backtest.EqualWeights},
+			{"Risk parity", analytics.RiskParityWeights},
+			{"Min var", analytics.MinVarianceWeights},
+		} {
+			broker := backtest.NewSimBroker(1000, backtest.Execution{Commission: backtest.TinkoffTariffs["investor"]})
+			strategy := backtest.NewRebalanceStrategy(backtest.RebalanceOptions{Method: m.method, Period: "quarter", Threshold: 0.05})
+			rebalanced := backtest.NewEngine(broker, strategy).Run(bars)
+			printMetrics(backtest.CalculateMetrics(m.name, rebalanced.Equity, rebalanced.Fills, rub))
+		}
+		for _, a := range s.options.Assets {
+			printMetrics(backtest.CalculateMetrics("B&H "+string(a.Isin), backtest.BuyAndHold(bars, a.Isin, 1000), nil, rub))
 		}
-	}
-
-	fmt.Println("Портфель:")
-	for asset, value := range m.State.Portfolio.Actives {
-		fmt.Printf("%s: %.2f (%.2f RUB)\n", asset, value, value*m.State.Prices[asset])
 	}
 }
 
-func main() {
-	market := NewMarket(
-		map[Asset]float32{
-			RUB: 1000,
-		},
-		map[Asset]float32{
-			RUB:  1,
-			GOLD: 8357,
-			USD:  89.1,
-			OZON: 4004,
-			SBER: 313,
-		})
-
-	for i := 0; i < 10; i++ {
-		market.SimulateNextStep()
-	}
-
-	fmt.Println(market.State)
+func printMetrics(m backtest.Metrics) {
+	fmt.Printf("\t%-10s return %7.1f%%, CAGR %6.1f%%, Sharpe %5.2f, max drawdown %5.1f%%, trades %d\n",
+		m.Name, m.TotalReturn*100, m.CAGR*100, m.Sharpe, m.MaxDrawdown*100, m.Trades)
 }
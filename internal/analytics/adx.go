@@ -0,0 +1,56 @@
+package analytics
+
+import (
+	"math"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// CalculateADX calculates the Average Directional Index with Wilder's smoothing.
+// Период меньше единицы считается равным единице.
+func CalculateADX(candles []dto.Candle, period int) dto.Series {
+	if period < 1 {
+		period = 1
+	}
+	adx := make([]float64, len(candles))
+	var trSum, plusSum, minusSum, dxSum float64
+	for i := 1; i < len(candles); i++ {
+		c, prev := candles[i], candles[i-1]
+		up := c.High - prev.High
+		down := prev.Low - c.Low
+		var plusDM, minusDM float64
+		if up > down && up > 0 {
+			plusDM = up
+		}
+		if down > up && down > 0 {
+			minusDM = down
+		}
+		tr := TrueRange(c, prev.Close)
+		if i <= period {
+			trSum += tr
+			plusSum += plusDM
+			minusSum += minusDM
+		} else {
+			trSum = trSum - trSum/float64(period) + tr
+			plusSum = plusSum - plusSum/float64(period) + plusDM
+			minusSum = minusSum - minusSum/float64(period) + minusDM
+		}
+		if i < period || trSum == 0 {
+			continue
+		}
+		plusDI := 100 * plusSum / trSum
+		minusDI := 100 * minusSum / trSum
+		var dx float64
+		if plusDI+minusDI > 0 {
+			dx = 100 * math.Abs(plusDI-minusDI) / (plusDI + minusDI)
+		}
+		// первое значение ADX - среднее DX за период
+		if i < 2*period {
+			dxSum += dx
+			adx[i] = dxSum / float64(i-period+1)
+			continue
+		}
+		adx[i] = (adx[i-1]*float64(period-1) + dx) / float64(period)
+	}
+	return dto.Series{Name: "ADX", Dates: candleDates(candles), Values: adx}
+}
@@ -0,0 +1,33 @@
+package analytics
+
+import (
+	"math"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// TrueRange calculates the true range of the candle relative to the previous close.
+func TrueRange(candle dto.Candle, prevClose float64) float64 {
+	return math.Max(candle.High-candle.Low,
+		math.Max(math.Abs(candle.High-prevClose), math.Abs(candle.Low-prevClose)))
+}
+
+// CalculateATR calculates the Average True Range with Wilder's smoothing.
+// Until `period` candles are accumulated the value is a simple average.
+func CalculateATR(candles []dto.Candle, period int) []float64 {
+	atr := make([]float64, len(candles))
+	var sum float64
+	for i, c := range candles {
+		tr := c.High - c.Low
+		if i > 0 {
+			tr = TrueRange(c, candles[i-1].Close)
+		}
+		if i < period {
+			sum += tr
+			atr[i] = sum / float64(i+1)
+			continue
+		}
+		atr[i] = (atr[i-1]*float64(period-1) + tr) / float64(period)
+	}
+	return atr
+}
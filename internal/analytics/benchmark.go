@@ -0,0 +1,87 @@
+package analytics
+
+import (
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg"
+)
+
+// Returns calculates simple close-to-close returns of candles.
+func Returns(candles []dto.Candle) []float64 {
+	if len(candles) < 2 {
+		return nil
+	}
+	returns := make([]float64, 0, len(candles)-1)
+	for i := 1; i < len(candles); i++ {
+		prev := candles[i-1].Close
+		if prev == 0 {
+			returns = append(returns, 0)
+			continue
+		}
+		returns = append(returns, (candles[i].Close-prev)/prev)
+	}
+	return returns
+}
+
+// AlignCandles keeps only candles of the same days in both slices.
+func AlignCandles(a, b []dto.Candle) ([]dto.Candle, []dto.Candle) {
+	day := func(t time.Time) time.Time {
+		return t.UTC().Truncate(24 * time.Hour)
+	}
+	byDay := make(map[time.Time]dto.Candle, len(b))
+	for _, c := range b {
+		byDay[day(c.Time)] = c
+	}
+	var alignedA, alignedB []dto.Candle
+	for _, c := range a {
+		if bc, exists := byDay[day(c.Time)]; exists {
+			alignedA = append(alignedA, c)
+			alignedB = append(alignedB, bc)
+		}
+	}
+	return alignedA, alignedB
+}
+
+// Beta calculates the beta of returns relative to benchmark returns.
+func Beta(returns, benchmarkReturns []float64) float64 {
+	variance := pkg.Covariance(benchmarkReturns, benchmarkReturns)
+	if variance == 0 {
+		return 0
+	}
+	return pkg.Covariance(returns, benchmarkReturns) / variance
+}
+
+// RelativeStrength calculates the growth of candles relative to the growth of benchmark.
+func RelativeStrength(candles, benchmark []dto.Candle) float64 {
+	if len(candles) == 0 || len(benchmark) == 0 || candles[0].Close <= 0 || benchmark[0].Close <= 0 {
+		return 0
+	}
+	growth := candles[len(candles)-1].Close / candles[0].Close
+	benchmarkGrowth := benchmark[len(benchmark)-1].Close / benchmark[0].Close
+	if benchmarkGrowth == 0 {
+		return 0
+	}
+	return growth / benchmarkGrowth
+}
+
+// CompareWithBenchmark compares candles and trend of an instrument with the benchmark candles.
+// `n` is the swing period used to detect the benchmark trend.
+func CompareWithBenchmark(candles []dto.Candle, trend dto.TrendType, benchmark *dto.Instrument, benchmarkCandles []dto.Candle, n int) dto.BenchmarkComparison {
+	benchmarkTrend, _ := GetTrends(FindSwings(benchmarkCandles, n))
+	comparison := dto.BenchmarkComparison{
+		Benchmark:      benchmark,
+		BenchmarkTrend: benchmarkTrend,
+		Contradicts: trend == dto.TrendUp && benchmarkTrend == dto.TrendDown ||
+			trend == dto.TrendDown && benchmarkTrend == dto.TrendUp,
+	}
+	a, b := AlignCandles(candles, benchmarkCandles)
+	if len(a) < 2 {
+		return comparison
+	}
+	returns, benchmarkReturns := Returns(a), Returns(b)
+	comparison.Beta = Beta(returns, benchmarkReturns)
+	comparison.Correlation = pkg.Correlation(returns, benchmarkReturns)
+	comparison.RelativeStrength = RelativeStrength(a, b)
+	return comparison
+}
@@ -0,0 +1,349 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg"
+)
+
+// Меньше общих свечей пару не проверяем: тест на коротком ряде ничего не значит
+const minPairObservations = 30
+
+// Коэффициенты MacKinnon (2010) для критических значений регрессии с константой:
+// b0 + b1/T + b2/T² + b3/T³. Ключ - число переменных (1 - ADF, 2 - Engle-Granger для пары),
+// строки - уровни 1%, 5% и 10%.
+var mackinnon = map[int][3][4]float64{
+	1: {
+		{-3.43035, -6.5393, -16.786, -79.433},
+		{-2.86154, -2.8903, -4.234, -40.040},
+		{-2.56677, -1.5384, -2.809, 0},
+	},
+	2: {
+		{-3.89644, -10.9519, -22.527, 0},
+		{-3.33613, -6.1101, -6.823, 0},
+		{-3.04445, -4.2412, -2.720, 0},
+	},
+}
+
+type PairOptions struct {
+	MaxLag       int     // максимум лагов разностей в ADF, выбираются по AIC
+	Significance float64 // 0.01, 0.05 или 0.1
+	MaxHalfLife  float64 // баров, 0 - без ограничения
+}
+
+// ADF runs the augmented Dickey-Fuller test with a constant:
+// Δy_t = c + γ·y_{t-1} + Σ φ_i·Δy_{t-i}. Статистика - t-отношение γ.
+func ADF(series []float64, maxLag int) dto.StationarityTest {
+	return adf(series, maxLag, true, 1)
+}
+
+// adf selects the number of lags by AIC on the common sample and refits on the full one.
+// `variables` выбирает таблицу критических значений.
+func adf(series []float64, maxLag int, constant bool, variables int) dto.StationarityTest {
+	n := len(series)
+	if maxLag < 0 {
+		maxLag = 0
+	}
+	// на каждый коэффициент хотя бы несколько наблюдений
+	for maxLag > 0 && n-1-maxLag < 3*(maxLag+2) {
+		maxLag--
+	}
+	diff := make([]float64, 0, n)
+	for t := 1; t < n; t++ {
+		diff = append(diff, series[t]-series[t-1])
+	}
+	// регрессия diff[t] по series[t] и diff[t-1..t-lags] для t от start
+	fit := func(lags, start int) (stat, rss float64, obs int, ok bool) {
+		var x [][]float64
+		var y []float64
+		for t := start; t < len(diff); t++ {
+			row := []float64{series[t]}
+			if constant {
+				row = append(row, 1)
+			}
+			for i := 1; i <= lags; i++ {
+				row = append(row, diff[t-i])
+			}
+			x = append(x, row)
+			y = append(y, diff[t])
+		}
+		coef, se, rss, ok := regress(x, y)
+		if !ok || se[0] <= 0 {
+			return 0, 0, len(y), false
+		}
+		return coef[0] / se[0], rss, len(y), true
+	}
+
+	lags := 0
+	if maxLag > 0 {
+		best := math.Inf(1)
+		for p := 0; p <= maxLag; p++ {
+			_, rss, obs, ok := fit(p, maxLag)
+			if !ok {
+				continue
+			}
+			k := p + 1
+			if constant {
+				k++
+			}
+			aic := float64(obs)*math.Log(math.Max(rss, 1e-300)/float64(obs)) + 2*float64(k)
+			if aic < best {
+				best, lags = aic, p
+			}
+		}
+	}
+	stat, _, obs, ok := fit(lags, lags)
+	test := dto.StationarityTest{Lags: lags, Observations: obs}
+	if ok {
+		test.Statistic = stat
+	}
+	t := float64(obs)
+	for i, b := range mackinnon[variables] {
+		test.Critical[i] = b[0] + b[1]/t + b[2]/(t*t) + b[3]/(t*t*t)
+	}
+	return test
+}
+
+// regress fits y = X·b by least squares through the Cholesky factor of X'X
+// and returns the coefficients with their standard errors.
+func regress(x [][]float64, y []float64) (coef, se []float64, rss float64, ok bool) {
+	if len(y) == 0 || len(x[0]) >= len(y) {
+		return nil, nil, 0, false
+	}
+	k := len(x[0])
+	xtx := make([][]float64, k)
+	for i := range xtx {
+		xtx[i] = make([]float64, k)
+	}
+	xty := make([]float64, k)
+	for t := range y {
+		for i := 0; i < k; i++ {
+			xty[i] += x[t][i] * y[t]
+			for j := 0; j <= i; j++ {
+				xtx[i][j] += x[t][i] * x[t][j]
+			}
+		}
+	}
+	for i := 0; i < k; i++ {
+		for j := 0; j < i; j++ {
+			xtx[j][i] = xtx[i][j]
+		}
+	}
+	l, err := pkg.Cholesky(xtx)
+	if err != nil {
+		return nil, nil, 0, false
+	}
+	// X'X·b = X'y: L·z = X'y, затем Lᵀ·b = z
+	z := solveLower(l, xty)
+	coef = make([]float64, k)
+	for i := k - 1; i >= 0; i-- {
+		sum := z[i]
+		for j := i + 1; j < k; j++ {
+			sum -= l[j][i] * coef[j]
+		}
+		coef[i] = sum / l[i][i]
+	}
+	for t := range y {
+		r := y[t]
+		for i := 0; i < k; i++ {
+			r -= x[t][i] * coef[i]
+		}
+		rss += r * r
+	}
+	variance := rss / float64(len(y)-k)
+	se = make([]float64, k)
+	for j := 0; j < k; j++ {
+		// диагональ (X'X)⁻¹ - сумма квадратов столбца L⁻¹
+		e := make([]float64, k)
+		e[j] = 1
+		var d float64
+		for _, v := range solveLower(l, e) {
+			d += v * v
+		}
+		se[j] = math.Sqrt(variance * d)
+	}
+	return coef, se, rss, true
+}
+
+// solveLower solves L·z = b for the lower triangular L.
+func solveLower(l [][]float64, b []float64) []float64 {
+	z := make([]float64, len(b))
+	for i := range b {
+		sum := b[i]
+		for j := 0; j < i; j++ {
+			sum -= l[i][j] * z[j]
+		}
+		z[i] = sum / l[i][i]
+	}
+	return z
+}
+
+// HedgeRatio estimates a = alpha + beta * b by least squares.
+func HedgeRatio(a, b []float64) (alpha, beta float64) {
+	if len(a) == 0 {
+		return 0, 0
+	}
+	if variance := pkg.Covariance(b, b); variance > 0 {
+		beta = pkg.Covariance(a, b) / variance
+	}
+	return pkg.Average(a) - beta*pkg.Average(b), beta
+}
+
+// Spread returns a - alpha - beta * b.
+func Spread(a, b []float64, alpha, beta float64) []float64 {
+	spread := make([]float64, len(a))
+	for i := range a {
+		spread[i] = a[i] - alpha - beta*b[i]
+	}
+	return spread
+}
+
+// HalfLife estimates bars until a deviation of the spread halves by the AR(1) fit
+// Δs_t = c + λ·s_{t-1}. Без возврата к среднему (λ >= 0) - +Inf.
+func HalfLife(spread []float64) float64 {
+	if len(spread) < 3 {
+		return math.Inf(1)
+	}
+	lagged := spread[:len(spread)-1]
+	diff := make([]float64, len(lagged))
+	for i := range diff {
+		diff[i] = spread[i+1] - spread[i]
+	}
+	variance := pkg.Covariance(lagged, lagged)
+	if variance <= 0 {
+		return math.Inf(1)
+	}
+	lambda := pkg.Covariance(diff, lagged) / variance
+	switch {
+	case lambda >= 0:
+		return math.Inf(1)
+	case lambda <= -1:
+		return 0
+	}
+	return -math.Ln2 / math.Log(1+lambda)
+}
+
+// ZScore returns the deviation of the last value from the mean in standard deviations.
+func ZScore(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	std := pkg.StandardDeviation(values)
+	if std == 0 {
+		return 0
+	}
+	return (values[len(values)-1] - pkg.Average(values)) / std
+}
+
+// EngleGranger tests the cointegration of log prices a and b: регрессия a на b,
+// затем ADF остатков без константы с критическими значениями для двух переменных.
+func EngleGranger(isinA, isinB dto.Isin, a, b []float64, maxLag int) dto.Pair {
+	alpha, beta := HedgeRatio(a, b)
+	spread := Spread(a, b, alpha, beta)
+	returnsA, returnsB := make([]float64, 0, len(a)), make([]float64, 0, len(b))
+	for i := 1; i < len(a); i++ {
+		returnsA = append(returnsA, a[i]-a[i-1])
+		returnsB = append(returnsB, b[i]-b[i-1])
+	}
+	pair := dto.Pair{
+		A:           isinA,
+		B:           isinB,
+		Alpha:       alpha,
+		HedgeRatio:  beta,
+		Test:        adf(spread, maxLag, false, 2),
+		HalfLife:    HalfLife(spread),
+		ZScore:      ZScore(spread),
+		Correlation: pkg.Correlation(returnsA, returnsB),
+	}
+	if len(spread) > 0 {
+		pair.SpreadStd = pkg.StandardDeviation(spread)
+	}
+	return pair
+}
+
+// FindPairs tests all pairs of instruments on their common candles and returns cointegrated
+// ones sorted by the test statistic: сначала самые надёжные. Направление регрессии выбирается
+// до теста - регрессором служит менее волатильный инструмент: минимум статистики двух
+// направлений завышал бы число ложных пар при тех же критических значениях.
+func FindPairs(candlesByIsin map[dto.Isin][]dto.Candle, opts PairOptions) []dto.Pair {
+	var isins []dto.Isin
+	for isin := range candlesByIsin {
+		isins = append(isins, isin)
+	}
+	sort.Slice(isins, func(i, j int) bool {
+		return isins[i] < isins[j]
+	})
+	var pairs []dto.Pair
+	for i := range isins {
+		for j := i + 1; j < len(isins); j++ {
+			a, b, ok := logCloses(candlesByIsin[isins[i]], candlesByIsin[isins[j]])
+			if !ok {
+				continue
+			}
+			var pair dto.Pair
+			if diffStd(a) < diffStd(b) {
+				pair = EngleGranger(isins[j], isins[i], b, a, opts.MaxLag)
+			} else {
+				pair = EngleGranger(isins[i], isins[j], a, b, opts.MaxLag)
+			}
+			if !pair.Test.Stationary(opts.Significance) || math.IsInf(pair.HalfLife, 1) {
+				continue
+			}
+			if opts.MaxHalfLife > 0 && pair.HalfLife > opts.MaxHalfLife {
+				continue
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Test.Statistic < pairs[j].Test.Statistic
+	})
+	return pairs
+}
+
+// logCloses returns log closes of the common days of two instruments.
+func logCloses(a, b []dto.Candle) ([]float64, []float64, bool) {
+	a, b = AlignCandles(a, b)
+	if len(a) < minPairObservations {
+		return nil, nil, false
+	}
+	logA, logB := make([]float64, len(a)), make([]float64, len(b))
+	for i := range a {
+		if a[i].Close <= 0 || b[i].Close <= 0 {
+			return nil, nil, false
+		}
+		logA[i], logB[i] = math.Log(a[i].Close), math.Log(b[i].Close)
+	}
+	return logA, logB, true
+}
+
+// diffStd returns the standard deviation of the differences of the series.
+func diffStd(series []float64) float64 {
+	diff := make([]float64, 0, len(series))
+	for i := 1; i < len(series); i++ {
+		diff = append(diff, series[i]-series[i-1])
+	}
+	if len(diff) == 0 {
+		return 0
+	}
+	return pkg.StandardDeviation(diff)
+}
+
+// DisjointPairs keeps at most `max` pairs in order so that each instrument is in one pair only.
+func DisjointPairs(pairs []dto.Pair, max int) []dto.Pair {
+	used := make(map[dto.Isin]bool)
+	var selected []dto.Pair
+	for _, p := range pairs {
+		if max > 0 && len(selected) >= max {
+			break
+		}
+		if used[p.A] || used[p.B] {
+			continue
+		}
+		used[p.A], used[p.B] = true, true
+		selected = append(selected, p)
+	}
+	return selected
+}
@@ -0,0 +1,83 @@
+package analytics
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// AR(2) в разностях: Δy_t = -0.3·y_{t-1} + 0.5·Δy_{t-1} + ε_t. Эталон посчитан отдельной
+// регрессией МНК с той же спецификацией и выбором лагов по AIC.
+var adfSeries = []float64{
+	0, 0, -0.2559, 0.2044, 0.1471, -0.2407, -1.2925, -1.6439, -0.2145, 0.9887,
+	2.3305, 2.5512, 2.291, 1.6589, -0.8209, -0.9593, -0.2343, 0.6973, -0.7374, -2.9775,
+	-4.0939, -3.8921, -2.3181, -0.8816, 0.6221, 0.5451, 0.6518, 0.9037, 0.0975, 1.3826,
+	2.167, 3.1061, 2.0235, 0.1356, -1.193, -1.6059, -0.6985, 0.2132, 0.1577, -0.8742,
+	-1.6485, -0.3202, -0.3679, -0.0366, 0.5665, -0.7916, -1.1847, 0.2804, -1.0855, -1.7644,
+	-1.6807, -1.9519, -1.0045, -0.2918, -1.3125, -0.6013, 0.604, 1.9713, 3.5042, 3.5816,
+}
+
+func TestADF(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxLag       int
+		lags         int
+		observations int
+		statistic    float64
+	}{
+		{"no lags", 0, 0, 59, -2.0258544654294157},
+		{"AIC picks one lag", 4, 1, 58, -3.9628576408482528},
+	}
+	for _, tt := range tests {
+		got := ADF(adfSeries, tt.maxLag)
+		if got.Lags != tt.lags || got.Observations != tt.observations {
+			t.Errorf("%s: lags %d on %d observations, want %d on %d", tt.name, got.Lags, got.Observations, tt.lags, tt.observations)
+		}
+		if !near(got.Statistic, tt.statistic) {
+			t.Errorf("%s: statistic %v, want %v", tt.name, got.Statistic, tt.statistic)
+		}
+	}
+	// MacKinnon для 5% на 58 наблюдениях
+	if got := ADF(adfSeries, 4).Critical[1]; !near(got, -2.912836594776334) {
+		t.Errorf("5%% critical value %v, want -2.9128", got)
+	}
+}
+
+func TestHalfLife(t *testing.T) {
+	decay := func(phi float64) []float64 {
+		s := []float64{8}
+		for i := 1; i < 20; i++ {
+			s = append(s, s[i-1]*phi)
+		}
+		return s
+	}
+	rng := rand.New(rand.NewSource(1))
+	ar := []float64{0}
+	for i := 1; i < 5000; i++ {
+		ar = append(ar, 0.9*ar[i-1]+rng.NormFloat64())
+	}
+	tests := []struct {
+		name      string
+		spread    []float64
+		want      float64
+		tolerance float64
+	}{
+		{"halves every bar", decay(0.5), 1, 1e-9},
+		{"decay 0.8", decay(0.8), -math.Ln2 / math.Log(0.8), 1e-9},
+		{"AR(1) 0.9", ar, -math.Ln2 / math.Log(0.9), 0.5},
+		{"growth", decay(1.1), math.Inf(1), 0},
+		{"too short", []float64{1, 0}, math.Inf(1), 0},
+	}
+	for _, tt := range tests {
+		got := HalfLife(tt.spread)
+		if math.IsInf(tt.want, 1) {
+			if !math.IsInf(got, 1) {
+				t.Errorf("%s: HalfLife = %v, want +Inf", tt.name, got)
+			}
+			continue
+		}
+		if math.Abs(got-tt.want) > tt.tolerance {
+			t.Errorf("%s: HalfLife = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
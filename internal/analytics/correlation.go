@@ -0,0 +1,200 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg"
+)
+
+// AlignReturns calculates returns of instruments on the dates common to all of them.
+// Инструменты сортируются по ISIN, чтобы порядок в матрицах был стабильным.
+// Дата доходности - дата свечи, на которой она получена.
+func AlignReturns(candlesByIsin map[dto.Isin][]dto.Candle, returnType dto.ReturnType) ([]dto.Isin, []time.Time, [][]float64) {
+	var isins []dto.Isin
+	for isin := range candlesByIsin {
+		isins = append(isins, isin)
+	}
+	sort.Slice(isins, func(i, j int) bool {
+		return isins[i] < isins[j]
+	})
+	if len(isins) == 0 {
+		return nil, nil, nil
+	}
+
+	closes := make(map[time.Time][]float64)
+	for k, isin := range isins {
+		for _, c := range candlesByIsin[isin] {
+			if _, exists := closes[c.Time]; !exists {
+				closes[c.Time] = make([]float64, len(isins))
+			}
+			closes[c.Time][k] = c.Close
+		}
+	}
+	var dates []time.Time
+	for t, prices := range closes {
+		common := true
+		for _, p := range prices {
+			if p <= 0 {
+				common = false
+				break
+			}
+		}
+		if common {
+			dates = append(dates, t)
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+	if len(dates) < 2 {
+		return isins, nil, make([][]float64, len(isins))
+	}
+
+	returns := make([][]float64, len(isins))
+	for k := range isins {
+		returns[k] = make([]float64, len(dates)-1)
+		for i := 1; i < len(dates); i++ {
+			prev, curr := closes[dates[i-1]][k], closes[dates[i]][k]
+			if returnType == dto.ReturnLog {
+				returns[k][i-1] = math.Log(curr / prev)
+			} else {
+				returns[k][i-1] = (curr - prev) / prev
+			}
+		}
+	}
+	return isins, dates[1:], returns
+}
+
+func buildMatrix(isins []dto.Isin, returns [][]float64, f func(a, b []float64) float64) dto.Matrix {
+	values := make([][]float64, len(isins))
+	for i := range isins {
+		values[i] = make([]float64, len(isins))
+		for j := 0; j <= i; j++ {
+			values[i][j] = f(returns[i], returns[j])
+			values[j][i] = values[i][j]
+		}
+	}
+	return dto.Matrix{Isins: isins, Values: values}
+}
+
+// CovarianceMatrix calculates the covariance matrix of aligned returns.
+func CovarianceMatrix(isins []dto.Isin, returns [][]float64) dto.Matrix {
+	return buildMatrix(isins, returns, pkg.Covariance)
+}
+
+// CorrelationMatrix calculates the correlation matrix of aligned returns.
+func CorrelationMatrix(isins []dto.Isin, returns [][]float64) dto.Matrix {
+	return buildMatrix(isins, returns, pkg.Correlation)
+}
+
+// CorrelationReports calculates matrices and clusters over a rolling window of returns
+// moving by `step` dates. The last report always ends on the last date.
+func CorrelationReports(candlesByIsin map[dto.Isin][]dto.Candle, window int, step int, returnType dto.ReturnType) []dto.CorrelationReport {
+	isins, dates, returns := AlignReturns(candlesByIsin, returnType)
+	if window <= 1 || len(dates) < window {
+		return nil
+	}
+	if step <= 0 {
+		step = 1
+	}
+	var reports []dto.CorrelationReport
+	// окна от первого возможного до последней даты
+	for end := window + (len(dates)-window)%step; end <= len(dates); end += step {
+		windowReturns := make([][]float64, len(isins))
+		for k := range isins {
+			windowReturns[k] = returns[k][end-window : end]
+		}
+		correlation := CorrelationMatrix(isins, windowReturns)
+		reports = append(reports, dto.CorrelationReport{
+			Time:        dates[end-1],
+			Window:      window,
+			Returns:     returnType,
+			Correlation: correlation,
+			Covariance:  CovarianceMatrix(isins, windowReturns),
+			Clusters:    HierarchicalClustering(correlation),
+		})
+	}
+	return reports
+}
+
+// HierarchicalClustering builds the dendrogram of instruments with average linkage.
+// Расстояние между инструментами: sqrt((1 - корреляция) / 2).
+func HierarchicalClustering(correlation dto.Matrix) *dto.Cluster {
+	n := len(correlation.Isins)
+	if n == 0 {
+		return nil
+	}
+	distance := func(i, j int) float64 {
+		return math.Sqrt(math.Max(0, (1-correlation.Values[i][j])/2))
+	}
+	type node struct {
+		cluster *dto.Cluster
+		members []int
+	}
+	nodes := make([]node, n)
+	for i, isin := range correlation.Isins {
+		nodes[i] = node{cluster: &dto.Cluster{Isins: []dto.Isin{isin}}, members: []int{i}}
+	}
+	linkage := func(a, b node) float64 {
+		var sum float64
+		for _, i := range a.members {
+			for _, j := range b.members {
+				sum += distance(i, j)
+			}
+		}
+		return sum / float64(len(a.members)*len(b.members))
+	}
+	for len(nodes) > 1 {
+		bestA, bestB, best := 0, 1, math.Inf(1)
+		for a := 0; a < len(nodes); a++ {
+			for b := a + 1; b < len(nodes); b++ {
+				if d := linkage(nodes[a], nodes[b]); d < best {
+					bestA, bestB, best = a, b, d
+				}
+			}
+		}
+		left, right := nodes[bestA], nodes[bestB]
+		merged := node{
+			cluster: &dto.Cluster{
+				Isins:    append(append([]dto.Isin{}, left.cluster.Isins...), right.cluster.Isins...),
+				Distance: best,
+				Left:     left.cluster,
+				Right:    right.cluster,
+			},
+			members: append(append([]int{}, left.members...), right.members...),
+		}
+		nodes[bestA] = merged
+		nodes = append(nodes[:bestB], nodes[bestB+1:]...)
+	}
+	return nodes[0].cluster
+}
+
+// CutClusters splits the dendrogram into `k` groups by the largest merge distances.
+func CutClusters(root *dto.Cluster, k int) [][]dto.Isin {
+	if root == nil {
+		return nil
+	}
+	clusters := []*dto.Cluster{root}
+	for len(clusters) < k {
+		split := -1
+		for i, c := range clusters {
+			if c.Left != nil && (split < 0 || c.Distance > clusters[split].Distance) {
+				split = i
+			}
+		}
+		if split < 0 {
+			break
+		}
+		c := clusters[split]
+		clusters[split] = c.Left
+		clusters = append(clusters, c.Right)
+	}
+	groups := make([][]dto.Isin, len(clusters))
+	for i, c := range clusters {
+		groups[i] = c.Isins
+	}
+	return groups
+}
@@ -0,0 +1,121 @@
+package analytics
+
+import (
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// FindSeriesSwings finds swing highs and lows of the indicator series
+// by the same rule as FindSwings: `n` values on each side.
+func FindSeriesSwings(series dto.Series, n int) []dto.SeriesSwing {
+	var swings []dto.SeriesSwing
+	values := series.Values
+	for i := n; i < len(values)-n; i++ {
+		isSwingHigh := true
+		isSwingLow := true
+		for j := -n; j <= n; j++ {
+			if j != 0 {
+				if values[i] <= values[i+j] {
+					isSwingHigh = false
+				}
+				if values[i] >= values[i+j] {
+					isSwingLow = false
+				}
+			}
+		}
+		if isSwingHigh {
+			swings = append(swings, dto.SeriesSwing{Type: dto.SwingHigh, Time: series.Dates[i], Value: values[i]})
+		}
+		if isSwingLow {
+			swings = append(swings, dto.SeriesSwing{Type: dto.SwingLow, Time: series.Dates[i], Value: values[i]})
+		}
+	}
+	return swings
+}
+
+// FindDivergences finds regular and hidden divergences between price swings and indicator swings.
+// Indicator swing matches the price swing of the same type if it is no more than `window` bars away.
+func FindDivergences(candles []dto.Candle, swings []dto.Swing, series dto.Series, n int, window int) []dto.Divergence {
+	index := make(map[time.Time]int, len(candles))
+	for i, c := range candles {
+		index[c.Time] = i
+	}
+	indicatorSwings := FindSeriesSwings(series, n)
+	// ближайший экстремум индикатора того же типа
+	match := func(s dto.Swing) (dto.SeriesSwing, bool) {
+		var found dto.SeriesSwing
+		best := window + 1
+		for _, is := range indicatorSwings {
+			if is.Type != s.Type {
+				continue
+			}
+			distance := index[is.Time] - index[s.Candle.Time]
+			if distance < 0 {
+				distance = -distance
+			}
+			if distance < best {
+				best = distance
+				found = is
+			}
+		}
+		return found, best <= window
+	}
+
+	var divergences []dto.Divergence
+	lastByType := make(map[dto.SwingType]dto.Swing)
+	for _, s := range swings {
+		p, exists := lastByType[s.Type]
+		lastByType[s.Type] = s
+		if !exists {
+			continue
+		}
+		ip, okPrev := match(p)
+		is, okCurr := match(s)
+		if !okPrev || !okCurr || !ip.Time.Before(is.Time) {
+			continue
+		}
+		d := dto.Divergence{
+			Indicator:       series.Name,
+			Time:            s.Candle.Time,
+			PriceSwings:     [2]dto.Swing{p, s},
+			IndicatorSwings: [2]dto.SeriesSwing{ip, is},
+		}
+		priceUp, priceDown := s.GetValue() > p.GetValue(), s.GetValue() < p.GetValue()
+		indicatorUp, indicatorDown := is.Value > ip.Value, is.Value < ip.Value
+		switch {
+		case s.Type == dto.SwingHigh && priceUp && indicatorDown:
+			d.Type, d.Direction = dto.DivergenceRegular, dto.DirectionBearish
+		case s.Type == dto.SwingHigh && priceDown && indicatorUp:
+			d.Type, d.Direction = dto.DivergenceHidden, dto.DirectionBearish
+		case s.Type == dto.SwingLow && priceDown && indicatorUp:
+			d.Type, d.Direction = dto.DivergenceRegular, dto.DirectionBullish
+		case s.Type == dto.SwingLow && priceUp && indicatorDown:
+			d.Type, d.Direction = dto.DivergenceHidden, dto.DirectionBullish
+		default:
+			continue
+		}
+		divergences = append(divergences, d)
+	}
+	return divergences
+}
+
+// TrendWarnings returns regular divergences anchored at the last swing against the current trend.
+// Это ранний признак смены тренда, который GetTrends ещё не видит.
+func TrendWarnings(trend dto.TrendType, swings []dto.Swing, divergences []dto.Divergence) []dto.Divergence {
+	if len(swings) == 0 {
+		return nil
+	}
+	last := swings[len(swings)-1]
+	var warnings []dto.Divergence
+	for _, d := range divergences {
+		if d.Type != dto.DivergenceRegular || !d.PriceSwings[1].Candle.Time.Equal(last.Candle.Time) {
+			continue
+		}
+		if trend == dto.TrendUp && d.Direction == dto.DirectionBearish ||
+			trend == dto.TrendDown && d.Direction == dto.DirectionBullish {
+			warnings = append(warnings, d)
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,65 @@
+package analytics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+var (
+	FibonacciRetracements = []float64{0.236, 0.382, 0.5, 0.618, 0.786}
+	FibonacciExtensions   = []float64{1.272, 1.618, 2.618}
+)
+
+// LastSwingLeg returns the last swing and the nearest previous swing of the opposite type.
+func LastSwingLeg(swings []dto.Swing) (from dto.Swing, to dto.Swing, ok bool) {
+	if len(swings) < 2 {
+		return
+	}
+	to = swings[len(swings)-1]
+	for i := len(swings) - 2; i >= 0; i-- {
+		if swings[i].Type != to.Type {
+			return swings[i], to, true
+		}
+	}
+	return
+}
+
+// LastZigZagLeg returns the last two ZigZag points.
+func LastZigZagLeg(points []dto.ZigZagPoint) (from dto.ZigZagPoint, to dto.ZigZagPoint, ok bool) {
+	if len(points) < 2 {
+		return
+	}
+	return points[len(points)-2], points[len(points)-1], true
+}
+
+// FibonacciLevels calculates retracement and extension levels of the leg `from` -> `to`.
+// Коррекции откладываются от `to` назад, расширения - от `from` за пределы `to`.
+func FibonacciLevels(from, to float64, t time.Time, price float64) []dto.Level {
+	var levels []dto.Level
+	add := func(name string, value float64) {
+		levelType := dto.LevelSupport
+		if value > price {
+			levelType = dto.LevelResistance
+		}
+		levels = append(levels, dto.Level{Name: name, Type: levelType, Price: value, Time: t})
+	}
+	leg := to - from
+	for _, r := range FibonacciRetracements {
+		add(fmt.Sprintf("Fib %.1f%%", r*100), to-leg*r)
+	}
+	for _, e := range FibonacciExtensions {
+		add(fmt.Sprintf("Fib ext %.1f%%", e*100), from+leg*e)
+	}
+	return levels
+}
+
+// SwingFibonacciLevels calculates Fibonacci levels of the last swing leg.
+func SwingFibonacciLevels(candles []dto.Candle, swings []dto.Swing) []dto.Level {
+	from, to, ok := LastSwingLeg(swings)
+	if !ok || len(candles) == 0 {
+		return nil
+	}
+	return FibonacciLevels(from.GetValue(), to.GetValue(), to.Candle.Time, candles[len(candles)-1].Close)
+}
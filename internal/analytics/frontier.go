@@ -0,0 +1,189 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg"
+)
+
+type FrontierOptions struct {
+	RiskFree  float64 // годовая безрисковая ставка
+	Points    int     // точек границы, 0 - 20
+	Shrinkage bool    // оценка ковариации по Ледуа-Вулфу
+	// Ограничения доли инструмента, по умолчанию от 0 до 1
+	Min map[dto.Isin]float64
+	Max map[dto.Isin]float64
+}
+
+// LedoitWolf shrinks the sample covariance of aligned returns to the scaled identity matrix
+// with the optimal intensity (Ledoit, Wolf, 2004). Выборочная ковариация при коротком окне
+// и многих инструментах слишком шумная для оптимизатора. Returns the matrix and the intensity.
+func LedoitWolf(isins []dto.Isin, returns [][]float64) (dto.Matrix, float64) {
+	sample := CovarianceMatrix(isins, returns)
+	n := len(isins)
+	if n == 0 || len(returns[0]) < 2 {
+		return sample, 0
+	}
+	t := len(returns[0])
+	s := sample.Values
+	var mu float64
+	for i := 0; i < n; i++ {
+		mu += s[i][i]
+	}
+	mu /= float64(n)
+	// d² - расстояние выборочной матрицы до цели, b² - дисперсия выборочной оценки
+	var d2 float64
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			target := 0.0
+			if i == j {
+				target = mu
+			}
+			d2 += (s[i][j] - target) * (s[i][j] - target)
+		}
+	}
+	means := make([]float64, n)
+	for i := range means {
+		means[i] = pkg.Average(returns[i])
+	}
+	var b2 float64
+	for k := 0; k < t; k++ {
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				x := (returns[i][k]-means[i])*(returns[j][k]-means[j]) - s[i][j]
+				b2 += x * x
+			}
+		}
+	}
+	b2 /= float64(t) * float64(t)
+	if d2 <= 0 {
+		return sample, 0
+	}
+	delta := math.Min(b2, d2) / d2
+	values := make([][]float64, n)
+	for i := range values {
+		values[i] = make([]float64, n)
+		for j := range values[i] {
+			values[i][j] = (1 - delta) * s[i][j]
+			if i == j {
+				values[i][j] += delta * mu
+			}
+		}
+	}
+	return dto.Matrix{Isins: isins, Values: values}, delta
+}
+
+// EfficientFrontier calculates long-only portfolios with the minimal risk for their return
+// by aligned daily returns of the instruments. Точки границы - решения min w'Σw - q·μ'w
+// для q от 0 (минимальная дисперсия) до q, при котором доходность перестаёт расти.
+func EfficientFrontier(isins []dto.Isin, returns [][]float64, opts FrontierOptions) (dto.EfficientFrontier, error) {
+	frontier := dto.EfficientFrontier{Isins: isins}
+	n := len(isins)
+	if n == 0 || len(returns[0]) < 2 {
+		return frontier, fmt.Errorf("analytics.EfficientFrontier: not enough returns")
+	}
+	lo, hi := make([]float64, n), make([]float64, n)
+	var sumLo, sumHi float64
+	for i, isin := range isins {
+		lo[i], hi[i] = 0, 1
+		if v, exists := opts.Min[isin]; exists {
+			lo[i] = math.Max(0, v)
+		}
+		if v, exists := opts.Max[isin]; exists {
+			hi[i] = math.Min(1, v)
+		}
+		if lo[i] > hi[i] {
+			return frontier, fmt.Errorf("analytics.EfficientFrontier: %s min weight %g is above max %g", isin, lo[i], hi[i])
+		}
+		sumLo += lo[i]
+		sumHi += hi[i]
+	}
+	if sumLo > 1+1e-9 || sumHi < 1-1e-9 {
+		return frontier, fmt.Errorf("analytics.EfficientFrontier: weights can not sum to 1 with limits %g..%g", sumLo, sumHi)
+	}
+
+	cov := CovarianceMatrix(isins, returns)
+	if opts.Shrinkage {
+		cov, frontier.Shrinkage = LedoitWolf(isins, returns)
+	}
+	sigma := make([][]float64, n)
+	mu := make([]float64, n)
+	for i := range isins {
+		mu[i] = pkg.Average(returns[i]) * TradingDays
+		sigma[i] = make([]float64, n)
+		for j := range sigma[i] {
+			sigma[i][j] = cov.Values[i][j] * TradingDays
+		}
+	}
+	point := func(w []float64) dto.PortfolioPoint {
+		p := dto.PortfolioPoint{Weights: toWeights(isins, w)}
+		var variance float64
+		for i := range w {
+			p.Return += w[i] * mu[i]
+			for j := range w {
+				variance += w[i] * sigma[i][j] * w[j]
+			}
+		}
+		p.Volatility = math.Sqrt(math.Max(0, variance))
+		if p.Volatility > 1e-9 {
+			p.Sharpe = (p.Return - opts.RiskFree) / p.Volatility
+		}
+		return p
+	}
+	solve := func(q float64) dto.PortfolioPoint {
+		c := make([]float64, n)
+		for i := range c {
+			c[i] = q * mu[i]
+		}
+		return point(minimizeQuadratic(sigma, c, lo, hi))
+	}
+
+	for i := range isins {
+		w := make([]float64, n)
+		w[i] = 1
+		frontier.Assets = append(frontier.Assets, point(w))
+	}
+	frontier.MinVariance = solve(0)
+
+	// q, после которого доходность не растёт
+	qMax := 1e-3
+	top := solve(qMax)
+	for k := 0; k < 60; k++ {
+		next := solve(qMax * 2)
+		if next.Return-top.Return < 1e-9 {
+			break
+		}
+		qMax, top = qMax*2, next
+	}
+	points := opts.Points
+	if points <= 0 {
+		points = 20
+	}
+	for k := 0; k < points; k++ {
+		// квадрат сгущает точки у минимальной дисперсии, где граница изгибается сильнее
+		var x float64
+		if points > 1 {
+			x = float64(k) / float64(points-1)
+		}
+		p := solve(qMax * x * x)
+		if l := len(frontier.Points); l > 0 && math.Abs(p.Return-frontier.Points[l-1].Return) < 1e-9 {
+			continue
+		}
+		frontier.Points = append(frontier.Points, p)
+	}
+
+	// Sharpe вдоль границы унимодален, поэтому максимум ищется тернарным поиском по q
+	left, right := 0.0, qMax
+	for k := 0; k < 60; k++ {
+		m1, m2 := left+(right-left)/3, right-(right-left)/3
+		if solve(m1).Sharpe < solve(m2).Sharpe {
+			left = m1
+		} else {
+			right = m2
+		}
+	}
+	frontier.MaxSharpe = solve((left + right) / 2)
+	return frontier, nil
+}
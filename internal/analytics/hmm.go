@@ -0,0 +1,203 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	"github.com/tikhomirovv/lazy-investor/pkg"
+)
+
+// Простая скрытая марковская модель с гауссовскими наблюдениями.
+// Обучается локально алгоритмом Баума-Велша.
+type HMM struct {
+	Initial    []float64
+	Transition [][]float64
+	Means      []float64
+	Variances  []float64
+}
+
+const hmmMinVariance = 1e-12
+
+func gaussian(x, mean, variance float64) float64 {
+	return math.Exp(-(x-mean)*(x-mean)/(2*variance)) / math.Sqrt(2*math.Pi*variance)
+}
+
+// FitHMM fits the model with `states` hidden states to observations.
+// Начальные средние берутся по квантилям, поэтому результат детерминирован.
+func FitHMM(observations []float64, states int, iterations int) *HMM {
+	n := len(observations)
+	h := &HMM{
+		Initial:    make([]float64, states),
+		Transition: make([][]float64, states),
+		Means:      make([]float64, states),
+		Variances:  make([]float64, states),
+	}
+	sorted := make([]float64, n)
+	copy(sorted, observations)
+	sort.Float64s(sorted)
+	variance := hmmMinVariance
+	if n > 0 {
+		variance = math.Max(math.Pow(pkg.StandardDeviation(observations), 2), hmmMinVariance)
+	}
+	for i := 0; i < states; i++ {
+		h.Initial[i] = 1 / float64(states)
+		h.Transition[i] = make([]float64, states)
+		for j := range h.Transition[i] {
+			if i == j {
+				h.Transition[i][j] = 0.9
+			} else {
+				h.Transition[i][j] = 0.1 / float64(states-1)
+			}
+		}
+		if n > 0 {
+			h.Means[i] = sorted[(2*i+1)*n/(2*states)]
+		}
+		h.Variances[i] = variance
+	}
+	if states == 1 {
+		h.Transition[0][0] = 1
+	}
+	if n < 2 {
+		return h
+	}
+
+	alpha := make([][]float64, n)
+	beta := make([][]float64, n)
+	gamma := make([][]float64, n)
+	for t := range alpha {
+		alpha[t] = make([]float64, states)
+		beta[t] = make([]float64, states)
+		gamma[t] = make([]float64, states)
+	}
+	scale := make([]float64, n)
+	emission := func(t, i int) float64 {
+		return math.Max(gaussian(observations[t], h.Means[i], h.Variances[i]), 1e-300)
+	}
+
+	for iter := 0; iter < iterations; iter++ {
+		// forward
+		for t := 0; t < n; t++ {
+			scale[t] = 0
+			for j := 0; j < states; j++ {
+				if t == 0 {
+					alpha[t][j] = h.Initial[j] * emission(t, j)
+				} else {
+					var sum float64
+					for i := 0; i < states; i++ {
+						sum += alpha[t-1][i] * h.Transition[i][j]
+					}
+					alpha[t][j] = sum * emission(t, j)
+				}
+				scale[t] += alpha[t][j]
+			}
+			for j := 0; j < states; j++ {
+				alpha[t][j] /= scale[t]
+			}
+		}
+		// backward
+		for j := 0; j < states; j++ {
+			beta[n-1][j] = 1
+		}
+		for t := n - 2; t >= 0; t-- {
+			for i := 0; i < states; i++ {
+				var sum float64
+				for j := 0; j < states; j++ {
+					sum += h.Transition[i][j] * emission(t+1, j) * beta[t+1][j]
+				}
+				beta[t][i] = sum / scale[t+1]
+			}
+		}
+		// оценка параметров
+		xi := make([][]float64, states)
+		for i := range xi {
+			xi[i] = make([]float64, states)
+		}
+		for t := 0; t < n; t++ {
+			var sum float64
+			for i := 0; i < states; i++ {
+				gamma[t][i] = alpha[t][i] * beta[t][i]
+				sum += gamma[t][i]
+			}
+			for i := 0; i < states; i++ {
+				gamma[t][i] /= sum
+			}
+			if t == n-1 {
+				continue
+			}
+			for i := 0; i < states; i++ {
+				for j := 0; j < states; j++ {
+					xi[i][j] += alpha[t][i] * h.Transition[i][j] * emission(t+1, j) * beta[t+1][j] / scale[t+1]
+				}
+			}
+		}
+		for i := 0; i < states; i++ {
+			h.Initial[i] = gamma[0][i]
+			var rowSum, weight, mean float64
+			for j := 0; j < states; j++ {
+				rowSum += xi[i][j]
+			}
+			if rowSum > 0 {
+				for j := 0; j < states; j++ {
+					h.Transition[i][j] = xi[i][j] / rowSum
+				}
+			}
+			for t := 0; t < n; t++ {
+				weight += gamma[t][i]
+				mean += gamma[t][i] * observations[t]
+			}
+			if weight == 0 {
+				continue
+			}
+			mean /= weight
+			var v float64
+			for t := 0; t < n; t++ {
+				v += gamma[t][i] * (observations[t] - mean) * (observations[t] - mean)
+			}
+			h.Means[i] = mean
+			h.Variances[i] = math.Max(v/weight, hmmMinVariance)
+		}
+	}
+	return h
+}
+
+// Decode returns the most probable sequence of hidden states (Viterbi).
+func (h *HMM) Decode(observations []float64) []int {
+	n, states := len(observations), len(h.Means)
+	if n == 0 {
+		return nil
+	}
+	logProb := func(p float64) float64 {
+		return math.Log(math.Max(p, 1e-300))
+	}
+	delta := make([][]float64, n)
+	path := make([][]int, n)
+	for t := range delta {
+		delta[t] = make([]float64, states)
+		path[t] = make([]int, states)
+	}
+	for j := 0; j < states; j++ {
+		delta[0][j] = logProb(h.Initial[j]) + logProb(gaussian(observations[0], h.Means[j], h.Variances[j]))
+	}
+	for t := 1; t < n; t++ {
+		for j := 0; j < states; j++ {
+			best, bestState := math.Inf(-1), 0
+			for i := 0; i < states; i++ {
+				if p := delta[t-1][i] + logProb(h.Transition[i][j]); p > best {
+					best, bestState = p, i
+				}
+			}
+			delta[t][j] = best + logProb(gaussian(observations[t], h.Means[j], h.Variances[j]))
+			path[t][j] = bestState
+		}
+	}
+	result := make([]int, n)
+	for j := 1; j < states; j++ {
+		if delta[n-1][j] > delta[n-1][result[n-1]] {
+			result[n-1] = j
+		}
+	}
+	for t := n - 1; t > 0; t-- {
+		result[t-1] = path[t][result[t]]
+	}
+	return result
+}
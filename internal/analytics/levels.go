@@ -0,0 +1,60 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// FindLevels groups swings with close values into support and resistance levels.
+// `tolerance` is the relative distance between swings of one level (0.01 = 1%).
+// Levels below `price` are supports, above - resistances.
+func FindLevels(swings []dto.Swing, price float64, tolerance float64) []dto.Level {
+	sorted := make([]dto.Swing, len(swings))
+	copy(sorted, swings)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].GetValue() < sorted[j].GetValue()
+	})
+
+	var levels []dto.Level
+	var sum float64
+	for _, s := range sorted {
+		value := s.GetValue()
+		if len(levels) > 0 {
+			last := &levels[len(levels)-1]
+			if math.Abs(value-last.Price) <= last.Price*tolerance {
+				sum += value
+				last.Touches++
+				last.Price = sum / float64(last.Touches)
+				if s.Candle.Time.After(last.Time) {
+					last.Time = s.Candle.Time
+				}
+				continue
+			}
+		}
+		sum = value
+		levels = append(levels, dto.Level{Price: value, Time: s.Candle.Time, Touches: 1})
+	}
+	for i := range levels {
+		levels[i].Type = dto.LevelSupport
+		if levels[i].Price > price {
+			levels[i].Type = dto.LevelResistance
+		}
+	}
+	return levels
+}
+
+// NearestLevels returns the closest support below and resistance above the price.
+func NearestLevels(levels []dto.Level, price float64) (support *dto.Level, resistance *dto.Level) {
+	for i := range levels {
+		l := &levels[i]
+		if l.Price <= price && (support == nil || l.Price > support.Price) {
+			support = l
+		}
+		if l.Price > price && (resistance == nil || l.Price < resistance.Price) {
+			resistance = l
+		}
+	}
+	return
+}
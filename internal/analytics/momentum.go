@@ -0,0 +1,24 @@
+package analytics
+
+import "github.com/tikhomirovv/lazy-investor/internal/dto"
+
+// Momentum calculates the price change over the last `period` candles.
+// Если свечей не больше периода, изменение не определено и ok = false.
+func Momentum(candles []dto.Candle, period int) (float64, bool) {
+	if period <= 0 || len(candles) <= period {
+		return 0, false
+	}
+	start := candles[len(candles)-1-period]
+	if start.Close <= 0 {
+		return 0, false
+	}
+	return candles[len(candles)-1].Close/start.Close - 1, true
+}
+
+// LastCandles returns no more than `n` last candles.
+func LastCandles(candles []dto.Candle, n int) []dto.Candle {
+	if n <= 0 || n >= len(candles) {
+		return candles
+	}
+	return candles[len(candles)-n:]
+}
@@ -0,0 +1,97 @@
+package analytics
+
+import (
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+func candleDates(candles []dto.Candle) []time.Time {
+	dates := make([]time.Time, len(candles))
+	for i, c := range candles {
+		dates[i] = c.Time
+	}
+	return dates
+}
+
+// exponentialAverage calculates the exponential moving average of values.
+func exponentialAverage(values []float64, period int) []float64 {
+	result := make([]float64, len(values))
+	k := 2 / float64(period+1)
+	for i, v := range values {
+		if i == 0 {
+			result[i] = v
+			continue
+		}
+		result[i] = v*k + result[i-1]*(1-k)
+	}
+	return result
+}
+
+// CalculateRSI calculates the Relative Strength Index with Wilder's smoothing.
+func CalculateRSI(candles []dto.Candle, period int) dto.Series {
+	rsi := make([]float64, len(candles))
+	var avgGain, avgLoss float64
+	for i := 1; i < len(candles); i++ {
+		change := candles[i].Close - candles[i-1].Close
+		var gain, loss float64
+		if change > 0 {
+			gain = change
+		} else {
+			loss = -change
+		}
+		if i <= period {
+			avgGain += gain / float64(period)
+			avgLoss += loss / float64(period)
+		} else {
+			avgGain = (avgGain*float64(period-1) + gain) / float64(period)
+			avgLoss = (avgLoss*float64(period-1) + loss) / float64(period)
+		}
+		switch {
+		case i < period:
+			rsi[i] = 50
+		case avgLoss == 0:
+			rsi[i] = 100
+		default:
+			rsi[i] = 100 - 100/(1+avgGain/avgLoss)
+		}
+	}
+	if len(rsi) > 0 {
+		rsi[0] = 50
+	}
+	return dto.Series{Name: "RSI", Dates: candleDates(candles), Values: rsi}
+}
+
+// CalculateMACDHistogram calculates the MACD histogram: MACD line minus its signal line.
+func CalculateMACDHistogram(candles []dto.Candle, fast, slow, signal int) dto.Series {
+	closes := make([]float64, len(candles))
+	for i, c := range candles {
+		closes[i] = c.Close
+	}
+	fastEMA := exponentialAverage(closes, fast)
+	slowEMA := exponentialAverage(closes, slow)
+	macd := make([]float64, len(candles))
+	for i := range closes {
+		macd[i] = fastEMA[i] - slowEMA[i]
+	}
+	signalEMA := exponentialAverage(macd, signal)
+	histogram := make([]float64, len(candles))
+	for i := range macd {
+		histogram[i] = macd[i] - signalEMA[i]
+	}
+	return dto.Series{Name: "MACD Histogram", Dates: candleDates(candles), Values: histogram}
+}
+
+// CalculateOBV calculates the On-Balance Volume.
+func CalculateOBV(candles []dto.Candle) dto.Series {
+	obv := make([]float64, len(candles))
+	for i := 1; i < len(candles); i++ {
+		obv[i] = obv[i-1]
+		if candles[i].Close > candles[i-1].Close {
+			obv[i] += float64(candles[i].Volume)
+		} else if candles[i].Close < candles[i-1].Close {
+			obv[i] -= float64(candles[i].Volume)
+		}
+	}
+	return dto.Series{Name: "OBV", Dates: candleDates(candles), Values: obv}
+}
@@ -0,0 +1,164 @@
+package analytics
+
+import (
+	"math"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// Допуски для определения свечных паттернов. Все значения - доли диапазона свечи (High - Low),
+// кроме ShadowRatio, который задаётся относительно тела.
+type PatternOptions struct {
+	DojiBody    float64 // максимальное тело доджи
+	SmallBody   float64 // максимальное "маленькое" тело (звёзды, молот)
+	LongBody    float64 // минимальное "длинное" тело
+	ShadowRatio float64 // минимальная длинная тень молота относительно тела
+	MaxShadow   float64 // максимальная противоположная тень
+	Lookback    int     // количество свечей для определения предшествующего движения
+}
+
+func candleRange(c dto.Candle) float64 {
+	return c.High - c.Low
+}
+
+func candleBody(c dto.Candle) float64 {
+	return math.Abs(c.Close - c.Open)
+}
+
+func upperShadow(c dto.Candle) float64 {
+	return c.High - math.Max(c.Open, c.Close)
+}
+
+func lowerShadow(c dto.Candle) float64 {
+	return math.Min(c.Open, c.Close) - c.Low
+}
+
+func isBullish(c dto.Candle) bool {
+	return c.Close > c.Open
+}
+
+func isBearish(c dto.Candle) bool {
+	return c.Close < c.Open
+}
+
+// FindPatterns detects classic candlestick patterns in candles.
+// Several patterns can be found on the same candle.
+func FindPatterns(candles []dto.Candle, opts PatternOptions) []dto.Pattern {
+	var patterns []dto.Pattern
+	add := func(t dto.PatternType, d dto.Direction, c dto.Candle) {
+		patterns = append(patterns, dto.Pattern{Type: t, Direction: d, Time: c.Time, Candle: c})
+	}
+	// движение цены перед свечой i
+	move := func(i int) float64 {
+		if opts.Lookback <= 0 || i < opts.Lookback {
+			return 0
+		}
+		return candles[i-1].Close - candles[i-opts.Lookback].Close
+	}
+
+	for i, c := range candles {
+		r := candleRange(c)
+		if r <= 0 {
+			continue
+		}
+		body := candleBody(c)
+
+		// Одиночные свечи
+		if body <= opts.DojiBody*r {
+			add(dto.PatternDoji, dto.DirectionNeutral, c)
+		}
+		if body <= opts.SmallBody*r && body > 0 {
+			if lowerShadow(c) >= opts.ShadowRatio*body && upperShadow(c) <= opts.MaxShadow*r && move(i) < 0 {
+				add(dto.PatternHammer, dto.DirectionBullish, c)
+			}
+			if upperShadow(c) >= opts.ShadowRatio*body && lowerShadow(c) <= opts.MaxShadow*r && move(i) > 0 {
+				add(dto.PatternShootingStar, dto.DirectionBearish, c)
+			}
+		}
+		if i < 1 {
+			continue
+		}
+
+		// Две свечи
+		prev := candles[i-1]
+		if isBearish(prev) && isBullish(c) && c.Open <= prev.Close && c.Close >= prev.Open && body > candleBody(prev) {
+			add(dto.PatternBullishEngulfing, dto.DirectionBullish, c)
+		}
+		if isBullish(prev) && isBearish(c) && c.Open >= prev.Close && c.Close <= prev.Open && body > candleBody(prev) {
+			add(dto.PatternBearishEngulfing, dto.DirectionBearish, c)
+		}
+		if c.High < prev.High && c.Low > prev.Low {
+			add(dto.PatternInsideBar, dto.DirectionNeutral, c)
+		}
+		if c.High > prev.High && c.Low < prev.Low {
+			direction := dto.DirectionNeutral
+			if isBullish(c) {
+				direction = dto.DirectionBullish
+			} else if isBearish(c) {
+				direction = dto.DirectionBearish
+			}
+			add(dto.PatternOutsideBar, direction, c)
+		}
+		if i < 2 {
+			continue
+		}
+
+		// Три свечи
+		first, star := candles[i-2], prev
+		isLong := func(c dto.Candle) bool {
+			return candleRange(c) > 0 && candleBody(c) >= opts.LongBody*candleRange(c)
+		}
+		isSmall := func(c dto.Candle) bool {
+			return candleBody(c) <= opts.SmallBody*candleRange(c)
+		}
+		firstMiddle := (first.Open + first.Close) / 2
+		if isBearish(first) && isLong(first) && isSmall(star) && isBullish(c) && c.Close > firstMiddle {
+			add(dto.PatternMorningStar, dto.DirectionBullish, c)
+		}
+		if isBullish(first) && isLong(first) && isSmall(star) && isBearish(c) && c.Close < firstMiddle {
+			add(dto.PatternEveningStar, dto.DirectionBearish, c)
+		}
+		three := candles[i-2 : i+1]
+		soldiers, crows := true, true
+		for j, t := range three {
+			if !isLong(t) {
+				soldiers, crows = false, false
+				break
+			}
+			soldiers = soldiers && isBullish(t) && upperShadow(t) <= opts.MaxShadow*candleRange(t)
+			crows = crows && isBearish(t) && lowerShadow(t) <= opts.MaxShadow*candleRange(t)
+			if j > 0 {
+				p := three[j-1]
+				// открытие внутри тела предыдущей свечи
+				soldiers = soldiers && t.Close > p.Close && t.Open >= p.Open && t.Open <= p.Close
+				crows = crows && t.Close < p.Close && t.Open <= p.Open && t.Open >= p.Close
+			}
+		}
+		if soldiers {
+			add(dto.PatternThreeWhiteSoldiers, dto.DirectionBullish, c)
+		}
+		if crows {
+			add(dto.PatternThreeBlackCrows, dto.DirectionBearish, c)
+		}
+	}
+	return patterns
+}
+
+// PatternsAtLevels keeps patterns which confirm the levels:
+// bullish patterns near supports and bearish patterns near resistances.
+// `distance` is the relative distance from the level (0.01 = 1%).
+func PatternsAtLevels(patterns []dto.Pattern, levels []dto.Level, distance float64) []dto.Pattern {
+	var confirmed []dto.Pattern
+	for _, p := range patterns {
+		for _, l := range levels {
+			if p.Direction == dto.DirectionBullish && l.Type == dto.LevelSupport &&
+				math.Abs(p.Candle.Low-l.Price) <= l.Price*distance ||
+				p.Direction == dto.DirectionBearish && l.Type == dto.LevelResistance &&
+					math.Abs(p.Candle.High-l.Price) <= l.Price*distance {
+				confirmed = append(confirmed, p)
+				break
+			}
+		}
+	}
+	return confirmed
+}
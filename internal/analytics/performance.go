@@ -0,0 +1,398 @@
+package analytics
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// Допуск округления количества при учёте лотов
+const lotEpsilon = 1e-9
+
+// tradingDay returns the day of the moment: операции и свечи одного дня сравниваются по дням.
+func tradingDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// XIRR returns the annual rate at which the net present value of irregular flows is zero.
+// Потоки - со стороны инвестора: вложения отрицательные, получения положительные.
+func XIRR(flows []dto.Flow) (float64, error) {
+	if len(flows) < 2 {
+		return 0, errors.New("XIRR: at least two flows are required")
+	}
+	start := flows[0].Time
+	var positive, negative bool
+	var scale float64
+	for _, f := range flows {
+		if f.Time.Before(start) {
+			start = f.Time
+		}
+		positive = positive || f.Amount > 0
+		negative = negative || f.Amount < 0
+		scale += math.Abs(f.Amount)
+	}
+	if !positive || !negative {
+		return 0, errors.New("XIRR: flows must have both signs")
+	}
+	npv := func(r float64) (value, derivative float64) {
+		for _, f := range flows {
+			years := f.Time.Sub(start).Hours() / 24 / 365
+			discount := math.Pow(1+r, -years)
+			value += f.Amount * discount
+			derivative -= years * f.Amount * discount / (1 + r)
+		}
+		return value, derivative
+	}
+	tolerance := 1e-10 * scale
+
+	// метод Ньютона сходится быстро, но может уйти за -100%
+	r := 0.1
+	for iter := 0; iter < 100; iter++ {
+		value, derivative := npv(r)
+		if math.Abs(value) < tolerance {
+			return r, nil
+		}
+		if derivative == 0 || math.IsNaN(derivative) {
+			break
+		}
+		next := r - value/derivative
+		if next <= -1 {
+			next = (r - 1) / 2
+		}
+		r = next
+	}
+
+	// иначе делением отрезка пополам, расширяя правую границу до смены знака
+	lo, hi := -0.9999, 1.0
+	valueLo, _ := npv(lo)
+	valueHi, _ := npv(hi)
+	for valueLo*valueHi > 0 && hi < 1e6 {
+		hi *= 2
+		valueHi, _ = npv(hi)
+	}
+	if valueLo*valueHi > 0 {
+		return 0, errors.New("XIRR: no solution")
+	}
+	for iter := 0; iter < 200; iter++ {
+		mid := (lo + hi) / 2
+		value, _ := npv(mid)
+		if value*valueLo > 0 {
+			lo, valueLo = mid, value
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2, nil
+}
+
+// TimeWeightedReturn chains returns between values excluding flows. Поток дня считается
+// пришедшим в начале дня: r = V_t / (V_{t-1} + F_t) - 1. Потоки до первой стоимости уже в ней.
+// Flows must be sorted by time.
+func TimeWeightedReturn(values []dto.ValuePoint, flows []dto.Flow) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	k := 0
+	for k < len(flows) && !tradingDay(flows[k].Time).After(tradingDay(values[0].Time)) {
+		k++
+	}
+	growth := 1.0
+	for i := 1; i < len(values); i++ {
+		var flow float64
+		for k < len(flows) && !tradingDay(flows[k].Time).After(tradingDay(values[i].Time)) {
+			flow += flows[k].Amount
+			k++
+		}
+		// пустой счёт: доходности нет
+		if base := values[i-1].Value + flow; base > 0 {
+			growth *= values[i].Value / base
+		}
+	}
+	return growth - 1
+}
+
+// Annualize converts the return for the period into the annual one.
+func Annualize(r float64, from, to time.Time) float64 {
+	days := to.Sub(from).Hours() / 24
+	if days < 1 || r <= -1 {
+		return r
+	}
+	return math.Pow(1+r, 365/days) - 1
+}
+
+// ExternalFlows returns deposits and withdrawals of the operations.
+func ExternalFlows(operations []dto.Operation) []dto.Flow {
+	var flows []dto.Flow
+	for _, o := range operations {
+		if o.Type == dto.OperationDeposit || o.Type == dto.OperationWithdrawal {
+			flows = append(flows, dto.Flow{Time: o.Time, Amount: o.Payment})
+		}
+	}
+	return flows
+}
+
+// tradePrice returns the price of the trade by its payment: в платеже по облигациям уже есть НКД,
+// а цена указана в процентах от номинала.
+func tradePrice(o dto.Operation) float64 {
+	if o.Quantity > 0 && o.Payment != 0 {
+		return math.Abs(o.Payment) / o.Quantity
+	}
+	return o.Price
+}
+
+// FIFOPnL matches sells with the oldest buys of each instrument. Продажа сверх открытых лотов
+// (шорт) в результат не входит. Дивиденды, налоги и комиссии по инструменту копятся отдельно.
+// Operations must be sorted by time.
+func FIFOPnL(operations []dto.Operation) []dto.PositionPnL {
+	positions := make(map[string]*dto.PositionPnL)
+	var keys []string
+	for _, o := range operations {
+		key := string(o.Isin)
+		if key == "" {
+			key = o.Uid
+		}
+		if key == "" {
+			continue
+		}
+		p, exists := positions[key]
+		if !exists {
+			p = &dto.PositionPnL{Isin: o.Isin, Uid: o.Uid}
+			positions[key] = p
+			keys = append(keys, key)
+		}
+		switch o.Type {
+		case dto.OperationBuy:
+			if o.Quantity <= 0 {
+				continue
+			}
+			price := tradePrice(o)
+			p.Lots = append(p.Lots, dto.Lot{Time: o.Time, Quantity: o.Quantity, Price: price})
+			p.Quantity += o.Quantity
+			p.Cost += o.Quantity * price
+			p.Trades++
+		case dto.OperationSell:
+			price := tradePrice(o)
+			rest := o.Quantity
+			for rest > lotEpsilon && len(p.Lots) > 0 {
+				lot := &p.Lots[0]
+				matched := math.Min(rest, lot.Quantity)
+				p.Realized += matched * (price - lot.Price)
+				p.Cost -= matched * lot.Price
+				p.Quantity -= matched
+				lot.Quantity -= matched
+				rest -= matched
+				if lot.Quantity <= lotEpsilon {
+					p.Lots = p.Lots[1:]
+				}
+			}
+			p.Trades++
+		case dto.OperationDividend, dto.OperationCoupon:
+			p.Dividends += o.Payment
+		case dto.OperationTax:
+			p.Taxes -= o.Payment
+		case dto.OperationFee:
+			p.Fees -= o.Payment
+		}
+	}
+	sort.Strings(keys)
+	pnl := make([]dto.PositionPnL, 0, len(keys))
+	for _, key := range keys {
+		p := positions[key]
+		if p.Quantity < lotEpsilon {
+			p.Quantity, p.Cost = 0, 0
+		}
+		pnl = append(pnl, *p)
+	}
+	return pnl
+}
+
+// PortfolioValues reconstructs the value of the account on the dates from operations and prices:
+// деньги - сумма всех платежей, позиции - купленное минус проданное по цене закрытия дня.
+// Даты, на которые нет цены какой-либо открытой позиции, пропускаются.
+// Operations and dates must be sorted by time.
+func PortfolioValues(operations []dto.Operation, candlesByIsin map[dto.Isin][]dto.Candle, dates []time.Time) []dto.ValuePoint {
+	var values []dto.ValuePoint
+	var cash float64
+	holdings := make(map[dto.Isin]float64)
+	k := 0
+	for _, d := range dates {
+		day := tradingDay(d)
+		for k < len(operations) && !tradingDay(operations[k].Time).After(day) {
+			o := operations[k]
+			cash += o.Payment
+			switch o.Type {
+			case dto.OperationBuy:
+				holdings[o.Isin] += o.Quantity
+			case dto.OperationSell:
+				holdings[o.Isin] -= o.Quantity
+			}
+			k++
+		}
+		value, priced := cash, true
+		for isin, quantity := range holdings {
+			if math.Abs(quantity) < lotEpsilon {
+				continue
+			}
+			price, ok := PriceAt(candlesByIsin[isin], day.Add(24*time.Hour-time.Nanosecond))
+			if !ok {
+				priced = false
+				break
+			}
+			value += quantity * price
+		}
+		if priced {
+			values = append(values, dto.ValuePoint{Time: d, Value: value})
+		}
+	}
+	return values
+}
+
+// Replicate invests the start value and the same flows into one instrument by its prices
+// and returns its value on the dates. Выводы продают часть по цене дня.
+func Replicate(start dto.ValuePoint, flows []dto.Flow, prices []dto.Candle, dates []time.Time) ([]dto.ValuePoint, bool) {
+	priceAt := func(t time.Time) (float64, bool) {
+		return PriceAt(prices, tradingDay(t).Add(24*time.Hour-time.Nanosecond))
+	}
+	price, ok := priceAt(start.Time)
+	if !ok {
+		return nil, false
+	}
+	units := start.Value / price
+	k := 0
+	for k < len(flows) && !tradingDay(flows[k].Time).After(tradingDay(start.Time)) {
+		k++
+	}
+	var values []dto.ValuePoint
+	for _, d := range dates {
+		if d.Before(start.Time) {
+			continue
+		}
+		for k < len(flows) && !tradingDay(flows[k].Time).After(tradingDay(d)) {
+			flowPrice, ok := priceAt(flows[k].Time)
+			if !ok {
+				return nil, false
+			}
+			units += flows[k].Amount / flowPrice
+			k++
+		}
+		price, ok := priceAt(d)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, dto.ValuePoint{Time: d, Value: units * price})
+	}
+	return values, true
+}
+
+// moneyWeighted returns XIRR of the period: стартовая стоимость - вложение в начале,
+// конечная - получение в конце.
+func moneyWeighted(values []dto.ValuePoint, flows []dto.Flow) float64 {
+	first, last := values[0], values[len(values)-1]
+	xirrFlows := []dto.Flow{{Time: first.Time, Amount: -first.Value}}
+	for _, f := range flows {
+		xirrFlows = append(xirrFlows, dto.Flow{Time: f.Time, Amount: -f.Amount})
+	}
+	xirrFlows = append(xirrFlows, dto.Flow{Time: last.Time, Amount: last.Value})
+	r, err := XIRR(xirrFlows)
+	if err != nil {
+		return 0
+	}
+	return r
+}
+
+// Performance calculates returns of the account by its operations and prices in RUB
+// and compares them with the same flows invested into each benchmark. Результат сделок,
+// дивиденды, налоги и комиссии - за всю историю операций, доходности - за период оценки.
+func Performance(operations []dto.Operation, candlesByIsin map[dto.Isin][]dto.Candle, benchmarks []dto.Numeraire) dto.PerformanceReport {
+	var report dto.PerformanceReport
+	operations = append([]dto.Operation(nil), operations...)
+	sort.SliceStable(operations, func(i, j int) bool {
+		return operations[i].Time.Before(operations[j].Time)
+	})
+	report.Positions = FIFOPnL(operations)
+	for _, o := range operations {
+		switch o.Type {
+		case dto.OperationDividend, dto.OperationCoupon:
+			report.Dividends += o.Payment
+		case dto.OperationTax:
+			report.Taxes -= o.Payment
+		case dto.OperationFee:
+			report.Fees -= o.Payment
+		}
+	}
+	for _, p := range report.Positions {
+		report.Realized += p.Realized
+	}
+	if len(operations) == 0 {
+		return report
+	}
+	report.Since = operations[0].Time
+
+	// даты оценки - дни свечей инструментов и альтернатив с первой операции
+	first := tradingDay(operations[0].Time)
+	seen := make(map[time.Time]bool)
+	var dates []time.Time
+	addDates := func(candles []dto.Candle) {
+		for _, c := range candles {
+			if day := tradingDay(c.Time); !day.Before(first) && !seen[day] {
+				seen[day] = true
+				dates = append(dates, day)
+			}
+		}
+	}
+	for _, candles := range candlesByIsin {
+		addDates(candles)
+	}
+	for _, b := range benchmarks {
+		addDates(b.Prices)
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+	values := PortfolioValues(operations, candlesByIsin, dates)
+	if len(values) == 0 {
+		return report
+	}
+	report.Values = values
+	report.From, report.To = values[0].Time, values[len(values)-1].Time
+	report.StartValue, report.EndValue = values[0].Value, values[len(values)-1].Value
+
+	var flows []dto.Flow
+	for _, f := range ExternalFlows(operations) {
+		day := tradingDay(f.Time)
+		if !day.After(tradingDay(report.From)) || day.After(tradingDay(report.To)) {
+			continue
+		}
+		flows = append(flows, f)
+		if f.Amount > 0 {
+			report.Deposits += f.Amount
+		} else {
+			report.Withdrawals -= f.Amount
+		}
+	}
+	report.TWR = TimeWeightedReturn(values, flows)
+	report.TWRAnnual = Annualize(report.TWR, report.From, report.To)
+	report.MWR = moneyWeighted(values, flows)
+
+	for _, b := range benchmarks {
+		if len(b.Prices) == 0 {
+			continue
+		}
+		replicated, ok := Replicate(values[0], flows, b.Prices, dates)
+		if !ok || len(replicated) == 0 {
+			continue
+		}
+		end := replicated[len(replicated)-1].Value
+		report.Baselines = append(report.Baselines, dto.Baseline{
+			Name:       b.Name,
+			EndValue:   end,
+			Return:     TimeWeightedReturn(replicated, flows),
+			MWR:        moneyWeighted(replicated, flows),
+			Difference: report.EndValue - end,
+		})
+	}
+	return report
+}
@@ -0,0 +1,99 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+var day0 = time.Date(2022, 1, 3, 10, 0, 0, 0, time.UTC)
+
+func at(days int) time.Time {
+	return day0.AddDate(0, 0, days)
+}
+
+func TestXIRR(t *testing.T) {
+	tests := []struct {
+		name  string
+		flows []dto.Flow
+		want  float64
+	}{
+		{"one year", []dto.Flow{{Time: at(0), Amount: -100}, {Time: at(365), Amount: 110}}, 0.1},
+		{"two years", []dto.Flow{{Time: at(0), Amount: -1000}, {Time: at(730), Amount: 1210}}, 0.1},
+		// -1000 - 1000/1.1 + 2310/1.21 = 0
+		{"second deposit", []dto.Flow{{Time: at(0), Amount: -1000}, {Time: at(365), Amount: -1000}, {Time: at(730), Amount: 2310}}, 0.1},
+		{"loss", []dto.Flow{{Time: at(0), Amount: -100}, {Time: at(365), Amount: 50}}, -0.5},
+	}
+	for _, tt := range tests {
+		got, err := XIRR(tt.flows)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if !near(got, tt.want) {
+			t.Errorf("%s: XIRR = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := XIRR([]dto.Flow{{Time: at(0), Amount: -100}}); err == nil {
+		t.Error("one flow: expected error")
+	}
+	if _, err := XIRR([]dto.Flow{{Time: at(0), Amount: -100}, {Time: at(365), Amount: -10}}); err == nil {
+		t.Error("flows of one sign: expected error")
+	}
+}
+
+func TestTimeWeightedReturn(t *testing.T) {
+	values := []dto.ValuePoint{{Time: at(0), Value: 100}, {Time: at(1), Value: 110}, {Time: at(2), Value: 231}}
+	// 100 -> 110: +10%, затем 110 + 100 внесённых -> 231: +10%
+	flows := []dto.Flow{{Time: at(2), Amount: 100}}
+	if got := TimeWeightedReturn(values, flows); !near(got, 0.21) {
+		t.Errorf("TimeWeightedReturn = %v, want 0.21", got)
+	}
+	// поток до первой стоимости уже в ней
+	flows = []dto.Flow{{Time: at(0), Amount: 100}}
+	if got := TimeWeightedReturn(values[:2], flows); !near(got, 0.1) {
+		t.Errorf("TimeWeightedReturn with the first day flow = %v, want 0.1", got)
+	}
+}
+
+func TestFIFOPnL(t *testing.T) {
+	operations := []dto.Operation{
+		{Time: at(0), Type: dto.OperationBuy, Isin: "A", Quantity: 10, Price: 50, Payment: -500},
+		{Time: at(1), Type: dto.OperationBuy, Isin: "A", Quantity: 10, Price: 60, Payment: -600},
+		{Time: at(2), Type: dto.OperationDividend, Isin: "A", Payment: 20},
+		{Time: at(2), Type: dto.OperationTax, Isin: "A", Payment: -3},
+		// продаются 10 по 50 и 5 по 60
+		{Time: at(3), Type: dto.OperationSell, Isin: "A", Quantity: 15, Price: 70, Payment: 1050},
+		{Time: at(3), Type: dto.OperationFee, Isin: "A", Payment: -5},
+		{Time: at(4), Type: dto.OperationBuy, Isin: "B", Quantity: 1, Price: 100, Payment: -100},
+	}
+	pnl := FIFOPnL(operations)
+	if len(pnl) != 2 {
+		t.Fatalf("FIFOPnL returned %d positions, want 2", len(pnl))
+	}
+	a := pnl[0]
+	if a.Isin != "A" || !near(a.Realized, 250) || !near(a.Quantity, 5) || !near(a.Cost, 300) ||
+		!near(a.Dividends, 20) || !near(a.Taxes, 3) || !near(a.Fees, 5) || a.Trades != 3 {
+		t.Errorf("FIFOPnL A = %+v", a)
+	}
+	if len(a.Lots) != 1 || !near(a.Lots[0].Quantity, 5) || !near(a.Lots[0].Price, 60) {
+		t.Errorf("FIFOPnL A lots = %+v, want 5 by 60", a.Lots)
+	}
+	if b := pnl[1]; b.Isin != "B" || !near(b.Quantity, 1) || !near(b.Cost, 100) || b.Realized != 0 {
+		t.Errorf("FIFOPnL B = %+v", b)
+	}
+}
+
+func TestFIFOPnLSellOverLots(t *testing.T) {
+	operations := []dto.Operation{
+		{Time: at(0), Type: dto.OperationBuy, Isin: "A", Quantity: 2, Price: 10, Payment: -20},
+		{Time: at(1), Type: dto.OperationSell, Isin: "A", Quantity: 3, Price: 12, Payment: 36},
+	}
+	// проданное сверх открытых лотов в результат не входит
+	p := FIFOPnL(operations)[0]
+	if !near(p.Realized, 4) || p.Quantity != 0 || p.Cost != 0 || len(p.Lots) != 0 {
+		t.Errorf("FIFOPnL = %+v, want realized 4 and no lots", p)
+	}
+}
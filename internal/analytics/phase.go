@@ -0,0 +1,48 @@
+package analytics
+
+import "github.com/tikhomirovv/lazy-investor/internal/dto"
+
+// GetPhase determines the phase of the current trend by the last close and swings.
+func GetPhase(candles []dto.Candle, swings []dto.Swing, trend dto.TrendType) dto.PhaseType {
+	if len(candles) == 0 || len(swings) == 0 {
+		return dto.PhaseRange
+	}
+	price := candles[len(candles)-1].Close
+	last := swings[len(swings)-1]
+	var lastHigh, lastLow float64
+	for i := len(swings) - 1; i >= 0 && (lastHigh == 0 || lastLow == 0); i-- {
+		if swings[i].Type == dto.SwingHigh && lastHigh == 0 {
+			lastHigh = swings[i].Candle.High
+		}
+		if swings[i].Type == dto.SwingLow && lastLow == 0 {
+			lastLow = swings[i].Candle.Low
+		}
+	}
+
+	switch trend {
+	case dto.TrendUp:
+		if lastHigh > 0 && price > lastHigh {
+			return dto.PhaseBreakout
+		}
+		// откат от последнего максимума
+		if last.Type == dto.SwingHigh {
+			return dto.PhaseCorrection
+		}
+		return dto.PhaseMovement
+	case dto.TrendDown:
+		if lastLow > 0 && price < lastLow {
+			return dto.PhaseBreakout
+		}
+		// отскок от последнего минимума
+		if last.Type == dto.SwingLow {
+			return dto.PhaseCorrection
+		}
+		return dto.PhaseMovement
+	default:
+		// выход из боковика
+		if lastHigh > 0 && price > lastHigh || lastLow > 0 && price < lastLow {
+			return dto.PhaseBreakout
+		}
+		return dto.PhaseRange
+	}
+}
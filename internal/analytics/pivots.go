@@ -0,0 +1,84 @@
+package analytics
+
+import (
+	"fmt"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// PivotLevels calculates pivot points from the OHLC of the previous period.
+func PivotLevels(prev dto.Candle, kind dto.PivotType, price float64) ([]dto.Level, error) {
+	h, l, c := prev.High, prev.Low, prev.Close
+	r := h - l
+	values := make(map[string]float64)
+	switch kind {
+	case dto.PivotClassic:
+		p := (h + l + c) / 3
+		values["P"] = p
+		values["R1"], values["S1"] = 2*p-l, 2*p-h
+		values["R2"], values["S2"] = p+r, p-r
+		values["R3"], values["S3"] = h+2*(p-l), l-2*(h-p)
+	case dto.PivotWoodie:
+		p := (h + l + 2*c) / 4
+		values["P"] = p
+		values["R1"], values["S1"] = 2*p-l, 2*p-h
+		values["R2"], values["S2"] = p+r, p-r
+	case dto.PivotCamarilla:
+		values["P"] = (h + l + c) / 3
+		for i, k := range []float64{12, 6, 4, 2} {
+			values[fmt.Sprintf("R%d", i+1)] = c + r*1.1/k
+			values[fmt.Sprintf("S%d", i+1)] = c - r*1.1/k
+		}
+	default:
+		return nil, fmt.Errorf("analytics.PivotLevels: unknown pivot type `%s`", kind)
+	}
+
+	var levels []dto.Level
+	for _, name := range []string{"S4", "S3", "S2", "S1", "P", "R1", "R2", "R3", "R4"} {
+		value, exists := values[name]
+		if !exists {
+			continue
+		}
+		levelType := dto.LevelSupport
+		if value > price {
+			levelType = dto.LevelResistance
+		}
+		levels = append(levels, dto.Level{
+			Name:  fmt.Sprintf("%s %s", kind, name),
+			Type:  levelType,
+			Price: value,
+			Time:  prev.Time,
+		})
+	}
+	return levels, nil
+}
+
+// Pivots calculates pivot points for the current period of the timeframe
+// from the previous completed period of resampled candles.
+func Pivots(candles []dto.Candle, timeframe dto.Timeframe, kind dto.PivotType) ([]dto.Level, error) {
+	resampled := ResampleCandles(candles, timeframe)
+	if len(resampled) < 2 {
+		return nil, nil
+	}
+	levels, err := PivotLevels(resampled[len(resampled)-2], kind, candles[len(candles)-1].Close)
+	// уровни действуют с начала текущего периода
+	for i := range levels {
+		levels[i].Time = resampled[len(resampled)-1].Time
+	}
+	return levels, err
+}
+
+// FindLevelTouches finds candles whose range reaches the levels.
+// `tolerance` is the relative distance from the level (0.01 = 1%).
+func FindLevelTouches(candles []dto.Candle, levels []dto.Level, tolerance float64) []dto.LevelTouch {
+	var touches []dto.LevelTouch
+	for _, c := range candles {
+		for _, l := range levels {
+			delta := l.Price * tolerance
+			if c.Low-delta <= l.Price && c.High+delta >= l.Price && !c.Time.Before(l.Time) {
+				touches = append(touches, dto.LevelTouch{Level: l, Candle: c})
+			}
+		}
+	}
+	return touches
+}
@@ -0,0 +1,160 @@
+package analytics
+
+import (
+	"math"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg"
+)
+
+// Количество торговых дней в году для перевода волатильности в годовую
+const TradingDays = 252
+
+type RegimeOptions struct {
+	Window             int     // окно расчёта показателей, свечей
+	ADXPeriod          int     // 0 - 14
+	ADXTrend           float64 // ADX выше - есть тренд
+	HurstTrend         float64 // показатель Херста выше - трендовость
+	HurstMeanReversion float64 // показатель Херста ниже - возврат к среднему
+	VarianceRatioLag   int
+	MaxVolatility      float64 // годовая волатильность выше - волатильный режим
+	HMMStates          int     // 0 - без HMM
+	HMMIterations      int
+}
+
+// LogReturns calculates logarithmic close-to-close returns of candles.
+func LogReturns(candles []dto.Candle) []float64 {
+	if len(candles) < 2 {
+		return nil
+	}
+	returns := make([]float64, 0, len(candles)-1)
+	for i := 1; i < len(candles); i++ {
+		if candles[i-1].Close <= 0 || candles[i].Close <= 0 {
+			returns = append(returns, 0)
+			continue
+		}
+		returns = append(returns, math.Log(candles[i].Close/candles[i-1].Close))
+	}
+	return returns
+}
+
+// RealizedVolatility calculates the annualized standard deviation of daily returns.
+func RealizedVolatility(returns []float64) float64 {
+	if len(returns) == 0 {
+		return 0
+	}
+	return pkg.StandardDeviation(returns) * math.Sqrt(TradingDays)
+}
+
+// HurstExponent estimates the Hurst exponent of returns by rescaled range analysis.
+// H > 0.5 - трендовый ряд, H < 0.5 - возврат к среднему.
+func HurstExponent(returns []float64) float64 {
+	var logSizes, logRS []float64
+	for size := 8; size <= len(returns)/2; size *= 2 {
+		var rsSum float64
+		var chunks int
+		for start := 0; start+size <= len(returns); start += size {
+			chunk := returns[start : start+size]
+			mean := pkg.Average(chunk)
+			var cum, min, max float64
+			for _, r := range chunk {
+				cum += r - mean
+				min = math.Min(min, cum)
+				max = math.Max(max, cum)
+			}
+			sd := pkg.StandardDeviation(chunk)
+			if sd == 0 {
+				continue
+			}
+			rsSum += (max - min) / sd
+			chunks++
+		}
+		if chunks == 0 {
+			continue
+		}
+		logSizes = append(logSizes, math.Log(float64(size)))
+		logRS = append(logRS, math.Log(rsSum/float64(chunks)))
+	}
+	if len(logSizes) < 2 {
+		return 0.5
+	}
+	// наклон регрессии log(R/S) на log(n)
+	return pkg.Covariance(logSizes, logRS) / pkg.Covariance(logSizes, logSizes)
+}
+
+// VarianceRatio calculates the ratio of the variance of `lag`-period returns
+// to `lag` variances of one-period returns. VR > 1 - трендовость, VR < 1 - возврат к среднему.
+func VarianceRatio(returns []float64, lag int) float64 {
+	if lag < 2 || len(returns) <= lag {
+		return 1
+	}
+	var long []float64
+	for i := lag; i <= len(returns); i++ {
+		var sum float64
+		for _, r := range returns[i-lag : i] {
+			sum += r
+		}
+		long = append(long, sum)
+	}
+	variance := math.Pow(pkg.StandardDeviation(returns), 2)
+	if variance == 0 {
+		return 1
+	}
+	return math.Pow(pkg.StandardDeviation(long), 2) / (float64(lag) * variance)
+}
+
+// DetectRegimes labels the regime of each candle by the indicators over the previous window.
+// С HMM волатильным считается состояние с наибольшей дисперсией. Модель обучается
+// на всём ряде, поэтому для бэктестов её лучше не включать.
+func DetectRegimes(candles []dto.Candle, opts RegimeOptions) []dto.Regime {
+	if opts.Window < 1 {
+		opts.Window = 1
+	}
+	if opts.ADXPeriod < 1 {
+		opts.ADXPeriod = 14
+	}
+	regimes := make([]dto.Regime, len(candles))
+	returns := LogReturns(candles)
+	adx := CalculateADX(candles, opts.ADXPeriod)
+
+	var states []int
+	volatileState := -1
+	if opts.HMMStates > 1 && len(returns) > opts.HMMStates {
+		hmm := FitHMM(returns, opts.HMMStates, opts.HMMIterations)
+		states = hmm.Decode(returns)
+		volatileState = 0
+		for i, v := range hmm.Variances {
+			if v > hmm.Variances[volatileState] {
+				volatileState = i
+			}
+		}
+	}
+
+	for i, c := range candles {
+		regimes[i] = dto.Regime{Time: c.Time, Type: dto.RegimeUnknown}
+		if i < opts.Window {
+			continue
+		}
+		// доходность returns[j] получена на свече j+1
+		window := returns[i-opts.Window : i]
+		r := &regimes[i]
+		r.Volatility = RealizedVolatility(window)
+		r.Hurst = HurstExponent(window)
+		r.VarianceRatio = VarianceRatio(window, opts.VarianceRatioLag)
+		r.ADX = adx.Values[i]
+
+		isVolatile := r.Volatility > opts.MaxVolatility
+		if states != nil {
+			isVolatile = states[i-1] == volatileState
+		}
+		switch {
+		case isVolatile:
+			r.Type = dto.RegimeVolatile
+		case r.ADX >= opts.ADXTrend || r.Hurst > opts.HurstTrend && r.VarianceRatio > 1:
+			r.Type = dto.RegimeTrending
+		case r.Hurst < opts.HurstMeanReversion || r.VarianceRatio < 1:
+			r.Type = dto.RegimeMeanReverting
+		}
+	}
+	return regimes
+}
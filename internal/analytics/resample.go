@@ -0,0 +1,42 @@
+package analytics
+
+import (
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// ResampleCandles aggregates daily candles into candles of the larger timeframe.
+func ResampleCandles(candles []dto.Candle, timeframe dto.Timeframe) []dto.Candle {
+	if timeframe == dto.TimeframeDay {
+		return candles
+	}
+	key := func(t time.Time) int {
+		if timeframe == dto.TimeframeWeek {
+			year, week := t.UTC().ISOWeek()
+			return year*100 + week
+		}
+		return t.UTC().Year()*100 + int(t.UTC().Month())
+	}
+	var result []dto.Candle
+	lastKey := -1
+	for _, c := range candles {
+		k := key(c.Time)
+		if k != lastKey {
+			result = append(result, c)
+			lastKey = k
+			continue
+		}
+		last := &result[len(result)-1]
+		if c.High > last.High {
+			last.High = c.High
+		}
+		if c.Low < last.Low {
+			last.Low = c.Low
+		}
+		last.Close = c.Close
+		last.Volume += c.Volume
+		last.IsComplete = c.IsComplete
+	}
+	return result
+}
@@ -0,0 +1,233 @@
+package analytics
+
+import (
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// Инкрементальные версии расчётов: состояние хранится внутри, каждая новая свеча
+// обрабатывается за O(период), а результат совпадает с расчётом по всему слайсу.
+// Свечи должны подаваться по порядку, поэтому будущие данные недоступны.
+
+// SwingStream finds swings incrementally. A swing is confirmed `n` candles after it.
+type SwingStream struct {
+	n      int
+	buffer []dto.Candle
+}
+
+func NewSwingStream(n int) *SwingStream {
+	return &SwingStream{n: n, buffer: make([]dto.Candle, 0, 2*n+1)}
+}
+
+// Update adds the candle and returns the newly confirmed swings.
+func (s *SwingStream) Update(candle dto.Candle) []dto.Swing {
+	if len(s.buffer) == 2*s.n+1 {
+		copy(s.buffer, s.buffer[1:])
+		s.buffer = s.buffer[:2*s.n]
+	}
+	s.buffer = append(s.buffer, candle)
+	if len(s.buffer) < 2*s.n+1 {
+		return nil
+	}
+	if swing, ok := swingAt(s.buffer, s.n, s.n); ok {
+		return []dto.Swing{swing}
+	}
+	return nil
+}
+
+// TrendStream detects trend changes incrementally by swings of period `n`.
+type TrendStream struct {
+	swings  *SwingStream
+	tracker *trendTracker
+}
+
+func NewTrendStream(n int) *TrendStream {
+	return &TrendStream{swings: NewSwingStream(n), tracker: newTrendTracker()}
+}
+
+// Update adds the candle and returns the trend changes on the newly confirmed swings.
+func (s *TrendStream) Update(candle dto.Candle) []dto.TrendChange {
+	var changes []dto.TrendChange
+	for _, swing := range s.swings.Update(candle) {
+		if tc, changed := s.tracker.add(swing); changed {
+			changes = append(changes, tc)
+		}
+	}
+	return changes
+}
+
+// Trend returns the current trend.
+func (s *TrendStream) Trend() dto.TrendType {
+	return s.tracker.currentTrend
+}
+
+// MovingAverageStream calculates the moving average like CalculateMovingAverage.
+type MovingAverageStream struct {
+	period int
+	window []float64
+	next   int
+	sum    float64
+}
+
+func NewMovingAverageStream(period int) *MovingAverageStream {
+	if period < 1 {
+		period = 1
+	}
+	return &MovingAverageStream{period: period, window: make([]float64, 0, period)}
+}
+
+// Update adds the candle and returns the current value of the average.
+func (s *MovingAverageStream) Update(candle dto.Candle) float64 {
+	s.sum += candle.Close
+	if len(s.window) < s.period {
+		s.window = append(s.window, candle.Close)
+		return s.sum / float64(len(s.window))
+	}
+	s.sum -= s.window[s.next]
+	s.window[s.next] = candle.Close
+	s.next = (s.next + 1) % s.period
+	return s.sum / float64(s.period)
+}
+
+// ATRStream calculates the Average True Range like CalculateATR.
+type ATRStream struct {
+	period    int
+	count     int
+	sum       float64
+	atr       float64
+	prevClose float64
+}
+
+func NewATRStream(period int) *ATRStream {
+	if period < 1 {
+		period = 1
+	}
+	return &ATRStream{period: period}
+}
+
+// Update adds the candle and returns the current ATR.
+func (s *ATRStream) Update(candle dto.Candle) float64 {
+	tr := candle.High - candle.Low
+	if s.count > 0 {
+		tr = TrueRange(candle, s.prevClose)
+	}
+	if s.count < s.period {
+		s.sum += tr
+		s.atr = s.sum / float64(s.count+1)
+	} else {
+		s.atr = (s.atr*float64(s.period-1) + tr) / float64(s.period)
+	}
+	s.count++
+	s.prevClose = candle.Close
+	return s.atr
+}
+
+// Value returns the ATR after the last candle.
+func (s *ATRStream) Value() float64 {
+	return s.atr
+}
+
+// ZigZagStream calculates ZigZag points like CalculateZigZag.
+type ZigZagStream struct {
+	threshold float64
+	started   bool
+	lastPivot dto.ZigZagPoint
+	direction string
+}
+
+func NewZigZagStream(threshold float64) *ZigZagStream {
+	return &ZigZagStream{threshold: threshold}
+}
+
+// Update adds the candle and returns the new ZigZag point if it appeared.
+func (s *ZigZagStream) Update(candle dto.Candle) []dto.ZigZagPoint {
+	if !s.started {
+		s.started = true
+		s.lastPivot = dto.ZigZagPoint{Candle: candle, Type: dto.ZigZagHigh, Price: candle.Close}
+		return []dto.ZigZagPoint{s.lastPivot}
+	}
+
+	priceChangeHigh := (candle.High - s.lastPivot.Price) / s.lastPivot.Price
+	priceChangeLow := (candle.Low - s.lastPivot.Price) / s.lastPivot.Price
+
+	if s.direction == "" || s.direction == "down" && priceChangeHigh >= s.threshold {
+		s.lastPivot = dto.ZigZagPoint{Candle: candle, Type: dto.ZigZagHigh, Price: candle.High}
+		s.direction = "up"
+		return []dto.ZigZagPoint{s.lastPivot}
+	} else if s.direction == "up" && priceChangeLow <= -s.threshold {
+		s.lastPivot = dto.ZigZagPoint{Candle: candle, Type: dto.ZigZagLow, Price: candle.Low}
+		s.direction = "down"
+		return []dto.ZigZagPoint{s.lastPivot}
+	}
+	return nil
+}
+
+type StreamOptions struct {
+	SwingPeriod     int
+	MAPeriods       []int
+	ATRPeriod       int
+	ZigZagThreshold float64
+}
+
+// События, появившиеся на свече
+type StreamEvents struct {
+	Time           time.Time
+	Swings         []dto.Swing
+	TrendChanges   []dto.TrendChange
+	ZigZags        []dto.ZigZagPoint
+	MovingAverages []float64 // по периодам из настроек
+	ATR            float64
+}
+
+// StreamEngine keeps all incremental calculations of one instrument.
+type StreamEngine struct {
+	swings   *SwingStream
+	trend    *trendTracker
+	averages []*MovingAverageStream
+	atr      *ATRStream
+	zigzag   *ZigZagStream
+	lastTime time.Time
+}
+
+func NewStreamEngine(opts StreamOptions) *StreamEngine {
+	e := &StreamEngine{
+		swings: NewSwingStream(opts.SwingPeriod),
+		trend:  newTrendTracker(),
+		atr:    NewATRStream(opts.ATRPeriod),
+		zigzag: NewZigZagStream(opts.ZigZagThreshold),
+	}
+	for _, p := range opts.MAPeriods {
+		e.averages = append(e.averages, NewMovingAverageStream(p))
+	}
+	return e
+}
+
+// Update processes the next complete candle. Incomplete candles and candles
+// not newer than the previous one are ignored, so the state never repaints.
+func (e *StreamEngine) Update(candle dto.Candle) (StreamEvents, bool) {
+	if !candle.IsComplete || !candle.Time.After(e.lastTime) {
+		return StreamEvents{}, false
+	}
+	e.lastTime = candle.Time
+	events := StreamEvents{
+		Time:    candle.Time,
+		Swings:  e.swings.Update(candle),
+		ZigZags: e.zigzag.Update(candle),
+		ATR:     e.atr.Update(candle),
+	}
+	for _, swing := range events.Swings {
+		if tc, changed := e.trend.add(swing); changed {
+			events.TrendChanges = append(events.TrendChanges, tc)
+		}
+	}
+	for _, ma := range e.averages {
+		events.MovingAverages = append(events.MovingAverages, ma.Update(candle))
+	}
+	return events, true
+}
+
+// Trend returns the current trend.
+func (e *StreamEngine) Trend() dto.TrendType {
+	return e.trend.currentTrend
+}
@@ -16,31 +16,40 @@ import (
 func FindSwings(candles []dto.Candle, n int) []dto.Swing {
 	var swings []dto.Swing
 	for i := n; i < len(candles)-n; i++ {
-		isSwingHigh := true
-		isSwingLow := true
-		for j := -n; j <= n; j++ {
-			if j != 0 {
-				if candles[i].High <= candles[i+j].High {
-					isSwingHigh = false
-				}
-				if candles[i].Low >= candles[i+j].Low {
-					isSwingLow = false
-				}
-			}
+		if swing, ok := swingAt(candles, i, n); ok {
+			swings = append(swings, swing)
 		}
-		if isSwingHigh || isSwingLow {
-			swing := dto.Swing{
-				Candle: candles[i],
-				Period: n,
-			}
-			if isSwingHigh {
-				swing.Type = dto.SwingHigh
+	}
+	return swings
+}
+
+// swingAt checks whether the candle `i` is a swing of period `n`.
+// Свечи с обеих сторон от `i` должны быть в слайсе.
+func swingAt(candles []dto.Candle, i int, n int) (dto.Swing, bool) {
+	isSwingHigh := true
+	isSwingLow := true
+	for j := -n; j <= n; j++ {
+		if j != 0 {
+			if candles[i].High <= candles[i+j].High {
+				isSwingHigh = false
 			}
-			if isSwingLow {
-				swing.Type = dto.SwingLow
+			if candles[i].Low >= candles[i+j].Low {
+				isSwingLow = false
 			}
-			swings = append(swings, swing)
 		}
 	}
-	return swings
+	if !isSwingHigh && !isSwingLow {
+		return dto.Swing{}, false
+	}
+	swing := dto.Swing{
+		Candle: candles[i],
+		Period: n,
+	}
+	if isSwingHigh {
+		swing.Type = dto.SwingHigh
+	}
+	if isSwingLow {
+		swing.Type = dto.SwingLow
+	}
+	return swing, true
 }
@@ -0,0 +1,157 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// HeikinAshi converts candles to Heikin-Ashi candles.
+func HeikinAshi(candles []dto.Candle) []dto.Candle {
+	result := make([]dto.Candle, len(candles))
+	for i, c := range candles {
+		ha := c
+		ha.Close = (c.Open + c.High + c.Low + c.Close) / 4
+		if i == 0 {
+			ha.Open = (c.Open + c.Close) / 2
+		} else {
+			ha.Open = (result[i-1].Open + result[i-1].Close) / 2
+		}
+		ha.High = math.Max(c.High, math.Max(ha.Open, ha.Close))
+		ha.Low = math.Min(c.Low, math.Min(ha.Open, ha.Close))
+		result[i] = ha
+	}
+	return result
+}
+
+// Renko builds Renko bricks of the fixed size by close prices.
+// Разворот требует движения на два кирпича. Время кирпича - время свечи, на которой он сформирован;
+// следующие кирпичи той же свечи сдвигаются на секунду, чтобы время было уникальным.
+func Renko(candles []dto.Candle, brick float64) []dto.Candle {
+	if len(candles) == 0 || brick <= 0 {
+		return nil
+	}
+	var bricks []dto.Candle
+	base := candles[0].Close
+	direction := 0
+	var volume int64
+	add := func(open, close float64, c dto.Candle) {
+		bricks = append(bricks, dto.Candle{
+			Open:       open,
+			Close:      close,
+			High:       math.Max(open, close),
+			Low:        math.Min(open, close),
+			Volume:     volume,
+			Time:       c.Time,
+			IsComplete: true,
+		})
+		volume = 0
+	}
+	for _, c := range candles[1:] {
+		volume += c.Volume
+		for direction >= 0 && c.Close >= base+brick {
+			add(base, base+brick, c)
+			base += brick
+			direction = 1
+		}
+		for direction <= 0 && c.Close <= base-brick {
+			add(base, base-brick, c)
+			base -= brick
+			direction = -1
+		}
+		// разворот: от открытия последнего кирпича на кирпич в обратную сторону
+		if direction > 0 && c.Close <= base-2*brick {
+			base -= brick
+			for c.Close <= base-brick {
+				add(base, base-brick, c)
+				base -= brick
+			}
+			direction = -1
+		}
+		if direction < 0 && c.Close >= base+2*brick {
+			base += brick
+			for c.Close >= base+brick {
+				add(base, base+brick, c)
+				base += brick
+			}
+			direction = 1
+		}
+	}
+	return uniqueTimes(bricks)
+}
+
+// RangeBars builds bars with High - Low equal to `size`.
+// Внутридневной путь цены неизвестен, поэтому принимается: растущая свеча идёт
+// Open -> Low -> High -> Close, падающая - Open -> High -> Low -> Close.
+// Бары одной свечи получают время свечи со сдвигом на секунду.
+func RangeBars(candles []dto.Candle, size float64) []dto.Candle {
+	if len(candles) == 0 || size <= 0 {
+		return nil
+	}
+	var bars []dto.Candle
+	open := candles[0].Open
+	bar := dto.Candle{Open: open, High: open, Low: open, Close: open, Time: candles[0].Time}
+	feed := func(price float64, c dto.Candle) {
+		for price > bar.Low+size || price < bar.High-size {
+			if price > bar.Low+size {
+				bar.High = bar.Low + size
+				bar.Close = bar.High
+			} else {
+				bar.Low = bar.High - size
+				bar.Close = bar.Low
+			}
+			bar.IsComplete = true
+			bars = append(bars, bar)
+			bar = dto.Candle{Open: bar.Close, High: bar.Close, Low: bar.Close, Close: bar.Close, Time: c.Time}
+		}
+		bar.High = math.Max(bar.High, price)
+		bar.Low = math.Min(bar.Low, price)
+		bar.Close = price
+	}
+	for _, c := range candles {
+		bar.Time = c.Time
+		bar.Volume += c.Volume
+		path := []float64{c.Open, c.High, c.Low, c.Close}
+		if c.Close >= c.Open {
+			path = []float64{c.Open, c.Low, c.High, c.Close}
+		}
+		for _, price := range path {
+			feed(price, c)
+		}
+	}
+	return uniqueTimes(append(bars, bar))
+}
+
+// uniqueTimes shifts the times of bars formed on the same candle so that they grow strictly:
+// время используется как ключ при выравнивании свечей и поиске дивергенций.
+func uniqueTimes(bars []dto.Candle) []dto.Candle {
+	for i := 1; i < len(bars); i++ {
+		if !bars[i].Time.After(bars[i-1].Time) {
+			bars[i].Time = bars[i-1].Time.Add(time.Second)
+		}
+	}
+	return bars
+}
+
+// TransformCandles converts candles to the given representation.
+// Если `size` не задан, размер кирпича или бара берётся по последнему ATR.
+func TransformCandles(candles []dto.Candle, transform dto.CandleTransform, size float64, atrPeriod int) ([]dto.Candle, error) {
+	if size <= 0 && len(candles) > 0 && atrPeriod > 0 {
+		atr := CalculateATR(candles, atrPeriod)
+		size = atr[len(atr)-1]
+	}
+	switch transform {
+	case dto.TransformNone, "":
+		return candles, nil
+	case dto.TransformHeikinAshi:
+		return HeikinAshi(candles), nil
+	case dto.TransformRenko:
+		return Renko(candles, size), nil
+	case dto.TransformRange:
+		return RangeBars(candles, size), nil
+	default:
+		return nil, fmt.Errorf("analytics.TransformCandles: unknown transform `%s`", transform)
+	}
+}
@@ -4,66 +4,81 @@ import "github.com/tikhomirovv/lazy-investor/internal/dto"
 
 func GetTrends(swings []dto.Swing) (dto.TrendType, []dto.TrendChange) {
 	var trendChanges []dto.TrendChange
-	var currentTrend dto.TrendType = dto.TrendNo
-	var prevHigh, lastHigh, prevLow, lastLow float64
-	addTrendChange := func(trend dto.TrendType, swing dto.Swing) {
-		trendChanges = append(trendChanges, dto.TrendChange{
+	tracker := newTrendTracker()
+	for _, swing := range swings {
+		if tc, changed := tracker.add(swing); changed {
+			trendChanges = append(trendChanges, tc)
+		}
+	}
+	return tracker.currentTrend, trendChanges
+}
+
+// Состояние определения тренда по последовательности свингов
+type trendTracker struct {
+	currentTrend                         dto.TrendType
+	prevHigh, lastHigh, prevLow, lastLow float64
+}
+
+func newTrendTracker() *trendTracker {
+	return &trendTracker{currentTrend: dto.TrendNo}
+}
+
+// add processes the next swing and returns the trend change if it happened.
+func (t *trendTracker) add(swing dto.Swing) (dto.TrendChange, bool) {
+	change := func(trend dto.TrendType) (dto.TrendChange, bool) {
+		t.currentTrend = trend
+		return dto.TrendChange{
 			Swing: swing,
 			Trend: trend,
-		})
+		}, true
+	}
+	if swing.Type == dto.SwingHigh {
+		// UpTrend
+		// if swing.Candle.High > lastHigh && prevLow > lastLow {
+		// 	// change?
+		// 	if currentTrend != dto.TrendUp {
+		// 		currentTrend = dto.TrendUp
+		// 		addTrendChange(currentTrend, swing)
+		// 	}
+		// } else if currentTrend == dto.TrendUp {
+		// 	// no trend
+		// 	// if currentTrend != dto.TrendNo {
+		// 	currentTrend = dto.TrendNo
+		// 	addTrendChange(currentTrend, swing)
+		// 	// }
+		// }
+		t.prevHigh = t.lastHigh
+		t.lastHigh = swing.Candle.High
+	} else {
+		// DownTrend
+		// if swing.Candle.Low < lastLow && prevHigh < lastHigh {
+		// 	// change?
+		// 	if currentTrend != dto.TrendDown {
+		// 		currentTrend = dto.TrendDown
+		// 		addTrendChange(currentTrend, swing)
+		// 	}
+		// } else if currentTrend == dto.TrendDown {
+		// 	// no trend
+		// 	// if currentTrend != dto.TrendNo {
+		// 	currentTrend = dto.TrendNo
+		// 	addTrendChange(currentTrend, swing)
+		// 	// }
+		// }
+		t.prevLow = t.lastLow
+		t.lastLow = swing.Candle.Low
 	}
-	for _, swing := range swings {
-		if swing.Type == dto.SwingHigh {
-			// UpTrend
-			// if swing.Candle.High > lastHigh && prevLow > lastLow {
-			// 	// change?
-			// 	if currentTrend != dto.TrendUp {
-			// 		currentTrend = dto.TrendUp
-			// 		addTrendChange(currentTrend, swing)
-			// 	}
-			// } else if currentTrend == dto.TrendUp {
-			// 	// no trend
-			// 	// if currentTrend != dto.TrendNo {
-			// 	currentTrend = dto.TrendNo
-			// 	addTrendChange(currentTrend, swing)
-			// 	// }
-			// }
-			prevHigh = lastHigh
-			lastHigh = swing.Candle.High
-		} else {
-			// DownTrend
-			// if swing.Candle.Low < lastLow && prevHigh < lastHigh {
-			// 	// change?
-			// 	if currentTrend != dto.TrendDown {
-			// 		currentTrend = dto.TrendDown
-			// 		addTrendChange(currentTrend, swing)
-			// 	}
-			// } else if currentTrend == dto.TrendDown {
-			// 	// no trend
-			// 	// if currentTrend != dto.TrendNo {
-			// 	currentTrend = dto.TrendNo
-			// 	addTrendChange(currentTrend, swing)
-			// 	// }
-			// }
-			prevLow = lastLow
-			lastLow = swing.Candle.Low
-		}
 
-		// uptrend
-		if lastHigh > prevHigh && lastLow > prevLow {
-			if currentTrend != dto.TrendUp {
-				currentTrend = dto.TrendUp
-				addTrendChange(currentTrend, swing)
-			}
-		} else if lastLow < prevLow && lastHigh < prevHigh {
-			if currentTrend != dto.TrendDown {
-				currentTrend = dto.TrendDown
-				addTrendChange(currentTrend, swing)
-			}
-		} else if currentTrend != dto.TrendNo {
-			currentTrend = dto.TrendNo
-			addTrendChange(currentTrend, swing)
+	// uptrend
+	if t.lastHigh > t.prevHigh && t.lastLow > t.prevLow {
+		if t.currentTrend != dto.TrendUp {
+			return change(dto.TrendUp)
+		}
+	} else if t.lastLow < t.prevLow && t.lastHigh < t.prevHigh {
+		if t.currentTrend != dto.TrendDown {
+			return change(dto.TrendDown)
 		}
+	} else if t.currentTrend != dto.TrendNo {
+		return change(dto.TrendNo)
 	}
-	return currentTrend, trendChanges
+	return dto.TrendChange{}, false
 }
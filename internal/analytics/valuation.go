@@ -0,0 +1,49 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// PriceAt returns the close of the last candle not later than `t`. Candles must be sorted by time.
+func PriceAt(candles []dto.Candle, t time.Time) (float64, bool) {
+	i := sort.Search(len(candles), func(i int) bool {
+		return candles[i].Time.After(t)
+	})
+	if i == 0 || candles[i-1].Close <= 0 {
+		return 0, false
+	}
+	return candles[i-1].Close, true
+}
+
+// ToNumeraire converts the amount in RUB into units of the numeraire at `t`.
+func ToNumeraire(rub float64, numeraire dto.Numeraire, t time.Time) (float64, bool) {
+	if len(numeraire.Prices) == 0 {
+		return rub, true
+	}
+	price, ok := PriceAt(numeraire.Prices, t)
+	if !ok {
+		return 0, false
+	}
+	return rub / price, true
+}
+
+// ConvertCandles converts prices of the candles by the exchange rate on their dates.
+// Свечи, для которых курса ещё нет, отбрасываются.
+func ConvertCandles(candles []dto.Candle, rates []dto.Candle) []dto.Candle {
+	converted := make([]dto.Candle, 0, len(candles))
+	for _, c := range candles {
+		rate, ok := PriceAt(rates, c.Time)
+		if !ok {
+			continue
+		}
+		c.Open *= rate
+		c.High *= rate
+		c.Low *= rate
+		c.Close *= rate
+		converted = append(converted, c)
+	}
+	return converted
+}
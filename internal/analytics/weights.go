@@ -0,0 +1,194 @@
+package analytics
+
+import (
+	"math"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// Веса портфеля без плеча и шортов: неотрицательные, в сумме 1.
+
+// EqualWeights splits the portfolio equally.
+func EqualWeights(isins []dto.Isin) map[dto.Isin]float64 {
+	weights := make(map[dto.Isin]float64, len(isins))
+	for _, isin := range isins {
+		weights[isin] = 1 / float64(len(isins))
+	}
+	return weights
+}
+
+// NormalizeWeights keeps only positive weights of the instruments and scales them to the sum of 1.
+func NormalizeWeights(weights map[dto.Isin]float64, isins []dto.Isin) map[dto.Isin]float64 {
+	var sum float64
+	for _, isin := range isins {
+		if w := weights[isin]; w > 0 {
+			sum += w
+		}
+	}
+	normalized := make(map[dto.Isin]float64, len(isins))
+	if sum <= 0 {
+		return normalized
+	}
+	for _, isin := range isins {
+		if w := weights[isin]; w > 0 {
+			normalized[isin] = w / sum
+		}
+	}
+	return normalized
+}
+
+func toWeights(isins []dto.Isin, w []float64) map[dto.Isin]float64 {
+	weights := make(map[dto.Isin]float64, len(isins))
+	for i, isin := range isins {
+		weights[isin] = w[i]
+	}
+	return weights
+}
+
+// InverseVolatilityWeights weights instruments by 1 / volatility from the covariance matrix.
+// Инструменты без волатильности получают нулевой вес.
+func InverseVolatilityWeights(cov dto.Matrix) map[dto.Isin]float64 {
+	w := make([]float64, len(cov.Isins))
+	var sum float64
+	for i := range cov.Isins {
+		if v := cov.Values[i][i]; v > 1e-12 {
+			w[i] = 1 / math.Sqrt(v)
+			sum += w[i]
+		}
+	}
+	for i := range w {
+		if sum > 0 {
+			w[i] /= sum
+		}
+	}
+	return toWeights(cov.Isins, w)
+}
+
+// RiskParityWeights makes risk contributions w_i * (Σw)_i of all instruments equal.
+// Решается циклическим покоординатным спуском для min ½y'Σy - Σ ln(y_i) с нормировкой в конце.
+func RiskParityWeights(cov dto.Matrix) map[dto.Isin]float64 {
+	n := len(cov.Isins)
+	sigma := cov.Values
+	for i := 0; i < n; i++ {
+		// вырожденная матрица: риск не посчитать
+		if sigma[i][i] <= 1e-12 {
+			return InverseVolatilityWeights(cov)
+		}
+	}
+	y := make([]float64, n)
+	for i := range y {
+		y[i] = 1 / math.Sqrt(sigma[i][i])
+	}
+	for iter := 0; iter < 1000; iter++ {
+		var change float64
+		for i := 0; i < n; i++ {
+			var c float64
+			for j := 0; j < n; j++ {
+				if j != i {
+					c += sigma[i][j] * y[j]
+				}
+			}
+			next := (-c + math.Sqrt(c*c+4*sigma[i][i])) / (2 * sigma[i][i])
+			change = math.Max(change, math.Abs(next-y[i])/y[i])
+			y[i] = next
+		}
+		if change < 1e-10 {
+			break
+		}
+	}
+	var sum float64
+	for _, v := range y {
+		sum += v
+	}
+	for i := range y {
+		y[i] /= sum
+	}
+	return toWeights(cov.Isins, y)
+}
+
+// MinVarianceWeights returns the long-only portfolio with the minimal variance.
+func MinVarianceWeights(cov dto.Matrix) map[dto.Isin]float64 {
+	n := len(cov.Isins)
+	lo, hi := make([]float64, n), make([]float64, n)
+	for i := range hi {
+		hi[i] = 1
+	}
+	return toWeights(cov.Isins, minimizeQuadratic(cov.Values, make([]float64, n), lo, hi))
+}
+
+// minimizeQuadratic minimizes w'Σw - c'w over weights lo <= w <= hi with the sum of 1
+// by the projected gradient descent. Задача выпуклая, поэтому спуск сходится к минимуму.
+func minimizeQuadratic(sigma [][]float64, c, lo, hi []float64) []float64 {
+	n := len(c)
+	w := projectBox(make([]float64, n), lo, hi)
+	if n == 0 {
+		return w
+	}
+	// шаг 1/L, L - оценка сверху константы Липшица градиента через сумму модулей строки
+	var l float64
+	for i := range sigma {
+		var row float64
+		for j := range sigma[i] {
+			row += math.Abs(sigma[i][j])
+		}
+		l = math.Max(l, 2*row)
+	}
+	l = math.Max(l, 1e-12)
+	grad := make([]float64, n)
+	next := make([]float64, n)
+	for iter := 0; iter < 20000; iter++ {
+		for i := 0; i < n; i++ {
+			var s float64
+			for j := 0; j < n; j++ {
+				s += sigma[i][j] * w[j]
+			}
+			grad[i] = 2*s - c[i]
+		}
+		for i := range w {
+			next[i] = w[i] - grad[i]/l
+		}
+		projected := projectBox(next, lo, hi)
+		var change float64
+		for i := range w {
+			change = math.Max(change, math.Abs(projected[i]-w[i]))
+		}
+		w = projected
+		if change < 1e-12 {
+			break
+		}
+	}
+	return w
+}
+
+// projectBox returns the closest point to v with lo <= w <= hi and the sum of 1.
+// Сдвиг θ в w = clip(v - θ) подбирается делением отрезка пополам: сумма монотонна по θ.
+// Если ограничения несовместны, сумма будет ближайшей к 1 из возможных.
+func projectBox(v, lo, hi []float64) []float64 {
+	clip := func(theta float64) ([]float64, float64) {
+		w := make([]float64, len(v))
+		var sum float64
+		for i := range v {
+			w[i] = math.Min(hi[i], math.Max(lo[i], v[i]-theta))
+			sum += w[i]
+		}
+		return w, sum
+	}
+	if len(v) == 0 {
+		return nil
+	}
+	left, right := math.Inf(1), math.Inf(-1)
+	for i := range v {
+		left = math.Min(left, v[i]-hi[i])
+		right = math.Max(right, v[i]-lo[i])
+	}
+	for iter := 0; iter < 100; iter++ {
+		mid := (left + right) / 2
+		if _, sum := clip(mid); sum > 1 {
+			left = mid
+		} else {
+			right = mid
+		}
+	}
+	w, _ := clip((left + right) / 2)
+	return w
+}
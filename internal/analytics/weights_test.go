@@ -0,0 +1,60 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestMinimizeQuadratic(t *testing.T) {
+	// минимум дисперсии двух активов: w1 = (σ2² - σ12) / (σ1² + σ2² - 2σ12)
+	minVariance := func(s11, s22, s12 float64) float64 {
+		return (s22 - s12) / (s11 + s22 - 2*s12)
+	}
+	tests := []struct {
+		name          string
+		s11, s22, s12 float64
+		lo, hi        float64
+		want          float64
+	}{
+		{"inside the box", 0.04, 0.09, 0.015, 0, 1, minVariance(0.04, 0.09, 0.015)},
+		{"negative correlation", 0.01, 0.01, -0.005, 0, 1, 0.5},
+		{"short allowed", 0.04, 0.01, 0.018, -1, 2, minVariance(0.04, 0.01, 0.018)},
+		{"long only clips to zero", 0.04, 0.01, 0.018, 0, 1, 0},
+		{"capped by max weight", 0.04, 0.09, 0.015, 0, 0.6, 0.6},
+	}
+	for _, tt := range tests {
+		sigma := [][]float64{{tt.s11, tt.s12}, {tt.s12, tt.s22}}
+		w := minimizeQuadratic(sigma, []float64{0, 0}, []float64{tt.lo, tt.lo}, []float64{tt.hi, tt.hi})
+		if !near(w[0], tt.want) || !near(w[0]+w[1], 1) {
+			t.Errorf("%s: weights %v, want %v and %v", tt.name, w, tt.want, 1-tt.want)
+		}
+	}
+}
+
+func TestProjectBox(t *testing.T) {
+	tests := []struct {
+		name   string
+		v      []float64
+		lo, hi []float64
+		want   []float64
+	}{
+		{"already feasible", []float64{0.3, 0.7}, []float64{0, 0}, []float64{1, 1}, []float64{0.3, 0.7}},
+		{"equal shift", []float64{0.3, 0.3, 0.1}, []float64{0, 0, 0}, []float64{1, 1, 1}, []float64{0.4, 0.4, 0.2}},
+		{"clipped below", []float64{2, 0}, []float64{0, 0}, []float64{1, 1}, []float64{1, 0}},
+		{"upper bound", []float64{0.9, 0.1, 0}, []float64{0, 0, 0}, []float64{0.5, 1, 1}, []float64{0.5, 0.3, 0.2}},
+		{"infeasible takes the closest sum", []float64{0.5, 0.5}, []float64{0, 0}, []float64{0.3, 0.3}, []float64{0.3, 0.3}},
+	}
+	for _, tt := range tests {
+		got := projectBox(tt.v, tt.lo, tt.hi)
+		for i := range tt.want {
+			if !near(got[i], tt.want[i]) {
+				t.Errorf("%s: projectBox = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -6,28 +6,9 @@ import (
 
 func CalculateZigZag(candles []dto.Candle, threshold float64) []dto.ZigZagPoint {
 	var zigzagPoints []dto.ZigZagPoint
-	var lastPivot dto.ZigZagPoint
-	var direction string
-
-	for i, candle := range candles {
-		if i == 0 {
-			lastPivot = dto.ZigZagPoint{Candle: candle, Type: dto.ZigZagHigh, Price: candle.Close}
-			zigzagPoints = append(zigzagPoints, lastPivot)
-			continue
-		}
-
-		priceChangeHigh := (candle.High - lastPivot.Price) / lastPivot.Price
-		priceChangeLow := (candle.Low - lastPivot.Price) / lastPivot.Price
-
-		if direction == "" || direction == "down" && priceChangeHigh >= threshold {
-			lastPivot = dto.ZigZagPoint{Candle: candle, Type: dto.ZigZagHigh, Price: candle.High}
-			zigzagPoints = append(zigzagPoints, lastPivot)
-			direction = "up"
-		} else if direction == "up" && priceChangeLow <= -threshold {
-			lastPivot = dto.ZigZagPoint{Candle: candle, Type: dto.ZigZagLow, Price: candle.Low}
-			zigzagPoints = append(zigzagPoints, lastPivot)
-			direction = "down"
-		}
+	stream := NewZigZagStream(threshold)
+	for _, candle := range candles {
+		zigzagPoints = append(zigzagPoints, stream.Update(candle)...)
 	}
 	return zigzagPoints
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/tikhomirovv/lazy-investor/internal/analytics"
 	"github.com/tikhomirovv/lazy-investor/internal/dto"
@@ -18,6 +19,21 @@ type Application struct {
 	tinkoff  *services.TinkoffService
 	chart    *services.ChartService
 	strategy *services.StrategyService
+	advisor  *services.RecommendationService
+	regime   *services.RegimeService
+	corr     *services.CorrelationService
+	ranking  *services.RankingService
+	alloc    *services.AllocationService
+	broker   *services.PortfolioService
+
+	benchmarks []benchmark
+	// Позиции у брокера после синхронизации, nil - неизвестны
+	holdings *dto.PortfolioSnapshot
+}
+
+type benchmark struct {
+	instrument *dto.Instrument
+	candles    []dto.Candle
 }
 
 func NewApplication(
@@ -26,6 +42,12 @@ func NewApplication(
 	tinkoff *services.TinkoffService,
 	chart *services.ChartService,
 	strategy *services.StrategyService,
+	advisor *services.RecommendationService,
+	regime *services.RegimeService,
+	corr *services.CorrelationService,
+	ranking *services.RankingService,
+	alloc *services.AllocationService,
+	broker *services.PortfolioService,
 ) *Application {
 	return &Application{
 		config:   config,
@@ -33,19 +55,228 @@ func NewApplication(
 		tinkoff:  tinkoff,
 		chart:    chart,
 		strategy: strategy,
+		advisor:  advisor,
+		regime:   regime,
+		corr:     corr,
+		ranking:  ranking,
+		alloc:    alloc,
+		broker:   broker,
 	}
 }
 
 func (a *Application) Run(ctx context.Context) {
+	// Сначала ситуация по индексам, потом по конкретным тикерам
+	a.benchmarks = a.loadBenchmarks()
 
 	var instruments []*dto.Instrument
 	for _, i := range a.config.Instruments {
 		instrument, _ := a.tinkoff.GetInstrumentIdByQuery(i.Isin)
 		instruments = append(instruments, instrument)
-		// go a.analyse(instrument)
 	}
+	// позиции у брокера нужны до анализа: рекомендации учитывают то, что уже куплено
+	if a.config.Portfolio.Enabled {
+		a.syncPortfolio(instruments)
+	}
+	for _, instrument := range instruments {
+		if instrument == nil {
+			continue
+		}
+		if err := a.analyse(instrument); err != nil {
+			a.logger.Error("Analyse instrument", "isin", instrument.Isin, "error", err)
+		}
+	}
+	candlesByIsin := a.loadCandles(instruments, time.Time{})
+	a.reportCorrelation(instruments, candlesByIsin)
+	// 12-месячному моментуму не хватает года свечей
+	a.reportRanking(instruments, a.loadCandles(instruments, time.Now().AddDate(0, -a.config.Ranking.History, 0)))
+	if a.config.Frontier.Enabled {
+		a.reportFrontier(instruments, candlesByIsin)
+	}
+	if a.config.Strategy.Pairs.Enabled {
+		a.reportPairs(instruments, candlesByIsin)
+	}
+
+	a.reportBacktest(instruments, candlesByIsin)
+	if a.config.Strategy.Optimize.Enabled {
+		a.reportOptimization(instruments, candlesByIsin)
+	}
+}
+
+func (a *Application) loadBenchmarks() []benchmark {
+	var benchmarks []benchmark
+	for _, b := range a.config.Benchmarks {
+		instrument, err := a.tinkoff.GetBenchmarkByQuery(b.Query)
+		if err != nil {
+			a.logger.Error("Load benchmark", "query", b.Query, "error", err)
+			continue
+		}
+		candles, err := a.tinkoff.GetCandles(instrument)
+		if err != nil {
+			a.logger.Error("Load benchmark candles", "query", b.Query, "error", err)
+			continue
+		}
+		trend, _ := analytics.GetTrends(analytics.FindSwings(candles, 2))
+		a.logger.Info("Benchmark trend", "benchmark", instrument.Name, "trend", trend.String())
+		benchmarks = append(benchmarks, benchmark{instrument: instrument, candles: candles})
+	}
+	return benchmarks
+}
+
+func (a *Application) syncPortfolio(instruments []*dto.Instrument) {
+	portfolio, err := a.broker.Sync()
+	if err != nil {
+		a.logger.Error("Portfolio sync", "error", err)
+		return
+	}
+	current := a.broker.Current(portfolio)
+	a.holdings = &current
+	names := make(map[dto.Isin]string)
+	for _, i := range instruments {
+		if i != nil {
+			names[i.Isin] = i.Name
+		}
+	}
+	if err := a.broker.WriteReport(os.Stdout, current, names); err != nil {
+		a.logger.Error("Portfolio report", "error", err)
+	}
+	if !a.config.Portfolio.Performance {
+		return
+	}
+	reports, err := a.broker.Performance(portfolio)
+	if err != nil {
+		a.logger.Error("Portfolio performance", "error", err)
+		return
+	}
+	if err := a.broker.WritePerformance(os.Stdout, reports, names); err != nil {
+		a.logger.Error("Portfolio performance report", "error", err)
+	}
+}
+
+// loadCandles loads candles of the instruments since `from`, нулевое - за последний год.
+func (a *Application) loadCandles(instruments []*dto.Instrument, from time.Time) map[dto.Isin][]dto.Candle {
+	candlesByIsin := make(map[dto.Isin][]dto.Candle)
+	for _, i := range instruments {
+		if i == nil {
+			continue
+		}
+		var candles []dto.Candle
+		var err error
+		if from.IsZero() {
+			candles, err = a.tinkoff.GetCandles(i)
+		} else {
+			candles, err = a.tinkoff.GetCandlesFrom(i, from)
+		}
+		if err != nil {
+			a.logger.Error("Load candles", "isin", i.Isin, "error", err)
+			continue
+		}
+		candlesByIsin[i.Isin] = candles
+	}
+	return candlesByIsin
+}
+
+func (a *Application) reportCorrelation(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle) {
+	byIsin := make(map[dto.Isin]*dto.Instrument)
+	for _, i := range instruments {
+		if i != nil {
+			byIsin[i.Isin] = i
+		}
+	}
+	report, err := a.corr.Latest(candlesByIsin)
+	if err != nil {
+		a.logger.Error("Correlation report", "error", err)
+		return
+	}
+	if err := a.corr.WriteReport(os.Stdout, report, byIsin); err != nil {
+		a.logger.Error("Correlation report", "error", err)
+	}
+}
 
-	a.strategy.Test(instruments)
+func (a *Application) reportFrontier(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle) {
+	names := make(map[dto.Isin]string)
+	for _, i := range instruments {
+		if i != nil {
+			names[i.Isin] = i.Name
+		}
+	}
+	frontier, err := a.alloc.Frontier(instruments, candlesByIsin)
+	if err != nil {
+		a.logger.Error("Efficient frontier", "error", err)
+		return
+	}
+	if err := a.alloc.WriteReport(os.Stdout, frontier, names); err != nil {
+		a.logger.Error("Efficient frontier report", "error", err)
+	}
+	if err := a.alloc.SaveChart(frontier, names); err != nil {
+		a.logger.Error("Efficient frontier chart", "error", err)
+	}
+}
+
+func (a *Application) reportPairs(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle) {
+	names := make(map[dto.Isin]string)
+	for _, i := range instruments {
+		if i != nil {
+			names[i.Isin] = i.Name
+		}
+	}
+	pairs := a.strategy.FindPairs(instruments, candlesByIsin)
+	if len(pairs) == 0 {
+		a.logger.Info("Cointegrated pairs: none")
+		return
+	}
+	if err := a.strategy.WritePairs(os.Stdout, pairs, names); err != nil {
+		a.logger.Error("Pairs report", "error", err)
+	}
+}
+
+func (a *Application) reportRanking(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle) {
+	var loaded []*dto.Instrument
+	for _, i := range instruments {
+		if i != nil {
+			loaded = append(loaded, i)
+		}
+	}
+	var benchmark []dto.Candle
+	if len(a.benchmarks) > 0 {
+		benchmark = a.benchmarks[0].candles
+	}
+	ranking := a.ranking.Rank(loaded, candlesByIsin, benchmark)
+	if err := a.ranking.WriteLeaderboard(os.Stdout, ranking); err != nil {
+		a.logger.Error("Ranking report", "error", err)
+	}
+	if err := a.ranking.Save(ranking); err != nil {
+		a.logger.Error("Save ranking", "error", err)
+	}
+}
+
+func (a *Application) reportBacktest(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle) {
+	result, metrics, err := a.strategy.Test(instruments, candlesByIsin)
+	if err != nil {
+		a.logger.Error("Backtest", "error", err)
+		return
+	}
+	if err := a.strategy.WriteReport(os.Stdout, metrics); err != nil {
+		a.logger.Error("Backtest report", "error", err)
+	}
+	if simulations, err := a.strategy.MonteCarlo(result); err != nil {
+		a.logger.Error("Monte Carlo", "error", err)
+	} else if err := a.strategy.WriteMonteCarlo(os.Stdout, simulations); err != nil {
+		a.logger.Error("Monte Carlo report", "error", err)
+	}
+	if err := a.strategy.SaveReport(metrics); err != nil {
+		a.logger.Error("Save backtest report", "error", err)
+	}
+}
+
+func (a *Application) reportOptimization(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle) {
+	results, windows, err := a.strategy.Optimize(instruments, candlesByIsin)
+	if err != nil {
+		a.logger.Error("Optimization", "error", err)
+		return
+	}
+	if err := a.strategy.WriteOptimization(os.Stdout, results, windows, 10); err != nil {
+		a.logger.Error("Optimization report", "error", err)
+	}
 }
 
 func (a *Application) analyse(instrument *dto.Instrument) error {
@@ -53,6 +284,9 @@ func (a *Application) analyse(instrument *dto.Instrument) error {
 	if err != nil {
 		return fmt.Errorf("application.analyse: %w", err)
 	}
+	if len(candles) == 0 {
+		return fmt.Errorf("application.analyse: no candles for %s", instrument.Isin)
+	}
 	// currentTrend, tc, l, s := a.analytics.AnalyzeTrendByMovingAverage(candles, 30, 80)
 	// currentTrend, tc, l := a.analytics.Analyze(candles, 100)
 	// a.logger.Debug("Trends", "curr", currentTrend, "trends", tc)
@@ -65,6 +299,15 @@ func (a *Application) analyse(instrument *dto.Instrument) error {
 
 	swings := analytics.FindSwings(candles, 2)
 	currentTrend, trendChanges := analytics.GetTrends(swings)
+	pc := a.config.Patterns
+	patterns := analytics.FindPatterns(candles, analytics.PatternOptions{
+		DojiBody:    pc.DojiBody,
+		SmallBody:   pc.SmallBody,
+		LongBody:    pc.LongBody,
+		ShadowRatio: pc.ShadowRatio,
+		MaxShadow:   pc.MaxShadow,
+		Lookback:    pc.Lookback,
+	})
 	// zz := analytics.CalculateZigZag(candles, 0.02)
 	// zz := analytics.ZigZag(candles, 14, 0.01, 2)
 	chart := &services.ChartValues{
@@ -79,8 +322,66 @@ func (a *Application) analyse(instrument *dto.Instrument) error {
 		// },
 		Swings: swings,
 		// ZigZags: zz,
+		Patterns: patterns,
+		Levels:   a.levels(candles, swings),
 	}
 	a.logger.Info("Current trend", "trend", currentTrend.String(), "tc", trendChanges)
+	regime := a.regime.Current(candles)
+	a.logger.Info("Current regime",
+		"regime", regime.Type.String(),
+		"volatility", regime.Volatility,
+		"hurst", regime.Hurst,
+		"vr", regime.VarianceRatio,
+		"adx", regime.ADX)
+	levels := analytics.FindLevels(swings, candles[len(candles)-1].Close, a.config.Recommendation.LevelTolerance)
+	for _, p := range analytics.PatternsAtLevels(patterns, levels, pc.LevelDistance) {
+		a.logger.Info("Pattern at level", "pattern", p.Type.String(), "direction", p.Direction.String(), "time", p.Time)
+	}
+	for _, oscillator := range []dto.Series{
+		analytics.CalculateRSI(candles, 14),
+		analytics.CalculateMACDHistogram(candles, 12, 26, 9),
+		analytics.CalculateOBV(candles),
+	} {
+		divergences := analytics.FindDivergences(candles, swings, oscillator, 2, 3)
+		for _, d := range analytics.TrendWarnings(currentTrend, swings, divergences) {
+			a.logger.Warn("Divergence at last swing",
+				"instrument", instrument.Name,
+				"indicator", d.Indicator,
+				"direction", d.Direction.String(),
+				"from", d.PriceSwings[0].Candle.Time,
+				"to", d.PriceSwings[1].Candle.Time)
+		}
+	}
+	last := candles[len(candles)-1:]
+	for _, t := range analytics.FindLevelTouches(last, chart.Levels, a.config.Levels.TouchTolerance) {
+		a.logger.Warn("Level touch",
+			"instrument", instrument.Name,
+			"level", t.Level.Name,
+			"price", t.Level.Price,
+			"type", t.Level.Type.String())
+	}
+	var comparisons []dto.BenchmarkComparison
+	for _, b := range a.benchmarks {
+		cmp := analytics.CompareWithBenchmark(candles, currentTrend, b.instrument, b.candles, 2)
+		comparisons = append(comparisons, cmp)
+		a.logger.Info("Benchmark comparison",
+			"benchmark", b.instrument.Name,
+			"trend", cmp.BenchmarkTrend.String(),
+			"beta", cmp.Beta,
+			"correlation", cmp.Correlation,
+			"rs", cmp.RelativeStrength)
+		if cmp.Contradicts {
+			a.logger.Warn("Trend contradicts benchmark", "instrument", instrument.Name, "benchmark", b.instrument.Name)
+		}
+	}
+	rec := a.advisor.Recommend(instrument, candles, comparisons, a.holdings)
+	a.logger.Info("Recommendation",
+		"instrument", instrument.Name,
+		"action", rec.Action.String(),
+		"confidence", rec.Confidence,
+		"quantity", rec.Quantity,
+		"stop", rec.Stop,
+		"reasons", rec.Reasons)
 	// a.logger.Info("ZZ", "zz", zz)
 	err = a.chart.Generate(chart, outFile)
 	if err != nil {
@@ -88,6 +389,62 @@ func (a *Application) analyse(instrument *dto.Instrument) error {
 		return fmt.Errorf("application.analyse: Generate chart error: %w", err)
 	}
 
+	for _, t := range a.config.Transform.Types {
+		if err := a.analyseTransformed(instrument, candles, dto.CandleTransform(t)); err != nil {
+			a.logger.Error("Analyse transformed candles", "transform", t, "error", err)
+		}
+	}
+	return nil
+}
+
+// Уровни Фибоначчи последнего движения и пивоты прошлого периода
+func (a *Application) levels(candles []dto.Candle, swings []dto.Swing) []dto.Level {
+	lc := a.config.Levels
+	var levels []dto.Level
+	if lc.Fibonacci {
+		levels = append(levels, analytics.SwingFibonacciLevels(candles, swings)...)
+	}
+	for _, kind := range lc.Pivots {
+		pivots, err := analytics.Pivots(candles, dto.Timeframe(lc.PivotsTimeframe), dto.PivotType(kind))
+		if err != nil {
+			a.logger.Error("Pivots", "error", err)
+			continue
+		}
+		levels = append(levels, pivots...)
+	}
+	return levels
+}
+
+// Тренд по сглаженным свечам для сравнения с обычными
+func (a *Application) analyseTransformed(instrument *dto.Instrument, candles []dto.Candle, transform dto.CandleTransform) error {
+	tc := a.config.Transform
+	transformed, err := analytics.TransformCandles(candles, transform, tc.Size, tc.ATRPeriod)
+	if err != nil {
+		return fmt.Errorf("application.analyseTransformed: %w", err)
+	}
+	swings := analytics.FindSwings(transformed, 2)
+	currentTrend, trendChanges := analytics.GetTrends(swings)
+	a.logger.Info("Current trend",
+		"transform", string(transform),
+		"trend", currentTrend.String(),
+		"candles", len(transformed),
+		"swings", len(swings),
+		"changes", len(trendChanges))
+
+	outFile, err := os.Create(".files/chart" + string(instrument.Isin) + "-" + string(transform) + ".png")
+	if err != nil {
+		return fmt.Errorf("application.analyseTransformed: Create chart file: %w", err)
+	}
+	defer outFile.Close()
+	err = a.chart.Generate(&services.ChartValues{
+		Title:   fmt.Sprintf("%s (%s)", instrument.Name, transform),
+		Candles: transformed,
+		Trends:  trendChanges,
+		Swings:  swings,
+	}, outFile)
+	if err != nil {
+		return fmt.Errorf("application.analyseTransformed: Generate chart error: %w", err)
+	}
 	return nil
 }
 
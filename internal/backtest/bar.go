@@ -0,0 +1,47 @@
+package backtest
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// Свечи всех инструментов на один момент времени
+type TimePrices struct {
+	Time   time.Time
+	Prices map[dto.Isin]dto.Candle
+}
+
+func GroupCandlesByTime(candlesByIsin map[dto.Isin][]dto.Candle) []TimePrices {
+	timeMap := make(map[time.Time]map[dto.Isin]dto.Candle)
+	for isin, candles := range candlesByIsin {
+		for _, candle := range candles {
+			if _, exists := timeMap[candle.Time]; !exists {
+				timeMap[candle.Time] = make(map[dto.Isin]dto.Candle)
+			}
+			timeMap[candle.Time][isin] = candle
+		}
+	}
+	// Преобразуем map в слайс с сортировкой по времени
+	var timePrices []TimePrices
+	for t, prices := range timeMap {
+		timePrices = append(timePrices, TimePrices{Time: t, Prices: prices})
+	}
+	sort.Slice(timePrices, func(i, j int) bool {
+		return timePrices[i].Time.Before(timePrices[j].Time)
+	})
+	return timePrices
+}
+
+// Isins returns instruments of the bar sorted by ISIN, so iteration is deterministic.
+func (tp TimePrices) Isins() []dto.Isin {
+	isins := make([]dto.Isin, 0, len(tp.Prices))
+	for isin := range tp.Prices {
+		isins = append(isins, isin)
+	}
+	sort.Slice(isins, func(i, j int) bool {
+		return isins[i] < isins[j]
+	})
+	return isins
+}
@@ -0,0 +1,392 @@
+package backtest
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// Broker accepts orders of the strategy and keeps its account.
+type Broker interface {
+	Submit(order Order) int
+	// Cancel removes the pending order and reports whether it was found
+	Cancel(id int) bool
+	// Pending returns orders waiting for execution
+	Pending() []Order
+	Cash() float64
+	Position(isin dto.Isin) float64
+	Positions() map[dto.Isin]float64
+	// Holdings returns open positions with the cost basis and realized result
+	Holdings() []Holding
+	// Equity returns cash plus positions at the last close prices
+	Equity() float64
+}
+
+// SimBroker executes orders by the candles of the next bars and the execution model.
+// Без маржи и шортов: покупка ограничена деньгами, продажа - позицией.
+type SimBroker struct {
+	execution Execution
+	ledger    *Ledger
+	prices    map[dto.Isin]float64 // последние цены закрытия
+	atr       map[dto.Isin]*analytics.ATRStream
+	pending   []Order
+	nextID    int
+	now       time.Time
+}
+
+func NewSimBroker(cash float64, execution Execution) *SimBroker {
+	return &SimBroker{
+		execution: execution,
+		ledger:    NewLedger(cash),
+		prices:    make(map[dto.Isin]float64),
+		atr:       make(map[dto.Isin]*analytics.ATRStream),
+	}
+}
+
+func (b *SimBroker) Submit(order Order) int {
+	b.nextID++
+	order.ID = b.nextID
+	order.Time = b.now
+	// трейлинг-стоп отсчитывается от последней цены закрытия
+	order.extreme = b.prices[order.Isin]
+	b.pending = append(b.pending, order)
+	return order.ID
+}
+
+func (b *SimBroker) Cancel(id int) bool {
+	for i, order := range b.pending {
+		if order.ID == id {
+			b.pending = append(b.pending[:i], b.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (b *SimBroker) Pending() []Order {
+	return append([]Order(nil), b.pending...)
+}
+
+func (b *SimBroker) Cash() float64 {
+	return b.ledger.Cash()
+}
+
+func (b *SimBroker) Position(isin dto.Isin) float64 {
+	return b.ledger.Quantity(isin)
+}
+
+func (b *SimBroker) Positions() map[dto.Isin]float64 {
+	positions := make(map[dto.Isin]float64)
+	for _, h := range b.ledger.Holdings() {
+		positions[h.Isin] = h.Quantity
+	}
+	return positions
+}
+
+func (b *SimBroker) Holdings() []Holding {
+	return b.ledger.Holdings()
+}
+
+func (b *SimBroker) Equity() float64 {
+	return b.ledger.Equity(b.prices)
+}
+
+// Ledger returns the account of the broker.
+func (b *SimBroker) Ledger() *Ledger {
+	return b.ledger
+}
+
+// Prices returns the last close prices.
+func (b *SimBroker) Prices() map[dto.Isin]float64 {
+	prices := make(map[dto.Isin]float64, len(b.prices))
+	for isin, p := range b.prices {
+		prices[isin] = p
+	}
+	return prices
+}
+
+// Этапы исполнения заявок внутри бара. Порядок цен внутри свечи неизвестен, поэтому
+// если на одном баре достигнуты и стоп, и цель, считается, что сначала сработал стоп.
+const (
+	stageOpen  = iota // на открытии, в том числе при гэпе через цену заявки
+	stageStop         // стопы внутри бара
+	stageLimit        // лимитные заявки внутри бара
+)
+
+type trigger struct {
+	order    Order
+	price    float64
+	stage    int
+	slippage bool // рыночное исполнение с проскальзыванием
+}
+
+// execute fills pending orders by the candle of the bar. На открытии продажи исполняются раньше
+// покупок, чтобы вырученные деньги можно было сразу вложить. Исполнение заявки из группы OCO
+// отменяет остальные заявки группы. Заявки по инструментам без свечи на этом баре ждут следующего.
+func (b *SimBroker) execute(bar TimePrices) (fills []Fill, rejected []Order) {
+	b.now = bar.Time
+	orders := b.pending
+	b.pending = nil
+	var triggers []trigger
+	for _, order := range orders {
+		candle, exists := bar.Prices[order.Isin]
+		if !exists || candle.Open <= 0 {
+			b.pending = append(b.pending, order)
+			continue
+		}
+		if !order.valid() {
+			rejected = append(rejected, order)
+			continue
+		}
+		t, ok := b.trigger(&order, candle)
+		if !ok {
+			b.trail(&order, candle)
+			b.pending = append(b.pending, order)
+			continue
+		}
+		triggers = append(triggers, t)
+	}
+	sort.SliceStable(triggers, func(i, j int) bool {
+		if triggers[i].stage != triggers[j].stage {
+			return triggers[i].stage < triggers[j].stage
+		}
+		return triggers[i].order.Side == SideSell && triggers[j].order.Side == SideBuy
+	})
+	done := make(map[int]bool) // исполненные группы OCO
+	for _, t := range triggers {
+		if t.order.Group != 0 && done[t.order.Group] {
+			continue
+		}
+		fill, ok := b.fill(t.order, t.price, t.slippage)
+		if !ok {
+			rejected = append(rejected, t.order)
+			continue
+		}
+		fills = append(fills, fill)
+		if t.order.Group != 0 {
+			done[t.order.Group] = true
+		}
+	}
+	if len(done) > 0 {
+		pending := b.pending[:0]
+		for _, order := range b.pending {
+			if order.Group == 0 || !done[order.Group] {
+				pending = append(pending, order)
+			}
+		}
+		b.pending = pending
+	}
+	return fills, rejected
+}
+
+func (o Order) valid() bool {
+	switch o.Type {
+	case OrderMarket:
+		return true
+	case OrderLimit:
+		return o.LimitPrice > 0
+	case OrderStop:
+		return o.StopPrice > 0
+	case OrderStopLimit:
+		return o.StopPrice > 0 && o.LimitPrice > 0
+	case OrderTrailingStop:
+		return o.TrailPercent > 0 || o.TrailATR > 0
+	}
+	return false
+}
+
+// trigger checks whether the order is executed on the candle and returns the base price of the execution.
+// Стоп-лимит после срабатывания без исполнения остаётся лимитной заявкой.
+func (b *SimBroker) trigger(order *Order, candle dto.Candle) (trigger, bool) {
+	t := trigger{order: *order}
+	var atOpen, ok bool
+	switch order.Type {
+	case OrderMarket:
+		t.price, atOpen, ok = candle.Open, true, true
+		t.slippage = true
+	case OrderLimit:
+		t.price, atOpen, ok = limitHit(order.Side, candle, order.LimitPrice)
+		t.stage = stageLimit
+	case OrderStop:
+		t.price, atOpen, ok = stopHit(order.Side, candle, order.StopPrice)
+		t.stage, t.slippage = stageStop, true
+	case OrderTrailingStop:
+		level := b.trailLevel(*order)
+		if level <= 0 {
+			return t, false
+		}
+		t.price, atOpen, ok = stopHit(order.Side, candle, level)
+		t.stage, t.slippage = stageStop, true
+	case OrderStopLimit:
+		t.stage = stageLimit
+		if !order.triggered {
+			var price float64
+			if price, atOpen, ok = stopHit(order.Side, candle, order.StopPrice); !ok {
+				return t, false
+			}
+			order.triggered = true
+			t.order.triggered = true
+			if !atOpen {
+				// сработал внутри бара: цена в этот момент равна стопу
+				at := dto.Candle{Open: price, High: price, Low: price}
+				t.price, _, ok = limitHit(order.Side, at, order.LimitPrice)
+				t.stage = stageStop
+				return t, ok
+			}
+		}
+		t.price, atOpen, ok = limitHit(order.Side, candle, order.LimitPrice)
+	}
+	if atOpen {
+		t.stage = stageOpen
+	}
+	return t, ok
+}
+
+// limitHit returns the price of the limit order: the open if it is already better than the limit,
+// otherwise the limit if the candle reaches it.
+func limitHit(side Side, candle dto.Candle, limit float64) (price float64, atOpen bool, ok bool) {
+	switch {
+	case side == SideBuy && candle.Open <= limit, side == SideSell && candle.Open >= limit:
+		return candle.Open, true, true
+	case side == SideBuy && candle.Low <= limit, side == SideSell && candle.High >= limit:
+		return limit, false, true
+	}
+	return 0, false, false
+}
+
+// stopHit returns the price at which the stop is triggered: the open in case of a gap through
+// the stop, otherwise the stop if the candle reaches it.
+func stopHit(side Side, candle dto.Candle, stop float64) (price float64, atOpen bool, ok bool) {
+	switch {
+	case side == SideBuy && candle.Open >= stop, side == SideSell && candle.Open <= stop:
+		return candle.Open, true, true
+	case side == SideBuy && candle.High >= stop, side == SideSell && candle.Low <= stop:
+		return stop, false, true
+	}
+	return 0, false, false
+}
+
+// trailLevel returns the current stop of the trailing order. Пока нет цены или ATR - 0.
+func (b *SimBroker) trailLevel(order Order) float64 {
+	if order.extreme <= 0 {
+		return 0
+	}
+	offset := order.extreme * order.TrailPercent
+	if order.TrailATR > 0 {
+		stream := b.atr[order.Isin]
+		if stream == nil {
+			return 0
+		}
+		offset = order.TrailATR * stream.Value()
+	}
+	if order.Side == SideBuy {
+		return order.extreme + offset
+	}
+	return math.Max(0, order.extreme-offset)
+}
+
+// trail moves the best price of the trailing order after the bar in which it was not triggered.
+func (b *SimBroker) trail(order *Order, candle dto.Candle) {
+	if order.Type != OrderTrailingStop {
+		return
+	}
+	switch {
+	case order.extreme <= 0:
+		order.extreme = candle.Close
+	case order.Side == SideSell:
+		order.extreme = math.Max(order.extreme, candle.High)
+	case order.Side == SideBuy:
+		order.extreme = math.Min(order.extreme, candle.Low)
+	}
+}
+
+// fill executes the order at the base price, shifted by the slippage for market executions.
+func (b *SimBroker) fill(order Order, base float64, slippage bool) (Fill, bool) {
+	quantity := order.Quantity
+	if quantity <= 0 && order.Value > 0 {
+		quantity = order.Value / base
+	}
+	price := base
+	var commission float64
+	cash := b.ledger.Cash()
+	switch order.Side {
+	case SideBuy:
+		if cash <= 0 {
+			return Fill{}, false
+		}
+		if quantity <= 0 {
+			quantity = cash / base
+		}
+		if slippage {
+			price = b.execution.price(order.Isin, order.Side, base, quantity)
+		}
+		quantity = b.execution.roundQuantity(order.Isin, math.Min(quantity, b.affordable(price)))
+		commission = b.execution.Commission.Calculate(quantity * price)
+		// минимальная комиссия может сделать последний лот недоступным,
+		// после уменьшения на её размер комиссия не растёт, и денег хватает
+		if quantity*price+commission > cash {
+			quantity = b.execution.roundQuantity(order.Isin, (cash-commission)/price)
+			commission = b.execution.Commission.Calculate(quantity * price)
+		}
+		if quantity <= 0 || b.ledger.Buy(b.now, order.Isin, quantity, price, commission) != nil {
+			return Fill{}, false
+		}
+	case SideSell:
+		position := b.ledger.Quantity(order.Isin)
+		if quantity <= 0 {
+			quantity = position
+		}
+		quantity = b.execution.roundQuantity(order.Isin, math.Min(quantity, position))
+		if slippage {
+			price = b.execution.price(order.Isin, order.Side, base, quantity)
+		}
+		if quantity <= 0 || price <= 0 {
+			return Fill{}, false
+		}
+		commission = b.execution.Commission.Calculate(quantity * price)
+		if _, err := b.ledger.Sell(b.now, order.Isin, quantity, price, commission); err != nil {
+			return Fill{}, false
+		}
+	}
+	return Fill{
+		OrderID:    order.ID,
+		Isin:       order.Isin,
+		Side:       order.Side,
+		Type:       order.Type,
+		Quantity:   quantity,
+		Price:      price,
+		Commission: commission,
+		Slippage:   math.Abs(price-base) * quantity,
+		Time:       b.now,
+	}, true
+}
+
+// affordable returns the quantity that can be bought with all cash including the commission.
+func (b *SimBroker) affordable(price float64) float64 {
+	c := b.execution.Commission
+	cash := b.ledger.Cash()
+	quantity := cash / (price * (1 + c.Rate))
+	if quantity*price*c.Rate < c.Min {
+		quantity = (cash - c.Min) / price
+	}
+	return math.Max(0, quantity)
+}
+
+// mark updates the last prices and ATR by the close of the bar.
+func (b *SimBroker) mark(bar TimePrices) {
+	for isin, candle := range bar.Prices {
+		if candle.Close > 0 {
+			b.prices[isin] = candle.Close
+		}
+		if b.atr[isin] == nil {
+			b.atr[isin] = analytics.NewATRStream(b.execution.atrPeriod())
+		}
+		b.atr[isin].Update(candle)
+		if b.execution.Slippage != nil {
+			b.execution.Slippage.Update(isin, candle)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package backtest
+
+import "time"
+
+// Clock is the simulated time of the backtest. It only moves forward with the bars.
+type Clock struct {
+	now time.Time
+}
+
+// Now returns the time of the current bar.
+func (c *Clock) Now() time.Time {
+	return c.now
+}
+
+func (c *Clock) advance(t time.Time) {
+	if t.After(c.now) {
+		c.now = t
+	}
+}
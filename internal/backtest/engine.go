@@ -0,0 +1,90 @@
+package backtest
+
+import (
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+type EquityPoint struct {
+	Time   time.Time
+	Equity float64 // RUB по ценам закрытия
+	Cash   float64
+}
+
+type Result struct {
+	Equity    []EquityPoint
+	Fills     []Fill
+	Rejected  []Order
+	Cash      float64
+	Positions map[dto.Isin]float64
+	Holdings  []Holding
+	Realized  float64 // зафиксированный результат продаж, RUB
+	Flows     []CashFlow
+	Prices    map[dto.Isin]float64 // цены закрытия последнего бара
+}
+
+// Engine runs the strategy over the bars in time order.
+type Engine struct {
+	clock    *Clock
+	broker   *SimBroker
+	strategy Strategy
+}
+
+func NewEngine(broker *SimBroker, strategy Strategy) *Engine {
+	return &Engine{
+		clock:    &Clock{},
+		broker:   broker,
+		strategy: strategy,
+	}
+}
+
+// Run processes the bars one by one: pending orders are executed at the open,
+// then the strategy gets the closed bar and can place new orders.
+func (e *Engine) Run(bars []TimePrices) Result {
+	ctx := &Context{Clock: e.clock, Broker: e.broker}
+	var result Result
+	for _, bar := range bars {
+		e.clock.advance(bar.Time)
+
+		fills, rejected := e.broker.execute(bar)
+		result.Rejected = append(result.Rejected, rejected...)
+		for _, fill := range fills {
+			result.Fills = append(result.Fills, fill)
+			e.strategy.OnFill(ctx, fill)
+		}
+
+		e.broker.mark(bar)
+		e.strategy.OnBar(ctx, bar)
+		result.Equity = append(result.Equity, EquityPoint{
+			Time:   bar.Time,
+			Equity: e.broker.Equity(),
+			Cash:   e.broker.Cash(),
+		})
+	}
+	result.Cash = e.broker.Cash()
+	result.Positions = e.broker.Positions()
+	result.Holdings = e.broker.Holdings()
+	result.Realized = e.broker.Ledger().Realized()
+	result.Flows = e.broker.Ledger().Flows()
+	result.Prices = e.broker.Prices()
+	return result
+}
+
+// BuyAndHold returns the equity curve of the cash invested into the instrument at the first
+// close and held to the end of the bars.
+func BuyAndHold(bars []TimePrices, isin dto.Isin, cash float64) []EquityPoint {
+	var curve []EquityPoint
+	var quantity float64
+	for _, bar := range bars {
+		candle, exists := bar.Prices[isin]
+		if !exists || candle.Close <= 0 {
+			continue
+		}
+		if quantity == 0 {
+			quantity = cash / candle.Close
+		}
+		curve = append(curve, EquityPoint{Time: bar.Time, Equity: quantity * candle.Close})
+	}
+	return curve
+}
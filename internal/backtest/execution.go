@@ -0,0 +1,168 @@
+package backtest
+
+import (
+	"math"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// Commission is the broker fee as a share of the trade value, but not less than the minimum.
+type Commission struct {
+	Rate float64
+	Min  float64 // RUB за сделку
+}
+
+func (c Commission) Calculate(value float64) float64 {
+	if value <= 0 {
+		return 0
+	}
+	return math.Max(value*c.Rate, c.Min)
+}
+
+// Тарифы Тинькофф Инвестиций: комиссия за сделку с акциями и фондами
+var TinkoffTariffs = map[string]Commission{
+	"investor": {Rate: 0.003},
+	"trader":   {Rate: 0.0005},
+	"premium":  {Rate: 0.0004},
+}
+
+// SlippageModel estimates how much worse than the open price the order is executed.
+type SlippageModel interface {
+	// Update is called with every closed candle of the instrument
+	Update(isin dto.Isin, candle dto.Candle)
+	// Slippage returns the price shift against the order, RUB
+	Slippage(isin dto.Isin, price float64, quantity float64) float64
+}
+
+// FixedSlippage shifts the price by fixed basis points.
+type FixedSlippage struct {
+	Bps float64
+}
+
+func (s *FixedSlippage) Update(isin dto.Isin, candle dto.Candle) {}
+
+func (s *FixedSlippage) Slippage(isin dto.Isin, price float64, quantity float64) float64 {
+	return price * s.Bps / 10000
+}
+
+// ATRSlippage shifts the price by a fraction of the ATR of the instrument.
+type ATRSlippage struct {
+	period   int
+	fraction float64
+	streams  map[dto.Isin]*analytics.ATRStream
+	atr      map[dto.Isin]float64
+}
+
+func NewATRSlippage(period int, fraction float64) *ATRSlippage {
+	return &ATRSlippage{
+		period:   period,
+		fraction: fraction,
+		streams:  make(map[dto.Isin]*analytics.ATRStream),
+		atr:      make(map[dto.Isin]float64),
+	}
+}
+
+func (s *ATRSlippage) Update(isin dto.Isin, candle dto.Candle) {
+	if s.streams[isin] == nil {
+		s.streams[isin] = analytics.NewATRStream(s.period)
+	}
+	s.atr[isin] = s.streams[isin].Update(candle)
+}
+
+func (s *ATRSlippage) Slippage(isin dto.Isin, price float64, quantity float64) float64 {
+	return s.fraction * s.atr[isin]
+}
+
+// VolumeSlippage grows with the share of the order in the volume of the previous candle
+// by the square root law: price * impact * sqrt(quantity / volume).
+type VolumeSlippage struct {
+	impact  float64
+	lots    map[dto.Isin]int
+	volumes map[dto.Isin]float64 // объём прошлой свечи, штук
+}
+
+func NewVolumeSlippage(impact float64, instruments map[dto.Isin]*dto.Instrument) *VolumeSlippage {
+	s := &VolumeSlippage{impact: impact, lots: make(map[dto.Isin]int), volumes: make(map[dto.Isin]float64)}
+	for isin, i := range instruments {
+		if i != nil {
+			s.lots[isin] = i.Lot
+		}
+	}
+	return s
+}
+
+func (s *VolumeSlippage) Update(isin dto.Isin, candle dto.Candle) {
+	// объём свечей в API - в лотах
+	lot := s.lots[isin]
+	if lot <= 0 {
+		lot = 1
+	}
+	s.volumes[isin] = float64(candle.Volume * int64(lot))
+}
+
+func (s *VolumeSlippage) Slippage(isin dto.Isin, price float64, quantity float64) float64 {
+	volume := s.volumes[isin]
+	if volume <= 0 {
+		return 0
+	}
+	return price * s.impact * math.Sqrt(quantity/volume)
+}
+
+// Execution describes how the simulated broker executes orders.
+type Execution struct {
+	Commission  Commission
+	Slippage    SlippageModel                // nil - без проскальзывания
+	Instruments map[dto.Isin]*dto.Instrument // лоты и шаг цены
+	ATRPeriod   int                          // для трейлинг-стопов по ATR, 0 - 14
+}
+
+func (e Execution) atrPeriod() int {
+	if e.ATRPeriod > 0 {
+		return e.ATRPeriod
+	}
+	return 14
+}
+
+func (e Execution) lot(isin dto.Isin) float64 {
+	if i := e.Instruments[isin]; i != nil && i.Lot > 0 {
+		return float64(i.Lot)
+	}
+	return 0
+}
+
+// roundQuantity rounds the quantity down to whole lots. Без данных о лоте количество дробное.
+func (e Execution) roundQuantity(isin dto.Isin, quantity float64) float64 {
+	lot := e.lot(isin)
+	if lot == 0 {
+		return quantity
+	}
+	return math.Floor(quantity/lot+1e-9) * lot
+}
+
+// price returns the execution price: the open shifted by the slippage against the order
+// and rounded to the price increment in the unfavorable direction.
+func (e Execution) price(isin dto.Isin, side Side, open float64, quantity float64) float64 {
+	price := open
+	var slippage float64
+	if e.Slippage != nil {
+		slippage = e.Slippage.Slippage(isin, open, quantity)
+	}
+	var increment float64
+	if i := e.Instruments[isin]; i != nil {
+		increment = i.MinPriceIncrement
+	}
+	switch side {
+	case SideBuy:
+		price += slippage
+		if increment > 0 {
+			price = math.Ceil(price/increment-1e-9) * increment
+		}
+	case SideSell:
+		price -= slippage
+		if increment > 0 {
+			price = math.Floor(price/increment+1e-9) * increment
+		}
+	}
+	return price
+}
@@ -0,0 +1,218 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// Допуск округления при сравнении денег и количества
+const ledgerEpsilon = 1e-9
+
+// Holding is an open position of the ledger.
+type Holding struct {
+	Isin     dto.Isin
+	Quantity float64
+	Cost     float64 // стоимость покупки оставшегося количества с комиссиями, RUB
+	Realized float64 // зафиксированный результат продаж позиции, RUB
+	Opened   time.Time
+}
+
+// AveragePrice returns the average purchase price including commissions.
+func (h Holding) AveragePrice() float64 {
+	if h.Quantity <= 0 {
+		return 0
+	}
+	return h.Cost / h.Quantity
+}
+
+// Unrealized returns the result of the position at the price before the sell commission.
+func (h Holding) Unrealized(price float64) float64 {
+	return h.Quantity*price - h.Cost
+}
+
+type CashFlowType int
+
+const (
+	CashDeposit CashFlowType = iota
+	CashWithdrawal
+	CashBuy
+	CashSell
+	CashCommission
+)
+
+func (t CashFlowType) String() string {
+	return [...]string{"deposit", "withdrawal", "buy", "sell", "commission"}[t]
+}
+
+// CashFlow is a change of the cash. Amount положительный для поступлений и отрицательный для списаний.
+type CashFlow struct {
+	Time   time.Time
+	Type   CashFlowType
+	Isin   dto.Isin // пусто для ввода и вывода денег
+	Amount float64
+}
+
+// Ledger keeps the cash and any number of positions with the cost basis and PnL.
+// Операции, после которых деньги или количество стали бы отрицательными, отклоняются.
+type Ledger struct {
+	cash     float64
+	holdings map[dto.Isin]*Holding
+	realized float64 // по всем позициям, включая закрытые
+	flows    []CashFlow
+}
+
+func NewLedger(cash float64) *Ledger {
+	l := &Ledger{holdings: make(map[dto.Isin]*Holding)}
+	if cash > 0 {
+		l.cash = cash
+		l.flows = append(l.flows, CashFlow{Type: CashDeposit, Amount: cash})
+	}
+	return l
+}
+
+func (l *Ledger) Deposit(t time.Time, amount float64) error {
+	if amount <= 0 {
+		return fmt.Errorf("Ledger.Deposit: amount %g must be positive", amount)
+	}
+	l.cash += amount
+	l.flows = append(l.flows, CashFlow{Time: t, Type: CashDeposit, Amount: amount})
+	return nil
+}
+
+func (l *Ledger) Withdraw(t time.Time, amount float64) error {
+	if amount <= 0 {
+		return fmt.Errorf("Ledger.Withdraw: amount %g must be positive", amount)
+	}
+	if amount > l.cash+ledgerEpsilon {
+		return fmt.Errorf("Ledger.Withdraw: amount %g is more than cash %g", amount, l.cash)
+	}
+	l.cash = l.clamp(l.cash - amount)
+	l.flows = append(l.flows, CashFlow{Time: t, Type: CashWithdrawal, Amount: -amount})
+	return nil
+}
+
+// Buy adds the quantity to the position. Комиссия входит в стоимость покупки.
+func (l *Ledger) Buy(t time.Time, isin dto.Isin, quantity, price, commission float64) error {
+	if quantity <= 0 || price <= 0 || commission < 0 {
+		return fmt.Errorf("Ledger.Buy: invalid trade %g x %g, commission %g", quantity, price, commission)
+	}
+	value := quantity * price
+	if value+commission > l.cash+ledgerEpsilon {
+		return fmt.Errorf("Ledger.Buy: %s for %g is more than cash %g", isin, value+commission, l.cash)
+	}
+	h := l.holdings[isin]
+	if h == nil {
+		h = &Holding{Isin: isin, Opened: t}
+		l.holdings[isin] = h
+	}
+	h.Quantity += quantity
+	h.Cost += value + commission
+	l.cash = l.clamp(l.cash - value - commission)
+	l.flows = append(l.flows, CashFlow{Time: t, Type: CashBuy, Isin: isin, Amount: -value})
+	if commission > 0 {
+		l.flows = append(l.flows, CashFlow{Time: t, Type: CashCommission, Isin: isin, Amount: -commission})
+	}
+	return nil
+}
+
+// Sell removes the quantity from the position and returns the realized result by the average cost.
+// Закрытая позиция удаляется, её результат остаётся в Realized.
+func (l *Ledger) Sell(t time.Time, isin dto.Isin, quantity, price, commission float64) (float64, error) {
+	if quantity <= 0 || price <= 0 || commission < 0 {
+		return 0, fmt.Errorf("Ledger.Sell: invalid trade %g x %g, commission %g", quantity, price, commission)
+	}
+	h := l.holdings[isin]
+	if h == nil || quantity > h.Quantity+ledgerEpsilon {
+		return 0, fmt.Errorf("Ledger.Sell: %s quantity %g is more than position %g", isin, quantity, l.Quantity(isin))
+	}
+	value := quantity * price
+	if commission > l.cash+value+ledgerEpsilon {
+		return 0, fmt.Errorf("Ledger.Sell: %s commission %g is more than cash %g", isin, commission, l.cash+value)
+	}
+	quantity = math.Min(quantity, h.Quantity)
+	cost := h.Cost * quantity / h.Quantity
+	pnl := value - commission - cost
+	h.Quantity -= quantity
+	h.Cost -= cost
+	h.Realized += pnl
+	l.realized += pnl
+	if h.Quantity <= ledgerEpsilon {
+		delete(l.holdings, isin)
+	}
+	l.cash = l.clamp(l.cash + value - commission)
+	l.flows = append(l.flows, CashFlow{Time: t, Type: CashSell, Isin: isin, Amount: value})
+	if commission > 0 {
+		l.flows = append(l.flows, CashFlow{Time: t, Type: CashCommission, Isin: isin, Amount: -commission})
+	}
+	return pnl, nil
+}
+
+// clamp removes negative rounding errors of the cash.
+func (l *Ledger) clamp(cash float64) float64 {
+	if cash < 0 {
+		return 0
+	}
+	return cash
+}
+
+func (l *Ledger) Cash() float64 {
+	return l.cash
+}
+
+func (l *Ledger) Quantity(isin dto.Isin) float64 {
+	if h := l.holdings[isin]; h != nil {
+		return h.Quantity
+	}
+	return 0
+}
+
+func (l *Ledger) Holding(isin dto.Isin) (Holding, bool) {
+	if h := l.holdings[isin]; h != nil {
+		return *h, true
+	}
+	return Holding{}, false
+}
+
+// Holdings returns open positions sorted by ISIN.
+func (l *Ledger) Holdings() []Holding {
+	holdings := make([]Holding, 0, len(l.holdings))
+	for _, h := range l.holdings {
+		holdings = append(holdings, *h)
+	}
+	sort.Slice(holdings, func(i, j int) bool {
+		return holdings[i].Isin < holdings[j].Isin
+	})
+	return holdings
+}
+
+// Realized returns the realized result of all sells.
+func (l *Ledger) Realized() float64 {
+	return l.realized
+}
+
+// Unrealized returns the result of open positions at the prices.
+func (l *Ledger) Unrealized(prices map[dto.Isin]float64) float64 {
+	var unrealized float64
+	for _, h := range l.Holdings() {
+		unrealized += h.Unrealized(prices[h.Isin])
+	}
+	return unrealized
+}
+
+// Equity returns the cash plus positions at the prices. Позиции складываются в порядке ISIN,
+// потому что порядок сложения влияет на результат, а бэктест должен повторяться.
+func (l *Ledger) Equity(prices map[dto.Isin]float64) float64 {
+	equity := l.cash
+	for _, h := range l.Holdings() {
+		equity += h.Quantity * prices[h.Isin]
+	}
+	return equity
+}
+
+func (l *Ledger) Flows() []CashFlow {
+	return append([]CashFlow(nil), l.flows...)
+}
@@ -0,0 +1,242 @@
+package backtest
+
+import (
+	"math"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg"
+)
+
+// Trade is a closed (fully or partially) position.
+type Trade struct {
+	Isin     dto.Isin
+	Open     time.Time
+	Close    time.Time
+	Quantity float64
+	Cost     float64 // стоимость покупки закрытой части с комиссиями, RUB
+	PnL      float64 // RUB с учётом комиссий
+	Return   float64 // PnL к стоимости покупки
+}
+
+// Trades matches sells with buys by the average cost of the position.
+func Trades(fills []Fill) []Trade {
+	type position struct {
+		quantity float64
+		cost     float64 // с комиссиями покупок
+		opened   time.Time
+	}
+	positions := make(map[dto.Isin]*position)
+	var trades []Trade
+	for _, f := range fills {
+		p := positions[f.Isin]
+		if p == nil {
+			p = &position{}
+			positions[f.Isin] = p
+		}
+		switch f.Side {
+		case SideBuy:
+			if p.quantity <= 0 {
+				p.opened = f.Time
+			}
+			p.quantity += f.Quantity
+			p.cost += f.Value() + f.Commission
+		case SideSell:
+			if p.quantity <= 0 {
+				continue
+			}
+			cost := p.cost * f.Quantity / p.quantity
+			trade := Trade{
+				Isin:     f.Isin,
+				Open:     p.opened,
+				Close:    f.Time,
+				Quantity: f.Quantity,
+				Cost:     cost,
+				PnL:      f.Value() - f.Commission - cost,
+			}
+			if cost > 0 {
+				trade.Return = trade.PnL / cost
+			}
+			trades = append(trades, trade)
+			p.quantity -= f.Quantity
+			p.cost -= cost
+		}
+	}
+	return trades
+}
+
+type Metrics struct {
+	Name            string    `json:"name"`
+	Numeraire       string    `json:"numeraire"` // единица оценки капитала
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	InitialEquity   float64   `json:"initialEquity"`
+	FinalEquity     float64   `json:"finalEquity"`
+	TotalReturn     float64   `json:"totalReturn"`
+	CAGR            float64   `json:"cagr"`
+	Volatility      float64   `json:"volatility"` // годовая
+	Sharpe          float64   `json:"sharpe"`
+	Sortino         float64   `json:"sortino"`
+	Calmar          float64   `json:"calmar"`
+	MaxDrawdown     float64   `json:"maxDrawdown"`
+	MaxDrawdownDays int       `json:"maxDrawdownDays"` // от пика до восстановления
+	Exposure        float64   `json:"exposure"`        // доля баров в позиции
+	Turnover        float64   `json:"turnover"`        // оборот к среднему капиталу за год
+	Trades          int       `json:"trades"`
+	WinRate         float64   `json:"winRate"`
+	ProfitFactor    float64   `json:"profitFactor"` // 0 - нет убыточных сделок
+}
+
+// CalculateMetrics calculates performance metrics of the equity curve in RUB and the fills.
+// Доходность и риск считаются по капиталу в единице оценки с её безрисковой ставкой,
+// экспозиция, оборот и статистика сделок не зависят от единицы и считаются в рублях.
+func CalculateMetrics(name string, curve []EquityPoint, fills []Fill, numeraire dto.Numeraire) Metrics {
+	m := Metrics{Name: name, Numeraire: numeraire.Name}
+	if len(curve) == 0 {
+		return m
+	}
+	returnMetrics(&m, Revalue(curve, numeraire), numeraire.RiskFree)
+	tradeMetrics(&m, curve, fills)
+	return m
+}
+
+// Revalue converts the equity curve from RUB into the numeraire.
+// Точки, на которые цены единицы ещё нет, пропускаются.
+func Revalue(curve []EquityPoint, numeraire dto.Numeraire) []EquityPoint {
+	revalued := make([]EquityPoint, 0, len(curve))
+	for _, p := range curve {
+		equity, ok := analytics.ToNumeraire(p.Equity, numeraire, p.Time)
+		if !ok {
+			continue
+		}
+		cash, _ := analytics.ToNumeraire(p.Cash, numeraire, p.Time)
+		revalued = append(revalued, EquityPoint{Time: p.Time, Equity: equity, Cash: cash})
+	}
+	return revalued
+}
+
+// Доходности считаются по барам и переводятся в годовые через количество торговых дней,
+// riskFree - годовая безрисковая ставка.
+func returnMetrics(m *Metrics, curve []EquityPoint, riskFree float64) {
+	if len(curve) == 0 {
+		return
+	}
+	first, last := curve[0], curve[len(curve)-1]
+	m.Start, m.End = first.Time, last.Time
+	m.InitialEquity, m.FinalEquity = first.Equity, last.Equity
+	if m.InitialEquity > 0 {
+		m.TotalReturn = m.FinalEquity/m.InitialEquity - 1
+	}
+	years := last.Time.Sub(first.Time).Hours() / 24 / 365.25
+	if years > 0 && m.InitialEquity > 0 && m.FinalEquity > 0 {
+		m.CAGR = math.Pow(m.FinalEquity/m.InitialEquity, 1/years) - 1
+	}
+
+	returns := EquityReturns(curve)
+	if len(returns) > 1 {
+		annual := math.Sqrt(analytics.TradingDays)
+		dailyRiskFree := riskFree / analytics.TradingDays
+		m.Volatility = pkg.StandardDeviation(returns) * annual
+		if m.Volatility > 1e-9 {
+			m.Sharpe = pkg.SharpeRatio(returns, dailyRiskFree) * annual
+		}
+		if downside := DownsideDeviation(returns, dailyRiskFree); downside > 1e-12 {
+			m.Sortino = (pkg.Average(returns) - dailyRiskFree) / downside * annual
+		}
+	}
+	m.MaxDrawdown, m.MaxDrawdownDays = MaxDrawdown(curve)
+	if m.MaxDrawdown > 0 {
+		m.Calmar = m.CAGR / m.MaxDrawdown
+	}
+}
+
+func tradeMetrics(m *Metrics, curve []EquityPoint, fills []Fill) {
+	var exposed int
+	var equitySum float64
+	for _, p := range curve {
+		if p.Equity-p.Cash > 1e-9 {
+			exposed++
+		}
+		equitySum += p.Equity
+	}
+	m.Exposure = float64(exposed) / float64(len(curve))
+	var traded float64
+	for _, f := range fills {
+		traded += f.Value()
+	}
+	years := curve[len(curve)-1].Time.Sub(curve[0].Time).Hours() / 24 / 365.25
+	if years > 0 && equitySum > 0 {
+		m.Turnover = traded / (equitySum / float64(len(curve))) / years
+	}
+
+	trades := Trades(fills)
+	m.Trades = len(trades)
+	var wins int
+	var profit, loss float64
+	for _, t := range trades {
+		if t.PnL > 0 {
+			wins++
+			profit += t.PnL
+		} else {
+			loss -= t.PnL
+		}
+	}
+	if len(trades) > 0 {
+		m.WinRate = float64(wins) / float64(len(trades))
+	}
+	if loss > 0 {
+		m.ProfitFactor = profit / loss
+	}
+}
+
+// EquityReturns calculates returns of the equity between bars.
+func EquityReturns(curve []EquityPoint) []float64 {
+	var returns []float64
+	for i := 1; i < len(curve); i++ {
+		if curve[i-1].Equity <= 0 {
+			continue
+		}
+		returns = append(returns, curve[i].Equity/curve[i-1].Equity-1)
+	}
+	return returns
+}
+
+// DownsideDeviation calculates the deviation of returns below the target.
+func DownsideDeviation(returns []float64, target float64) float64 {
+	if len(returns) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, r := range returns {
+		if r < target {
+			sum += (r - target) * (r - target)
+		}
+	}
+	return math.Sqrt(sum / float64(len(returns)))
+}
+
+// MaxDrawdown returns the largest fall of the equity from the peak and the longest
+// time in days spent below a peak (до восстановления или до конца кривой).
+func MaxDrawdown(curve []EquityPoint) (float64, int) {
+	var maxDrawdown float64
+	var maxDuration time.Duration
+	var peak EquityPoint
+	for i, p := range curve {
+		if i == 0 || p.Equity >= peak.Equity || peak.Equity <= 0 {
+			peak = p
+			continue
+		}
+		dd := 1 - p.Equity/peak.Equity
+		if dd < 1e-9 { // погрешность вычислений
+			continue
+		}
+		if dd > maxDrawdown {
+			maxDrawdown = dd
+		}
+		if d := p.Time.Sub(peak.Time); d > maxDuration {
+			maxDuration = d
+		}
+	}
+	return maxDrawdown, int(maxDuration.Hours() / 24)
+}
@@ -0,0 +1,182 @@
+package backtest
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/pkg"
+)
+
+type Interval struct {
+	Low    float64
+	Median float64
+	High   float64
+}
+
+type MonteCarloResult struct {
+	Method      string
+	Iterations  int
+	Confidence  float64
+	FinalEquity Interval
+	MaxDrawdown Interval
+	Sharpe      Interval
+	LossShare   float64 // доля симуляций, закончившихся убытком
+}
+
+type MonteCarloOptions struct {
+	Iterations int
+	Confidence float64 // 0.95 - интервал от 2.5% до 97.5% перцентиля
+	BlockSize  int     // длина блока бутстрепа, баров
+	Seed       int64
+	Workers    int
+}
+
+// simulate runs `iterations` of the path generator in parallel. У каждой итерации свой
+// генератор случайных чисел от seed, поэтому результат не зависит от числа потоков.
+func simulate(method string, initial float64, annual float64, opts MonteCarloOptions, path func(rng *rand.Rand) []float64) MonteCarloResult {
+	finals := make([]float64, opts.Iterations)
+	drawdowns := make([]float64, opts.Iterations)
+	sharpes := make([]float64, opts.Iterations)
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				returns := path(rand.New(rand.NewSource(opts.Seed + int64(i))))
+				finals[i], drawdowns[i], sharpes[i] = pathStats(initial, returns, annual)
+			}
+		}()
+	}
+	for i := 0; i < opts.Iterations; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	result := MonteCarloResult{
+		Method:      method,
+		Iterations:  opts.Iterations,
+		Confidence:  opts.Confidence,
+		FinalEquity: interval(finals, opts.Confidence),
+		MaxDrawdown: interval(drawdowns, opts.Confidence),
+		Sharpe:      interval(sharpes, opts.Confidence),
+	}
+	var losses int
+	for _, f := range finals {
+		if f < initial {
+			losses++
+		}
+	}
+	if opts.Iterations > 0 {
+		result.LossShare = float64(losses) / float64(opts.Iterations)
+	}
+	return result
+}
+
+func interval(values []float64, confidence float64) Interval {
+	tail := (1 - confidence) / 2
+	return Interval{
+		Low:    pkg.Percentile(values, tail),
+		Median: pkg.Percentile(values, 0.5),
+		High:   pkg.Percentile(values, 1-tail),
+	}
+}
+
+// pathStats returns the final equity, max drawdown and Sharpe of the path of returns
+// multiplied by `annual` (корень из числа периодов в году).
+func pathStats(initial float64, returns []float64, annual float64) (float64, float64, float64) {
+	equity, peak := initial, initial
+	var maxDrawdown float64
+	for _, r := range returns {
+		equity *= 1 + r
+		if equity > peak {
+			peak = equity
+		} else if peak > 0 {
+			maxDrawdown = math.Max(maxDrawdown, 1-equity/peak)
+		}
+	}
+	var sharpe float64
+	if len(returns) > 1 && pkg.StandardDeviation(returns) > 1e-12 {
+		sharpe = pkg.SharpeRatio(returns, 0) * annual
+	}
+	return equity, maxDrawdown, sharpe
+}
+
+// tradeWeight returns the share of the equity in the trade at its opening.
+func tradeWeight(t Trade, curve []EquityPoint) float64 {
+	i := sort.Search(len(curve), func(i int) bool {
+		return curve[i].Time.After(t.Open)
+	})
+	if i > 0 {
+		i--
+	}
+	if len(curve) == 0 || curve[i].Equity <= 0 {
+		return 1
+	}
+	return t.Cost / curve[i].Equity
+}
+
+// BlockBootstrap resamples the returns of bars by circular blocks: соседние доходности
+// остаются вместе, и автокорреляция внутри блока сохраняется.
+func BlockBootstrap(curve []EquityPoint, opts MonteCarloOptions) MonteCarloResult {
+	returns := EquityReturns(curve)
+	var initial float64
+	if len(curve) > 0 {
+		initial = curve[0].Equity
+	}
+	block := opts.BlockSize
+	if block <= 0 {
+		block = 1
+	}
+	return simulate("block bootstrap", initial, math.Sqrt(analytics.TradingDays), opts, func(rng *rand.Rand) []float64 {
+		path := make([]float64, 0, len(returns))
+		for len(returns) > 0 && len(path) < len(returns) {
+			start := rng.Intn(len(returns))
+			for j := 0; j < block && len(path) < len(returns); j++ {
+				path = append(path, returns[(start+j)%len(returns)])
+			}
+		}
+		return path
+	})
+}
+
+// ShuffleTrades reorders the returns of trades (`replace` - sampling with replacement).
+// Перестановка без возвращения меняет только путь и просадку, с возвращением - и итог.
+// Доходность сделки взвешивается долей капитала в ней при входе по кривой капитала,
+// поэтому частичные позиции не раздувают разброс. Шарп считается по сделкам без перевода в годовой.
+func ShuffleTrades(trades []Trade, curve []EquityPoint, replace bool, opts MonteCarloOptions) MonteCarloResult {
+	var initial float64
+	if len(curve) > 0 {
+		initial = curve[0].Equity
+	}
+	returns := make([]float64, len(trades))
+	for i, t := range trades {
+		returns[i] = t.Return * tradeWeight(t, curve)
+	}
+	method := "trade shuffle"
+	if replace {
+		method = "trade bootstrap"
+	}
+	return simulate(method, initial, 1, opts, func(rng *rand.Rand) []float64 {
+		path := make([]float64, len(returns))
+		if replace {
+			for i := range path {
+				path[i] = returns[rng.Intn(len(returns))]
+			}
+			return path
+		}
+		for i, j := range rng.Perm(len(returns)) {
+			path[i] = returns[j]
+		}
+		return path
+	})
+}
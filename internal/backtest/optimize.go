@@ -0,0 +1,265 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg"
+)
+
+// Params is a set of named parameter values of the strategy.
+type Params map[string]float64
+
+// ParamRange is the range of values of the parameter from Min to Max with Step.
+type ParamRange struct {
+	Name string
+	Min  float64
+	Max  float64
+	Step float64
+}
+
+func (r ParamRange) values() []float64 {
+	if r.Step <= 0 || r.Max <= r.Min {
+		return []float64{r.Min}
+	}
+	var values []float64
+	for i := 0; ; i++ {
+		v := r.Min + float64(i)*r.Step
+		if v > r.Max+r.Step*1e-9 {
+			break
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// Grid returns all combinations of parameter values.
+func Grid(ranges []ParamRange) []Params {
+	grid := []Params{{}}
+	for _, r := range ranges {
+		var next []Params
+		for _, p := range grid {
+			for _, v := range r.values() {
+				params := make(Params, len(p)+1)
+				for name, value := range p {
+					params[name] = value
+				}
+				params[r.Name] = v
+				next = append(next, params)
+			}
+		}
+		grid = next
+	}
+	return grid
+}
+
+// RandomSearch returns `n` random combinations of values on the grid of the ranges.
+func RandomSearch(ranges []ParamRange, n int, seed int64) []Params {
+	rng := rand.New(rand.NewSource(seed))
+	samples := make([]Params, n)
+	for i := range samples {
+		samples[i] = make(Params, len(ranges))
+		for _, r := range ranges {
+			values := r.values()
+			samples[i][r.Name] = values[rng.Intn(len(values))]
+		}
+	}
+	return samples
+}
+
+// Runner runs the backtest of the strategy with the parameters over the bars.
+// Каждый запуск должен создавать свои стратегию и брокера: запуски идут параллельно.
+type Runner func(params Params, bars []TimePrices) Result
+
+// MetricValue returns the metric to maximize by its name. Просадка берётся со знаком минус.
+func MetricValue(m Metrics, name string) (float64, error) {
+	switch name {
+	case "return":
+		return m.TotalReturn, nil
+	case "cagr":
+		return m.CAGR, nil
+	case "sharpe":
+		return m.Sharpe, nil
+	case "sortino":
+		return m.Sortino, nil
+	case "calmar":
+		return m.Calmar, nil
+	case "maxDrawdown":
+		return -m.MaxDrawdown, nil
+	case "profitFactor":
+		return m.ProfitFactor, nil
+	case "winRate":
+		return m.WinRate, nil
+	}
+	return 0, fmt.Errorf("unknown metric `%s`", name)
+}
+
+type OptimizationResult struct {
+	Params  Params
+	Metrics Metrics
+	Score   float64
+}
+
+// Optimizer runs the backtest over the candidate parameters in parallel and ranks them by the metric.
+type Optimizer struct {
+	Run     Runner
+	Metric  string
+	Workers int
+}
+
+// Optimize runs the candidates on the bars and sorts results from the best. Метрики считаются
+// с бара `from`, более ранние бары нужны стратегии для разогрева индикаторов.
+func (o Optimizer) Optimize(candidates []Params, bars []TimePrices, from int) ([]OptimizationResult, error) {
+	if _, err := MetricValue(Metrics{}, o.Metric); err != nil {
+		return nil, fmt.Errorf("Optimizer.Optimize: %w", err)
+	}
+	if from < 0 || from >= len(bars) {
+		return nil, fmt.Errorf("Optimizer.Optimize: no bars from %d", from)
+	}
+	results := make([]OptimizationResult, len(candidates))
+	workers := o.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result := o.Run(candidates[i], bars)
+				metrics := windowMetrics(result, bars[from].Time)
+				score, _ := MetricValue(metrics, o.Metric)
+				results[i] = OptimizationResult{Params: candidates[i], Metrics: metrics, Score: score}
+			}
+		}()
+	}
+	for i := range candidates {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// стабильная сортировка сохраняет порядок кандидатов при равных оценках
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results, nil
+}
+
+// windowMetrics calculates metrics in RUB on the part of the backtest starting at `from`.
+func windowMetrics(result Result, from time.Time) Metrics {
+	var curve []EquityPoint
+	for _, p := range result.Equity {
+		if !p.Time.Before(from) {
+			curve = append(curve, p)
+		}
+	}
+	var fills []Fill
+	for _, f := range result.Fills {
+		if !f.Time.Before(from) {
+			fills = append(fills, f)
+		}
+	}
+	return CalculateMetrics("", curve, fills, dto.Numeraire{Name: "RUB"})
+}
+
+type WalkForwardWindow struct {
+	InSampleStart    time.Time
+	OutOfSampleStart time.Time
+	OutOfSampleEnd   time.Time
+	Best             Params
+	InSample         Metrics
+	OutOfSample      Metrics
+	InSampleScore    float64
+	OutOfSampleScore float64
+}
+
+// WalkForward optimizes the parameters on `inSample` bars and checks the best of them on the next
+// `outOfSample` bars, then moves the windows by `outOfSample`. Вне выборки стратегия
+// запускается с начала окна оптимизации, чтобы индикаторы успели разогреться.
+func (o Optimizer) WalkForward(candidates []Params, bars []TimePrices, inSample, outOfSample int) ([]WalkForwardWindow, error) {
+	if inSample <= 0 || outOfSample <= 0 {
+		return nil, fmt.Errorf("Optimizer.WalkForward: windows must be positive")
+	}
+	var windows []WalkForwardWindow
+	for start := 0; start+inSample+outOfSample <= len(bars); start += outOfSample {
+		results, err := o.Optimize(candidates, bars[start:start+inSample], 0)
+		if err != nil {
+			return nil, fmt.Errorf("Optimizer.WalkForward: %w", err)
+		}
+		if len(results) == 0 {
+			break
+		}
+		best := results[0]
+		end := start + inSample + outOfSample
+		oos := windowMetrics(o.Run(best.Params, bars[start:end]), bars[start+inSample].Time)
+		score, _ := MetricValue(oos, o.Metric)
+		windows = append(windows, WalkForwardWindow{
+			InSampleStart:    bars[start].Time,
+			OutOfSampleStart: bars[start+inSample].Time,
+			OutOfSampleEnd:   bars[end-1].Time,
+			Best:             best.Params,
+			InSample:         best.Metrics,
+			OutOfSample:      oos,
+			InSampleScore:    best.Score,
+			OutOfSampleScore: score,
+		})
+	}
+	return windows, nil
+}
+
+// ParamStability shows how the best value of the parameter changes between walk-forward windows.
+// Большой разброс (CV) - признак подгонки под историю.
+type ParamStability struct {
+	Name   string
+	Values []float64
+	Mean   float64
+	StdDev float64
+	CV     float64 // коэффициент вариации
+}
+
+// Stability calculates the stability of the best parameters over walk-forward windows.
+func Stability(windows []WalkForwardWindow) []ParamStability {
+	var names []string
+	if len(windows) > 0 {
+		for name := range windows[0].Best {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	stability := make([]ParamStability, 0, len(names))
+	for _, name := range names {
+		s := ParamStability{Name: name}
+		for _, w := range windows {
+			s.Values = append(s.Values, w.Best[name])
+		}
+		s.Mean = pkg.Average(s.Values)
+		s.StdDev = pkg.StandardDeviation(s.Values)
+		if s.Mean != 0 {
+			s.CV = s.StdDev / math.Abs(s.Mean)
+		}
+		stability = append(stability, s)
+	}
+	return stability
+}
+
+// WalkForwardEfficiency is the ratio of the average score out of sample to the average score
+// in sample. Близко к 1 - результат на истории переносится на новые данные.
+func WalkForwardEfficiency(windows []WalkForwardWindow) float64 {
+	var in, out float64
+	for _, w := range windows {
+		in += w.InSampleScore
+		out += w.OutOfSampleScore
+	}
+	if in == 0 {
+		return 0
+	}
+	return out / in
+}
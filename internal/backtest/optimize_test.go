@@ -0,0 +1,99 @@
+package backtest
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+var day0 = time.Date(2022, 1, 3, 10, 0, 0, 0, time.UTC)
+
+func TestGrid(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []ParamRange
+		want   []Params
+	}{
+		// 0.1 + 2·0.1 чуть больше 0.3, верхняя граница всё равно входит
+		{"float step", []ParamRange{{Name: "x", Min: 0.1, Max: 0.3, Step: 0.1}},
+			[]Params{{"x": 0.1}, {"x": 0.2}, {"x": 0.3}}},
+		{"step over max", []ParamRange{{Name: "x", Min: 1, Max: 2.5, Step: 1}},
+			[]Params{{"x": 1}, {"x": 2}}},
+		{"no step", []ParamRange{{Name: "x", Min: 5, Max: 10}}, []Params{{"x": 5}}},
+		{"two ranges", []ParamRange{{Name: "x", Min: 1, Max: 2, Step: 1}, {Name: "y", Min: 10, Max: 20, Step: 10}},
+			[]Params{{"x": 1, "y": 10}, {"x": 1, "y": 20}, {"x": 2, "y": 10}, {"x": 2, "y": 20}}},
+		{"no ranges", nil, []Params{{}}},
+	}
+	for _, tt := range tests {
+		got := Grid(tt.ranges)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: Grid = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			for name, v := range tt.want[i] {
+				if math.Abs(got[i][name]-v) > 1e-12 || len(got[i]) != len(tt.want[i]) {
+					t.Errorf("%s: Grid[%d] = %v, want %v", tt.name, i, got[i], tt.want[i])
+				}
+			}
+		}
+	}
+}
+
+func TestWalkForward(t *testing.T) {
+	bars := make([]TimePrices, 11)
+	for i := range bars {
+		bars[i] = TimePrices{Time: day0.AddDate(0, 0, i)}
+	}
+	var mu sync.Mutex
+	lengths := make(map[int]int)
+	// капитал растёт на x% за бар, лучший параметр - наибольший
+	run := func(params Params, bars []TimePrices) Result {
+		mu.Lock()
+		lengths[len(bars)]++
+		mu.Unlock()
+		var result Result
+		equity := 100.0
+		for _, b := range bars {
+			result.Equity = append(result.Equity, EquityPoint{Time: b.Time, Equity: equity})
+			equity *= 1 + params["x"]/100
+		}
+		return result
+	}
+	optimizer := Optimizer{Run: run, Metric: "return", Workers: 2}
+	windows, err := optimizer.WalkForward(Grid([]ParamRange{{Name: "x", Min: 1, Max: 3, Step: 1}}), bars, 4, 2)
+	if err != nil {
+		t.Fatalf("WalkForward: %v", err)
+	}
+	// окна начинаются с 0, 2 и 4; с 6 на выборку вне оптимизации остаётся один бар
+	starts := []int{0, 2, 4}
+	if len(windows) != len(starts) {
+		t.Fatalf("WalkForward returned %d windows, want %d", len(windows), len(starts))
+	}
+	for i, w := range windows {
+		s := starts[i]
+		if !w.InSampleStart.Equal(bars[s].Time) || !w.OutOfSampleStart.Equal(bars[s+4].Time) || !w.OutOfSampleEnd.Equal(bars[s+5].Time) {
+			t.Errorf("window %d: %v - %v - %v, want bars %d, %d and %d", i, w.InSampleStart, w.OutOfSampleStart, w.OutOfSampleEnd, s, s+4, s+5)
+		}
+		if w.Best["x"] != 3 {
+			t.Errorf("window %d: best %v, want x = 3", i, w.Best)
+		}
+		// вне выборки метрики считаются с OutOfSampleStart: два бара, один шаг роста
+		if !near(w.OutOfSample.TotalReturn, 0.03) {
+			t.Errorf("window %d: out of sample return %v, want 0.03", i, w.OutOfSample.TotalReturn)
+		}
+	}
+	// оптимизация идёт на 4 барах, проверка - на 6 с разогревом
+	if lengths[4] != 3*3 || lengths[6] != 3 || len(lengths) != 2 {
+		t.Errorf("runs by bars %v, want 9 on 4 bars and 3 on 6", lengths)
+	}
+
+	if _, err := optimizer.WalkForward(nil, bars, 0, 2); err == nil {
+		t.Error("empty window: expected error")
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
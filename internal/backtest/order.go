@@ -0,0 +1,77 @@
+package backtest
+
+import (
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+type Side int
+
+const (
+	SideBuy Side = iota
+	SideSell
+)
+
+func (s Side) String() string {
+	return [...]string{"buy", "sell"}[s]
+}
+
+type OrderType int
+
+const (
+	// OrderMarket is executed at the open of the next bar
+	OrderMarket OrderType = iota
+	// OrderLimit is executed at LimitPrice or better
+	OrderLimit
+	// OrderStop becomes a market order when the price reaches StopPrice
+	OrderStop
+	// OrderStopLimit becomes a limit order at LimitPrice when the price reaches StopPrice
+	OrderStopLimit
+	// OrderTrailingStop is a stop that follows the best price by TrailPercent or TrailATR
+	OrderTrailingStop
+)
+
+func (t OrderType) String() string {
+	return [...]string{"market", "limit", "stop", "stop-limit", "trailing-stop"}[t]
+}
+
+// Order is executed by the broker starting from the next bar of the instrument.
+// Заявки кроме рыночных действуют до исполнения или отмены.
+// Если не заданы ни Quantity, ни Value - покупка на все свободные деньги или продажа всей позиции.
+type Order struct {
+	ID         int
+	Isin       dto.Isin
+	Side       Side
+	Type       OrderType
+	Quantity   float64 // штук
+	Value      float64 // RUB, если Quantity не задано
+	LimitPrice float64
+	StopPrice  float64
+	// Трейлинг-стоп: отступ от лучшей цены после выставления в долях цены или в ATR
+	TrailPercent float64
+	TrailATR     float64
+	// Заявки с одинаковой ненулевой группой отменяют друг друга при исполнении одной из них (OCO)
+	Group int
+	Time  time.Time
+
+	triggered bool    // стоп-лимит сработал и стал лимитной заявкой
+	extreme   float64 // лучшая цена для трейлинг-стопа
+}
+
+type Fill struct {
+	OrderID    int
+	Isin       dto.Isin
+	Side       Side
+	Type       OrderType
+	Quantity   float64
+	Price      float64 // с учётом проскальзывания
+	Commission float64 // RUB
+	Slippage   float64 // потери на проскальзывании, RUB
+	Time       time.Time
+}
+
+// Value returns the amount of the fill in RUB without the commission.
+func (f Fill) Value() float64 {
+	return f.Quantity * f.Price
+}
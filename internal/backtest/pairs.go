@@ -0,0 +1,186 @@
+package backtest
+
+import (
+	"math"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+type PairsOptions struct {
+	Formation int // баров для поиска пар и коэффициента хеджирования, 0 - 120
+	Refit     int // баров между поисками пар, 0 - 20
+	// Отклонения спреда в стандартных отклонениях: вход, выход и стоп при расхождении.
+	// Entry 0 - 2, Stop 0 - без стопа
+	Entry    float64
+	Exit     float64
+	Stop     float64
+	MaxPairs int // 0 - 3, капитал делится между ними поровну
+	Pair     analytics.PairOptions
+	Exclude  []dto.Isin
+}
+
+// PairsStrategy is a long-only mean-reversion entry filter on cointegrated pairs, not a hedged
+// spread trade: брокер без шортов, поэтому при расхождении спреда покупается только недооценённая
+// нога, а переоценённая не продаётся. Коэффициент хеджирования нужен лишь для z-score спреда,
+// позиция от движения второй ноги не защищена. Пары ищутся по окну последних баров
+// и пересматриваются каждые Refit баров; инструмент входит только в одну пару.
+type PairsStrategy struct {
+	opts    PairsOptions
+	exclude map[dto.Isin]bool
+	candles map[dto.Isin][]dto.Candle // свечи за окно формирования
+	bars    int
+	pairs   []*pairState
+}
+
+type pairState struct {
+	pair dto.Pair
+	// после стопа вход только после возврата спреда внутрь порога входа
+	stopped bool
+}
+
+func NewPairsStrategy(opts PairsOptions) *PairsStrategy {
+	if opts.Formation <= 0 {
+		opts.Formation = 120
+	}
+	if opts.Refit <= 0 {
+		opts.Refit = 20
+	}
+	if opts.Entry <= 0 {
+		opts.Entry = 2
+	}
+	if opts.MaxPairs <= 0 {
+		opts.MaxPairs = 3
+	}
+	s := &PairsStrategy{
+		opts:    opts,
+		exclude: make(map[dto.Isin]bool),
+		candles: make(map[dto.Isin][]dto.Candle),
+	}
+	for _, isin := range opts.Exclude {
+		s.exclude[isin] = true
+	}
+	return s
+}
+
+// Pairs returns the pairs traded after the last refit.
+func (s *PairsStrategy) Pairs() []dto.Pair {
+	pairs := make([]dto.Pair, len(s.pairs))
+	for i, p := range s.pairs {
+		pairs[i] = p.pair
+	}
+	return pairs
+}
+
+func (s *PairsStrategy) OnBar(ctx *Context, bar TimePrices) {
+	for _, isin := range bar.Isins() {
+		if s.exclude[isin] || bar.Prices[isin].Close <= 0 {
+			continue
+		}
+		candles := append(s.candles[isin], bar.Prices[isin])
+		if len(candles) > s.opts.Formation {
+			candles = candles[len(candles)-s.opts.Formation:]
+		}
+		s.candles[isin] = candles
+	}
+	s.bars++
+	if len(ctx.Broker.Pending()) > 0 {
+		return
+	}
+	if s.bars >= s.opts.Formation && (s.bars-s.opts.Formation)%s.opts.Refit == 0 {
+		s.refit(ctx)
+	}
+
+	equity := ctx.Broker.Equity()
+	for _, p := range s.pairs {
+		z, ok := s.zscore(p.pair)
+		if !ok {
+			continue
+		}
+		a, b := p.pair.A, p.pair.B
+		switch {
+		case ctx.Broker.Position(a) > 0:
+			stop := s.opts.Stop > 0 && z <= -s.opts.Stop
+			if z >= -s.opts.Exit || stop {
+				ctx.Broker.Submit(Order{Isin: a, Side: SideSell})
+				p.stopped = stop
+			}
+		case ctx.Broker.Position(b) > 0:
+			stop := s.opts.Stop > 0 && z >= s.opts.Stop
+			if z <= s.opts.Exit || stop {
+				ctx.Broker.Submit(Order{Isin: b, Side: SideSell})
+				p.stopped = stop
+			}
+		case p.stopped:
+			p.stopped = math.Abs(z) >= s.opts.Entry
+		case z <= -s.opts.Entry:
+			s.buy(ctx, a, bar, equity)
+		case z >= s.opts.Entry:
+			s.buy(ctx, b, bar, equity)
+		}
+	}
+}
+
+func (s *PairsStrategy) OnFill(ctx *Context, fill Fill) {}
+
+// buy opens the position with the equal share of the equity.
+func (s *PairsStrategy) buy(ctx *Context, isin dto.Isin, bar TimePrices, equity float64) {
+	if _, exists := bar.Prices[isin]; !exists {
+		return
+	}
+	value := math.Min(equity/float64(s.opts.MaxPairs), ctx.Broker.Cash())
+	if value <= 0 {
+		return
+	}
+	ctx.Broker.Submit(Order{Isin: isin, Side: SideBuy, Value: value})
+}
+
+// refit searches pairs again. Позиции инструментов, выпавших из пар, закрываются,
+// у оставшихся пар обновляется коэффициент хеджирования.
+func (s *PairsStrategy) refit(ctx *Context) {
+	found := analytics.DisjointPairs(analytics.FindPairs(s.candles, s.opts.Pair), s.opts.MaxPairs)
+	previous := make(map[[2]dto.Isin]*pairState)
+	for _, p := range s.pairs {
+		previous[pairKey(p.pair)] = p
+	}
+	kept := make(map[dto.Isin]bool)
+	pairs := make([]*pairState, 0, len(found))
+	for _, pair := range found {
+		state := previous[pairKey(pair)]
+		if state == nil {
+			state = &pairState{}
+		}
+		state.pair = pair
+		pairs = append(pairs, state)
+		kept[pair.A], kept[pair.B] = true, true
+	}
+	for _, p := range s.pairs {
+		for _, isin := range []dto.Isin{p.pair.A, p.pair.B} {
+			if !kept[isin] && ctx.Broker.Position(isin) > 0 {
+				ctx.Broker.Submit(Order{Isin: isin, Side: SideSell})
+			}
+		}
+	}
+	s.pairs = pairs
+}
+
+// pairKey identifies the pair regardless of the direction of the regression.
+func pairKey(p dto.Pair) [2]dto.Isin {
+	if p.A < p.B {
+		return [2]dto.Isin{p.A, p.B}
+	}
+	return [2]dto.Isin{p.B, p.A}
+}
+
+// zscore calculates the last deviation of the spread over the formation window.
+func (s *PairsStrategy) zscore(pair dto.Pair) (float64, bool) {
+	a, b := analytics.AlignCandles(s.candles[pair.A], s.candles[pair.B])
+	if len(a) < 2 {
+		return 0, false
+	}
+	spread := make([]float64, len(a))
+	for i := range a {
+		spread[i] = math.Log(a[i].Close) - pair.Alpha - pair.HedgeRatio*math.Log(b[i].Close)
+	}
+	return analytics.ZScore(spread), true
+}
@@ -0,0 +1,168 @@
+package backtest
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/internal/sizing"
+)
+
+type PairwiseOptions struct {
+	Exclude  []dto.Isin
+	Tradable func(isin dto.Isin, t time.Time) bool // nil - всегда
+	// Размер покупки, nil - все свободные деньги
+	Sizing    sizing.Policy
+	MaxWeight float64 // максимальная доля капитала в позиции, 0 - без ограничения
+	ATRPeriod int     // 0 - 14
+	Window    int     // дней для волатильности, 0 - 60
+}
+
+// PairwiseStrategy moves the portfolio into the instrument that fell behind
+// another one the most on the bar ("buy the laggard").
+type PairwiseStrategy struct {
+	opts    PairwiseOptions
+	exclude map[dto.Isin]bool
+	prev    TimePrices
+	atr     map[dto.Isin]*analytics.ATRStream
+	returns map[dto.Isin][]float64 // дневные доходности за окно
+	equity  []float64              // капитал на закрытии баров за окно
+}
+
+// NewPairwiseStrategy creates the strategy. Excluded instruments are not traded.
+func NewPairwiseStrategy(opts PairwiseOptions) *PairwiseStrategy {
+	if opts.ATRPeriod <= 0 {
+		opts.ATRPeriod = 14
+	}
+	if opts.Window <= 0 {
+		opts.Window = 60
+	}
+	s := &PairwiseStrategy{
+		opts:    opts,
+		exclude: make(map[dto.Isin]bool),
+		atr:     make(map[dto.Isin]*analytics.ATRStream),
+		returns: make(map[dto.Isin][]float64),
+	}
+	for _, isin := range opts.Exclude {
+		s.exclude[isin] = true
+	}
+	return s
+}
+
+func (s *PairwiseStrategy) window(values []float64, v float64) []float64 {
+	values = append(values, v)
+	if len(values) > s.opts.Window {
+		values = values[len(values)-s.opts.Window:]
+	}
+	return values
+}
+
+// update keeps the ATR and returns of the instruments and the equity for sizing.
+func (s *PairwiseStrategy) update(ctx *Context, prev, bar TimePrices) {
+	s.equity = s.window(s.equity, ctx.Broker.Equity())
+	for isin, candle := range bar.Prices {
+		stream, exists := s.atr[isin]
+		if !exists {
+			stream = analytics.NewATRStream(s.opts.ATRPeriod)
+			s.atr[isin] = stream
+		}
+		stream.Update(candle)
+		if before := prev.Prices[isin].Close; before > 0 && candle.Close > 0 {
+			s.returns[isin] = s.window(s.returns[isin], candle.Close/before-1)
+		}
+	}
+}
+
+// buy submits the purchase sized by the policy. `cash` - деньги после продажи текущей позиции.
+func (s *PairwiseStrategy) buy(ctx *Context, isin dto.Isin, price float64, cash float64) {
+	if s.opts.Sizing == nil {
+		ctx.Broker.Submit(Order{Isin: isin, Side: SideBuy})
+		return
+	}
+	var returns []float64
+	for i := 1; i < len(s.equity); i++ {
+		if s.equity[i-1] > 0 {
+			returns = append(returns, s.equity[i]/s.equity[i-1]-1)
+		}
+	}
+	value := sizing.Size(s.opts.Sizing, sizing.Input{
+		Equity:           ctx.Broker.Equity(),
+		Cash:             cash,
+		Price:            price,
+		ATR:              s.atr[isin].Value(),
+		Returns:          s.returns[isin],
+		PortfolioReturns: returns,
+		Slots:            1,
+	}, s.opts.MaxWeight)
+	if value > 0 {
+		ctx.Broker.Submit(Order{Isin: isin, Side: SideBuy, Value: value})
+	}
+}
+
+func (s *PairwiseStrategy) OnBar(ctx *Context, bar TimePrices) {
+	prev := s.prev
+	s.prev = bar
+	s.update(ctx, prev, bar)
+	if prev.Prices == nil {
+		return
+	}
+
+	changes := make(map[dto.Isin]float64)
+	var isins []dto.Isin
+	for _, isin := range bar.Isins() {
+		before := prev.Prices[isin].Close
+		if before <= 0 || s.exclude[isin] {
+			continue
+		}
+		changes[isin] = (bar.Prices[isin].Close - before) / before * 100
+		isins = append(isins, isin)
+	}
+
+	type diffResult struct {
+		Active1        dto.Isin
+		Active2        dto.Isin
+		DiffPercentage float64
+	}
+	var diffs []diffResult
+	for _, isin := range isins {
+		for _, isin2 := range isins {
+			diff := changes[isin] - changes[isin2]
+			if diff == 0 {
+				continue
+			}
+			diffs = append(diffs, diffResult{Active1: isin, Active2: isin2, DiffPercentage: diff})
+		}
+	}
+	// Сортируем по возрастанию разницы: первой идёт пара с самым отставшим Active1
+	sort.SliceStable(diffs, func(i, j int) bool {
+		return diffs[i].DiffPercentage < diffs[j].DiffPercentage
+	})
+
+	for _, d := range diffs {
+		if d.DiffPercentage >= 0 {
+			break
+		}
+		if !s.isTradable(d.Active1, bar.Time) || !s.isTradable(d.Active2, bar.Time) {
+			continue
+		}
+		price := bar.Prices[d.Active1].Close
+		// переводим актив из опередившего в отставший
+		if position := ctx.Broker.Position(d.Active2); position > 0 {
+			ctx.Broker.Submit(Order{Isin: d.Active2, Side: SideSell})
+			s.buy(ctx, d.Active1, price, ctx.Broker.Cash()+position*bar.Prices[d.Active2].Close)
+			return
+		}
+		// покупаем, только если нет позиций
+		if len(ctx.Broker.Positions()) == 0 && ctx.Broker.Cash() > 0 {
+			s.buy(ctx, d.Active1, price, ctx.Broker.Cash())
+			return
+		}
+	}
+}
+
+func (s *PairwiseStrategy) OnFill(ctx *Context, fill Fill) {}
+
+func (s *PairwiseStrategy) isTradable(isin dto.Isin, t time.Time) bool {
+	return s.opts.Tradable == nil || s.opts.Tradable(isin, t)
+}
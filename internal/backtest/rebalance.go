@@ -0,0 +1,159 @@
+package backtest
+
+import (
+	"math"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// WeightMethod returns target weights of the instruments by the covariance of their daily returns.
+type WeightMethod func(cov dto.Matrix) map[dto.Isin]float64
+
+// FixedWeights returns the method with the same weights on every rebalance.
+func FixedWeights(weights map[dto.Isin]float64) WeightMethod {
+	return func(cov dto.Matrix) map[dto.Isin]float64 {
+		return analytics.NormalizeWeights(weights, cov.Isins)
+	}
+}
+
+// EqualWeights splits the portfolio equally.
+func EqualWeights(cov dto.Matrix) map[dto.Isin]float64 {
+	return analytics.EqualWeights(cov.Isins)
+}
+
+type RebalanceOptions struct {
+	Method WeightMethod
+	// Календарная ребалансировка: week, month, quarter, year; пусто - только по порогу
+	Period string
+	// Ребалансировка при отклонении доли инструмента от целевой больше порога, 0 - только по календарю
+	Threshold float64
+	Window    int // баров для ковариации, 0 - 60
+	Exclude   []dto.Isin
+}
+
+// RebalanceStrategy holds the instruments in target weights and returns to them by the calendar
+// or when weights drift away. Пока истории меньше окна, веса равные.
+type RebalanceStrategy struct {
+	opts    RebalanceOptions
+	exclude map[dto.Isin]bool
+	closes  map[dto.Isin][]float64 // цены закрытия за окно
+	period  int                    // номер последнего календарного периода
+	started bool
+}
+
+func NewRebalanceStrategy(opts RebalanceOptions) *RebalanceStrategy {
+	if opts.Method == nil {
+		opts.Method = EqualWeights
+	}
+	if opts.Window <= 0 {
+		opts.Window = 60
+	}
+	s := &RebalanceStrategy{
+		opts:    opts,
+		exclude: make(map[dto.Isin]bool),
+		closes:  make(map[dto.Isin][]float64),
+	}
+	for _, isin := range opts.Exclude {
+		s.exclude[isin] = true
+	}
+	return s
+}
+
+// periodOf numbers calendar periods so that a change of the number starts a new period.
+func periodOf(t time.Time, period string) int {
+	switch period {
+	case "week":
+		year, week := t.ISOWeek()
+		return year*100 + week
+	case "month":
+		return t.Year()*100 + int(t.Month())
+	case "quarter":
+		return t.Year()*10 + (int(t.Month())-1)/3
+	case "year":
+		return t.Year()
+	}
+	return 0
+}
+
+func (s *RebalanceStrategy) OnBar(ctx *Context, bar TimePrices) {
+	var isins []dto.Isin
+	for _, isin := range bar.Isins() {
+		if !s.exclude[isin] && bar.Prices[isin].Close > 0 {
+			isins = append(isins, isin)
+		}
+	}
+	if len(isins) == 0 {
+		return
+	}
+	for _, isin := range isins {
+		closes := append(s.closes[isin], bar.Prices[isin].Close)
+		if len(closes) > s.opts.Window+1 {
+			closes = closes[len(closes)-s.opts.Window-1:]
+		}
+		s.closes[isin] = closes
+	}
+	if len(ctx.Broker.Pending()) > 0 {
+		return
+	}
+
+	targets := s.targets(isins)
+	equity := ctx.Broker.Equity()
+	period := periodOf(bar.Time, s.opts.Period)
+	rebalance := !s.started || (s.opts.Period != "" && period != s.period)
+	if !rebalance && s.opts.Threshold > 0 && equity > 0 {
+		for _, isin := range isins {
+			weight := ctx.Broker.Position(isin) * bar.Prices[isin].Close / equity
+			if math.Abs(weight-targets[isin]) > s.opts.Threshold {
+				rebalance = true
+				break
+			}
+		}
+	}
+	s.period = period
+	if !rebalance {
+		return
+	}
+	s.started = true
+
+	// продажи исполняются раньше покупок, поэтому деньги от них сразу идут на покупки
+	for _, isin := range isins {
+		price := bar.Prices[isin].Close
+		position := ctx.Broker.Position(isin)
+		diff := targets[isin]*equity - position*price
+		// мелкие сделки не окупают комиссию
+		if math.Abs(diff) < equity*0.001 {
+			continue
+		}
+		if diff < 0 {
+			ctx.Broker.Submit(Order{Isin: isin, Side: SideSell, Quantity: math.Min(position, -diff/price)})
+		} else {
+			ctx.Broker.Submit(Order{Isin: isin, Side: SideBuy, Value: diff})
+		}
+	}
+}
+
+func (s *RebalanceStrategy) OnFill(ctx *Context, fill Fill) {}
+
+// targets calculates the weights by the returns of the window common to all instruments.
+func (s *RebalanceStrategy) targets(isins []dto.Isin) map[dto.Isin]float64 {
+	n := s.opts.Window + 1
+	for _, isin := range isins {
+		if len(s.closes[isin]) < n {
+			n = len(s.closes[isin])
+		}
+	}
+	if n <= s.opts.Window {
+		return analytics.EqualWeights(isins)
+	}
+	returns := make([][]float64, len(isins))
+	for k, isin := range isins {
+		closes := s.closes[isin][len(s.closes[isin])-n:]
+		for i := 1; i < n; i++ {
+			returns[k] = append(returns[k], closes[i]/closes[i-1]-1)
+		}
+	}
+	weights := s.opts.Method(analytics.CovarianceMatrix(isins, returns))
+	return analytics.NormalizeWeights(weights, isins)
+}
@@ -0,0 +1,16 @@
+package backtest
+
+// Context gives the strategy access to the simulated time and the broker.
+type Context struct {
+	Clock  *Clock
+	Broker Broker
+}
+
+// Strategy reacts to market events. The strategy sees only the current and past bars,
+// orders placed on a bar are executed not earlier than on the next one.
+type Strategy interface {
+	// OnBar is called after the close of the bar
+	OnBar(ctx *Context, bar TimePrices)
+	// OnFill is called when the order is executed
+	OnFill(ctx *Context, fill Fill)
+}
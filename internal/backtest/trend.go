@@ -0,0 +1,218 @@
+package backtest
+
+import (
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/internal/sizing"
+)
+
+type TrendOptions struct {
+	Swing int // период свингов
+	Fast  int // периоды скользящих средних
+	Slow  int
+	Trail float64 // трейлинг-стоп в ATR, 0 - без него
+	// Размер новой позиции, nil - капитал поровну между инструментами
+	Sizing    sizing.Policy
+	MaxWeight float64 // максимальная доля капитала в позиции, 0 - без ограничения
+	ATRPeriod int     // 0 - 14
+	Window    int     // дней для волатильности, 0 - 60
+	Exclude   []dto.Isin
+	Tradable  func(isin dto.Isin, t time.Time) bool
+}
+
+// TrendStrategy holds instruments in the up trend by swings while the fast moving average
+// is above the slow one. Позиция защищена стопом под последним минимумом свинга, который
+// подтягивается за новыми минимумами, и, если задан, трейлинг-стопом по ATR: стопы в одной группе OCO.
+type TrendStrategy struct {
+	opts    TrendOptions
+	stream  analytics.StreamOptions
+	exclude map[dto.Isin]bool
+	engines map[dto.Isin]*analytics.StreamEngine
+	lows    map[dto.Isin]float64 // последний минимум свинга
+	atr     map[dto.Isin]float64
+	returns map[dto.Isin][]float64 // дневные доходности за окно
+	closes  map[dto.Isin]float64
+	equity  []float64 // капитал на закрытии баров за окно
+	stops   map[dto.Isin]*protection
+	groups  int
+}
+
+// Защитные заявки позиции
+type protection struct {
+	group int
+	swing int     // ID стопа под минимумом свинга, 0 - нет
+	level float64 // цена этого стопа
+	trail int     // ID трейлинг-стопа, 0 - нет
+}
+
+func NewTrendStrategy(opts TrendOptions) *TrendStrategy {
+	if opts.Sizing == nil {
+		opts.Sizing = sizing.EqualShare{}
+	}
+	if opts.ATRPeriod <= 0 {
+		opts.ATRPeriod = 14
+	}
+	if opts.Window <= 0 {
+		opts.Window = 60
+	}
+	s := &TrendStrategy{
+		opts: opts,
+		stream: analytics.StreamOptions{
+			SwingPeriod: opts.Swing,
+			MAPeriods:   []int{opts.Fast, opts.Slow},
+			ATRPeriod:   opts.ATRPeriod,
+		},
+		exclude: make(map[dto.Isin]bool),
+		engines: make(map[dto.Isin]*analytics.StreamEngine),
+		lows:    make(map[dto.Isin]float64),
+		atr:     make(map[dto.Isin]float64),
+		returns: make(map[dto.Isin][]float64),
+		closes:  make(map[dto.Isin]float64),
+		stops:   make(map[dto.Isin]*protection),
+	}
+	for _, isin := range opts.Exclude {
+		s.exclude[isin] = true
+	}
+	return s
+}
+
+// window appends the value and keeps the last `Window` values.
+func (s *TrendStrategy) window(values []float64, v float64) []float64 {
+	values = append(values, v)
+	if len(values) > s.opts.Window {
+		values = values[len(values)-s.opts.Window:]
+	}
+	return values
+}
+
+// portfolioReturns returns daily returns of the equity of the strategy.
+func (s *TrendStrategy) portfolioReturns() []float64 {
+	var returns []float64
+	for i := 1; i < len(s.equity); i++ {
+		if s.equity[i-1] > 0 {
+			returns = append(returns, s.equity[i]/s.equity[i-1]-1)
+		}
+	}
+	return returns
+}
+
+func (s *TrendStrategy) OnBar(ctx *Context, bar TimePrices) {
+	s.equity = s.window(s.equity, ctx.Broker.Equity())
+	// защитные стопы висят всё время позиции и не мешают новым сигналам
+	pending := make(map[dto.Isin]bool)
+	for _, o := range ctx.Broker.Pending() {
+		if o.Type == OrderMarket {
+			pending[o.Isin] = true
+		}
+	}
+	var isins []dto.Isin
+	for _, isin := range bar.Isins() {
+		if !s.exclude[isin] {
+			isins = append(isins, isin)
+		}
+	}
+	for _, isin := range isins {
+		engine := s.engines[isin]
+		if engine == nil {
+			engine = analytics.NewStreamEngine(s.stream)
+			s.engines[isin] = engine
+		}
+		events, ok := engine.Update(bar.Prices[isin])
+		if !ok {
+			continue
+		}
+		candle := bar.Prices[isin]
+		if prev := s.closes[isin]; prev > 0 && candle.Close > 0 {
+			s.returns[isin] = s.window(s.returns[isin], candle.Close/prev-1)
+		}
+		s.closes[isin] = candle.Close
+		s.atr[isin] = events.ATR
+		for _, swing := range events.Swings {
+			if swing.Type == dto.SwingLow {
+				s.lows[isin] = swing.Candle.Low
+			}
+		}
+		if pending[isin] {
+			continue
+		}
+		fast, slow := events.MovingAverages[0], events.MovingAverages[1]
+		isUp := engine.Trend() == dto.TrendUp && fast > slow
+		position := ctx.Broker.Position(isin)
+		switch {
+		case !isUp && position > 0:
+			s.cancelStops(ctx, isin)
+			ctx.Broker.Submit(Order{Isin: isin, Side: SideSell})
+		case isUp && position == 0 && (s.opts.Tradable == nil || s.opts.Tradable(isin, bar.Time)):
+			value := sizing.Size(s.opts.Sizing, sizing.Input{
+				Equity:           ctx.Broker.Equity(),
+				Cash:             ctx.Broker.Cash(),
+				Price:            candle.Close,
+				Stop:             s.lows[isin],
+				ATR:              s.atr[isin],
+				Returns:          s.returns[isin],
+				PortfolioReturns: s.portfolioReturns(),
+				Slots:            len(isins),
+			}, s.opts.MaxWeight)
+			if value > 0 {
+				ctx.Broker.Submit(Order{Isin: isin, Side: SideBuy, Value: value})
+			}
+		case position > 0:
+			s.raiseStop(ctx, isin)
+		}
+	}
+}
+
+func (s *TrendStrategy) OnFill(ctx *Context, fill Fill) {
+	switch {
+	case fill.Side == SideBuy:
+		s.protect(ctx, fill.Isin, fill.Price)
+	case ctx.Broker.Position(fill.Isin) == 0:
+		// позиция закрыта стопом или по сигналу, остальные стопы группы уже сняты
+		s.cancelStops(ctx, fill.Isin)
+	}
+}
+
+// protect places the stops of the new position: below the last swing low if it is below
+// the entry and the trailing stop.
+func (s *TrendStrategy) protect(ctx *Context, isin dto.Isin, entry float64) {
+	s.cancelStops(ctx, isin)
+	s.groups++
+	p := &protection{group: s.groups}
+	if low := s.lows[isin]; low > 0 && low < entry {
+		p.level = low
+		p.swing = ctx.Broker.Submit(Order{Isin: isin, Side: SideSell, Type: OrderStop, StopPrice: low, Group: p.group})
+	}
+	if s.opts.Trail > 0 {
+		p.trail = ctx.Broker.Submit(Order{Isin: isin, Side: SideSell, Type: OrderTrailingStop, TrailATR: s.opts.Trail, Group: p.group})
+	}
+	s.stops[isin] = p
+}
+
+// raiseStop moves the swing stop up to the new higher swing low.
+func (s *TrendStrategy) raiseStop(ctx *Context, isin dto.Isin) {
+	p := s.stops[isin]
+	low := s.lows[isin]
+	if p == nil || low <= p.level {
+		return
+	}
+	if p.swing != 0 {
+		ctx.Broker.Cancel(p.swing)
+	}
+	p.level = low
+	p.swing = ctx.Broker.Submit(Order{Isin: isin, Side: SideSell, Type: OrderStop, StopPrice: low, Group: p.group})
+}
+
+func (s *TrendStrategy) cancelStops(ctx *Context, isin dto.Isin) {
+	p := s.stops[isin]
+	if p == nil {
+		return
+	}
+	for _, id := range []int{p.swing, p.trail} {
+		if id != 0 {
+			ctx.Broker.Cancel(id)
+		}
+	}
+	delete(s.stops, isin)
+}
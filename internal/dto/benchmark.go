@@ -0,0 +1,11 @@
+package dto
+
+// Сравнение инструмента с индексом (бенчмарком)
+type BenchmarkComparison struct {
+	Benchmark        *Instrument
+	BenchmarkTrend   TrendType
+	Beta             float64
+	Correlation      float64
+	RelativeStrength float64 // > 1 - инструмент сильнее индекса
+	Contradicts      bool    // тренд инструмента противоположен тренду индекса
+}
@@ -0,0 +1,20 @@
+package dto
+
+type Direction int
+
+const (
+	DirectionNeutral Direction = iota
+	DirectionBullish
+	DirectionBearish
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionBullish:
+		return "Bullish"
+	case DirectionBearish:
+		return "Bearish"
+	default:
+		return "Neutral"
+	}
+}
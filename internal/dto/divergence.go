@@ -0,0 +1,27 @@
+package dto
+
+import "time"
+
+type DivergenceType int
+
+const (
+	DivergenceRegular DivergenceType = iota // разворот тренда
+	DivergenceHidden                        // продолжение тренда
+)
+
+// Дивергенция между ценой и индикатором. Время - второго ценового экстремума
+type Divergence struct {
+	Type            DivergenceType
+	Direction       Direction
+	Indicator       string
+	Time            time.Time
+	PriceSwings     [2]Swing
+	IndicatorSwings [2]SeriesSwing
+}
+
+func (dt DivergenceType) String() string {
+	if dt == DivergenceHidden {
+		return "Hidden"
+	}
+	return "Regular"
+}
@@ -0,0 +1,18 @@
+package dto
+
+// Портфель на плоскости риск-доходность. Доходность и волатильность - годовые.
+type PortfolioPoint struct {
+	Weights    map[Isin]float64
+	Return     float64
+	Volatility float64
+	Sharpe     float64
+}
+
+type EfficientFrontier struct {
+	Isins       []Isin
+	Assets      []PortfolioPoint // каждый инструмент отдельно
+	Points      []PortfolioPoint // от минимальной дисперсии к максимальной доходности
+	MinVariance PortfolioPoint
+	MaxSharpe   PortfolioPoint
+	Shrinkage   float64 // доля целевой матрицы в оценке ковариации
+}
@@ -6,4 +6,8 @@ type Instrument struct {
 	Name string
 	Isin Isin
 	Uid  string
+	// Параметры торговли, пустое значение - неизвестно
+	Lot               int     // штук в лоте
+	MinPriceIncrement float64 // шаг цены
+	Currency          string  // валюта цены: rub, usd, ...
 }
@@ -0,0 +1,40 @@
+package dto
+
+import "time"
+
+type LevelType int
+
+const (
+	LevelSupport LevelType = iota
+	LevelResistance
+)
+
+// Уровень поддержки или сопротивления
+type Level struct {
+	Name    string
+	Type    LevelType
+	Price   float64
+	Time    time.Time // время последнего касания
+	Touches int
+}
+
+func (lt LevelType) String() string {
+	if lt == LevelResistance {
+		return "Resistance"
+	}
+	return "Support"
+}
+
+type PivotType string
+
+const (
+	PivotClassic   PivotType = "classic"
+	PivotCamarilla PivotType = "camarilla"
+	PivotWoodie    PivotType = "woodie"
+)
+
+// Касание уровня свечой
+type LevelTouch struct {
+	Level  Level
+	Candle Candle
+}
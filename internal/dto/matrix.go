@@ -0,0 +1,52 @@
+package dto
+
+import "time"
+
+type ReturnType string
+
+const (
+	ReturnSimple ReturnType = "simple"
+	ReturnLog    ReturnType = "log"
+)
+
+// Квадратная матрица по инструментам (корреляция, ковариация)
+type Matrix struct {
+	Isins  []Isin
+	Values [][]float64
+}
+
+// Get returns the value for a pair of instruments.
+func (m Matrix) Get(a, b Isin) float64 {
+	i, j := m.Index(a), m.Index(b)
+	if i < 0 || j < 0 {
+		return 0
+	}
+	return m.Values[i][j]
+}
+
+// Index returns the position of the instrument in the matrix or -1.
+func (m Matrix) Index(isin Isin) int {
+	for i, v := range m.Isins {
+		if v == isin {
+			return i
+		}
+	}
+	return -1
+}
+
+// Узел дерева иерархической кластеризации. У листа Left и Right пустые
+type Cluster struct {
+	Isins    []Isin
+	Distance float64 // расстояние, на котором объединены ветви
+	Left     *Cluster
+	Right    *Cluster
+}
+
+type CorrelationReport struct {
+	Time        time.Time // последняя дата окна
+	Window      int
+	Returns     ReturnType
+	Correlation Matrix
+	Covariance  Matrix
+	Clusters    *Cluster
+}
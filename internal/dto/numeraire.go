@@ -0,0 +1,9 @@
+package dto
+
+// Numeraire is the unit in which value is measured: RUB, a currency, gold or an index.
+// Prices - стоимость единицы в рублях по датам, без цен единица - сам рубль.
+type Numeraire struct {
+	Name     string
+	Prices   []Candle
+	RiskFree float64 // годовая безрисковая ставка в этой единице
+}
@@ -0,0 +1,36 @@
+package dto
+
+// StationarityTest is the result of the augmented Dickey-Fuller test.
+// Статистика ниже критического значения - единичный корень отвергается, ряд стационарен.
+type StationarityTest struct {
+	Statistic    float64
+	Lags         int // лагов разностей, выбранных по AIC
+	Observations int
+	Critical     [3]float64 // критические значения для 1%, 5% и 10%
+}
+
+// Stationary reports whether the unit root is rejected at the significance 0.01, 0.05 or 0.1.
+func (t StationarityTest) Stationary(significance float64) bool {
+	critical := t.Critical[2]
+	if significance <= 0.01 {
+		critical = t.Critical[0]
+	} else if significance <= 0.05 {
+		critical = t.Critical[1]
+	}
+	return t.Statistic < critical
+}
+
+// Pair is the Engle-Granger cointegration of two instruments by log prices:
+// log A = Alpha + HedgeRatio * log B + spread.
+type Pair struct {
+	A          Isin
+	B          Isin
+	Alpha      float64
+	HedgeRatio float64
+	Test       StationarityTest // ADF спреда
+	// Баров до затухания половины отклонения спреда, +Inf - нет возврата к среднему
+	HalfLife    float64
+	SpreadStd   float64
+	ZScore      float64 // последнее отклонение спреда в стандартных отклонениях
+	Correlation float64 // дневных доходностей
+}
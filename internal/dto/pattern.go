@@ -0,0 +1,60 @@
+package dto
+
+import "time"
+
+type PatternType int
+
+const (
+	PatternDoji PatternType = iota
+	PatternHammer
+	PatternShootingStar
+	PatternBullishEngulfing
+	PatternBearishEngulfing
+	PatternMorningStar
+	PatternEveningStar
+	PatternInsideBar
+	PatternOutsideBar
+	PatternThreeWhiteSoldiers
+	PatternThreeBlackCrows
+)
+
+// Свечной паттерн. Время и свеча - последней свечи паттерна
+type Pattern struct {
+	Type      PatternType
+	Direction Direction
+	Time      time.Time
+	Candle    Candle
+}
+
+func (pt PatternType) String() string {
+	switch pt {
+	case PatternDoji:
+		return "Doji"
+	case PatternHammer:
+		return "Hammer"
+	case PatternShootingStar:
+		return "Shooting Star"
+	case PatternBullishEngulfing:
+		return "Bullish Engulfing"
+	case PatternBearishEngulfing:
+		return "Bearish Engulfing"
+	case PatternMorningStar:
+		return "Morning Star"
+	case PatternEveningStar:
+		return "Evening Star"
+	case PatternInsideBar:
+		return "Inside Bar"
+	case PatternOutsideBar:
+		return "Outside Bar"
+	case PatternThreeWhiteSoldiers:
+		return "Three White Soldiers"
+	case PatternThreeBlackCrows:
+		return "Three Black Crows"
+	default:
+		return "Unknown"
+	}
+}
+
+func (p Pattern) String() string {
+	return p.Type.String()
+}
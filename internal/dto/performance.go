@@ -0,0 +1,69 @@
+package dto
+
+import "time"
+
+// Flow is money put into the portfolio (positive) or taken out of it (negative), RUB.
+type Flow struct {
+	Time   time.Time
+	Amount float64
+}
+
+type ValuePoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// Открытая часть покупки при учёте по FIFO
+type Lot struct {
+	Time     time.Time
+	Quantity float64
+	Price    float64
+}
+
+// PositionPnL is the result of trading one instrument in RUB: цены сделок в валюте
+// пересчитаны по курсу на дату сделки, поэтому результат включает изменение курса.
+type PositionPnL struct {
+	Isin      Isin
+	Uid       string
+	Quantity  float64 // открытое количество
+	Cost      float64 // стоимость открытых лотов
+	Realized  float64 // результат продаж по FIFO без комиссий
+	Dividends float64 // дивиденды и купоны
+	Taxes     float64
+	Fees      float64
+	Trades    int
+	Lots      []Lot // открытые лоты от старых к новым
+}
+
+// Baseline is the lazy alternative: те же вводы и выводы денег в одном инструменте.
+type Baseline struct {
+	Name       string
+	EndValue   float64
+	Return     float64 // взвешенная по времени за период
+	MWR        float64 // годовая взвешенная по деньгам
+	Difference float64 // конечная стоимость портфеля минус альтернативы
+}
+
+// PerformanceReport is the result of the account for the period. Суммы - в рублях,
+// доходности - доли: TWR за период и годовая, MWR - годовая (XIRR). Период оценки From - To
+// начинается с первой операции Since или позже, если на первые дни нет цен.
+type PerformanceReport struct {
+	AccountId   string // пусто - все счета
+	Since       time.Time
+	From        time.Time
+	To          time.Time
+	StartValue  float64
+	EndValue    float64
+	Deposits    float64
+	Withdrawals float64
+	TWR         float64
+	TWRAnnual   float64
+	MWR         float64
+	Realized    float64
+	Dividends   float64
+	Taxes       float64
+	Fees        float64
+	Positions   []PositionPnL
+	Baselines   []Baseline
+	Values      []ValuePoint
+}
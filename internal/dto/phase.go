@@ -0,0 +1,24 @@
+package dto
+
+// Фаза развития тренда
+type PhaseType int
+
+const (
+	PhaseMovement   PhaseType = iota // движение по тренду
+	PhaseBreakout                    // пробой последнего экстремума
+	PhaseCorrection                  // откат против тренда
+	PhaseRange                       // движение внутри боковика
+)
+
+func (pt PhaseType) String() string {
+	switch pt {
+	case PhaseBreakout:
+		return "Breakout"
+	case PhaseCorrection:
+		return "Correction"
+	case PhaseRange:
+		return "Range"
+	default:
+		return "Movement"
+	}
+}
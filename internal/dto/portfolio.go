@@ -0,0 +1,86 @@
+package dto
+
+import "time"
+
+// Счёт у брокера
+type Account struct {
+	Id     string
+	Name   string
+	Type   string
+	Opened time.Time
+}
+
+type OperationType string
+
+const (
+	OperationBuy        OperationType = "buy"
+	OperationSell       OperationType = "sell"
+	OperationDividend   OperationType = "dividend"
+	OperationCoupon     OperationType = "coupon"
+	OperationFee        OperationType = "fee"
+	OperationTax        OperationType = "tax"
+	OperationDeposit    OperationType = "deposit"
+	OperationWithdrawal OperationType = "withdrawal"
+	OperationOther      OperationType = "other"
+)
+
+// Operation is an executed operation of the account.
+type Operation struct {
+	Id          string
+	AccountId   string
+	Time        time.Time
+	Type        OperationType
+	Description string // тип операции у брокера
+	Isin        Isin   // пусто для операций без инструмента
+	Uid         string // идентификатор инструмента у брокера
+	Quantity    float64
+	Price       float64
+	// Изменение денег: положительное для поступлений, отрицательное для списаний
+	Payment  float64
+	Currency string
+}
+
+// Позиция в портфеле у брокера. Цены в валюте инструмента
+type PortfolioPosition struct {
+	Isin           Isin
+	Uid            string
+	InstrumentType string
+	Quantity       float64
+	AveragePrice   float64
+	CurrentPrice   float64
+	ExpectedYield  float64 // нереализованный результат
+	Currency       string
+}
+
+// Value returns the position at the current price.
+func (p PortfolioPosition) Value() float64 {
+	return p.Quantity * p.CurrentPrice
+}
+
+// PortfolioSnapshot is the state of the account at the moment. Суммы - в рублях.
+type PortfolioSnapshot struct {
+	AccountId     string
+	Time          time.Time
+	Total         float64
+	Cash          float64
+	ExpectedYield float64 // в процентах от вложенного
+	Positions     []PortfolioPosition
+}
+
+// Position returns the position of the instrument.
+func (s PortfolioSnapshot) Position(isin Isin) (PortfolioPosition, bool) {
+	for _, p := range s.Positions {
+		if p.Isin == isin {
+			return p, true
+		}
+	}
+	return PortfolioPosition{}, false
+}
+
+// Portfolio is the local copy of accounts, their snapshots and operations.
+type Portfolio struct {
+	Synced     time.Time
+	Accounts   []Account
+	Snapshots  []PortfolioSnapshot // по времени
+	Operations []Operation         // по времени
+}
@@ -0,0 +1,27 @@
+package dto
+
+import "time"
+
+type RankEntry struct {
+	Instrument       *Instrument
+	Score            float64
+	Momentum         []float64 // по периодам из настроек, NaN - истории меньше периода
+	RelativeStrength float64
+	Trend            TrendType
+	Rank             int
+	PrevRank         int // 0 - инструмента не было в прошлом рейтинге
+}
+
+// Change returns how many places the instrument moved up since the previous ranking.
+func (re RankEntry) Change() int {
+	if re.PrevRank == 0 {
+		return 0
+	}
+	return re.PrevRank - re.Rank
+}
+
+type Ranking struct {
+	Time    time.Time
+	Periods []int
+	Entries []RankEntry
+}
@@ -0,0 +1,34 @@
+package dto
+
+import "time"
+
+type ActionType int
+
+const (
+	ActionWait ActionType = iota
+	ActionLong
+	ActionShort
+)
+
+type Recommendation struct {
+	Instrument *Instrument
+	Time       time.Time
+	Action     ActionType
+	Confidence float64  // 0..1
+	Reasons    []string // цепочка рассуждений
+	// Размер позиции для покупки, 0 - не рассчитан
+	Stop     float64 // защитный стоп под последним минимумом свинга
+	Value    float64 // RUB
+	Quantity float64 // штук, целыми лотами
+}
+
+func (at ActionType) String() string {
+	switch at {
+	case ActionLong:
+		return "LONG/CLOSE SHORT"
+	case ActionShort:
+		return "SHORT/CLOSE LONG"
+	default:
+		return "WAIT/CASH"
+	}
+}
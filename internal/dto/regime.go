@@ -0,0 +1,35 @@
+package dto
+
+import "time"
+
+type RegimeType int
+
+const (
+	RegimeUnknown RegimeType = iota
+	RegimeTrending
+	RegimeMeanReverting
+	RegimeVolatile
+)
+
+// Режим рынка на свече и показатели, по которым он определён
+type Regime struct {
+	Time          time.Time
+	Type          RegimeType
+	Volatility    float64 // годовая реализованная волатильность
+	Hurst         float64
+	VarianceRatio float64
+	ADX           float64
+}
+
+func (rt RegimeType) String() string {
+	switch rt {
+	case RegimeTrending:
+		return "trending"
+	case RegimeMeanReverting:
+		return "mean-reverting"
+	case RegimeVolatile:
+		return "volatile"
+	default:
+		return "unknown"
+	}
+}
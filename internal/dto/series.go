@@ -0,0 +1,17 @@
+package dto
+
+import "time"
+
+// Ряд значений индикатора (осциллятора) по времени
+type Series struct {
+	Name   string
+	Dates  []time.Time
+	Values []float64
+}
+
+// Экстремум ряда индикатора
+type SeriesSwing struct {
+	Type  SwingType
+	Time  time.Time
+	Value float64
+}
@@ -0,0 +1,9 @@
+package dto
+
+type Timeframe string
+
+const (
+	TimeframeDay   Timeframe = "day"
+	TimeframeWeek  Timeframe = "week"
+	TimeframeMonth Timeframe = "month"
+)
@@ -0,0 +1,11 @@
+package dto
+
+// Представление свечей
+type CandleTransform string
+
+const (
+	TransformNone       CandleTransform = "none"
+	TransformHeikinAshi CandleTransform = "heikin-ashi"
+	TransformRenko      CandleTransform = "renko"
+	TransformRange      CandleTransform = "range"
+)
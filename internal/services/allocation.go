@@ -0,0 +1,117 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg/config"
+	"github.com/tikhomirovv/lazy-investor/pkg/logging"
+)
+
+// AllocationService finds long-only weights of the instruments by mean and variance of returns.
+type AllocationService struct {
+	config    config.FrontierConf
+	logger    logging.Logger
+	chart     *ChartService
+	valuation *ValuationService
+}
+
+func NewAllocationService(config *config.Config, logger logging.Logger, chart *ChartService, valuation *ValuationService) *AllocationService {
+	return &AllocationService{
+		config:    config.Frontier,
+		logger:    logger,
+		chart:     chart,
+		valuation: valuation,
+	}
+}
+
+// Frontier calculates the efficient frontier by daily returns in RUB for the last window.
+func (as *AllocationService) Frontier(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle) (dto.EfficientFrontier, error) {
+	candlesByIsin = as.valuation.ToRUB(instruments, candlesByIsin)
+	isins, _, returns := analytics.AlignReturns(candlesByIsin, dto.ReturnSimple)
+	if w := as.config.Window; w > 0 {
+		for i := range returns {
+			if len(returns[i]) > w {
+				returns[i] = returns[i][len(returns[i])-w:]
+			}
+		}
+	}
+	opts := analytics.FrontierOptions{
+		RiskFree:  as.config.RiskFree,
+		Points:    as.config.Points,
+		Shrinkage: as.config.Shrinkage,
+		Min:       make(map[dto.Isin]float64),
+		Max:       make(map[dto.Isin]float64),
+	}
+	for isin, w := range as.config.MinWeights {
+		opts.Min[dto.Isin(isin)] = w
+	}
+	for _, isin := range isins {
+		if as.config.MaxWeight > 0 {
+			opts.Max[isin] = as.config.MaxWeight
+		}
+		if w, exists := as.config.MaxWeights[string(isin)]; exists {
+			opts.Max[isin] = w
+		}
+	}
+	frontier, err := analytics.EfficientFrontier(isins, returns, opts)
+	if err != nil {
+		return frontier, fmt.Errorf("AllocationService.Frontier: %w", err)
+	}
+	as.logger.Info("Efficient frontier", "instruments", len(isins), "points", len(frontier.Points), "shrinkage", frontier.Shrinkage)
+	return frontier, nil
+}
+
+// WriteReport writes weights of the min-variance and max-Sharpe portfolios and the frontier.
+func (as *AllocationService) WriteReport(w io.Writer, frontier dto.EfficientFrontier, names map[dto.Isin]string) error {
+	name := func(isin dto.Isin) string {
+		if n := names[isin]; n != "" {
+			return n
+		}
+		return string(isin)
+	}
+	fmt.Fprintf(w, "Mean-variance allocation (risk free %.1f%%, shrinkage %.2f)\n", as.config.RiskFree*100, frontier.Shrinkage)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Instrument\tReturn\tVol\tMin variance\tMax Sharpe\t")
+	for i, isin := range frontier.Isins {
+		a := frontier.Assets[i]
+		fmt.Fprintf(tw, "%s\t%.1f%%\t%.1f%%\t%.1f%%\t%.1f%%\t\n", name(isin), a.Return*100, a.Volatility*100,
+			frontier.MinVariance.Weights[isin]*100, frontier.MaxSharpe.Weights[isin]*100)
+	}
+	for _, p := range []struct {
+		label string
+		point dto.PortfolioPoint
+	}{{"Portfolio min variance", frontier.MinVariance}, {"Portfolio max Sharpe", frontier.MaxSharpe}} {
+		fmt.Fprintf(tw, "%s\t%.1f%%\t%.1f%%\tSharpe %.2f\t\t\n", p.label, p.point.Return*100, p.point.Volatility*100, p.point.Sharpe)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("AllocationService.WriteReport: %w", err)
+	}
+	fmt.Fprintln(w, "Efficient frontier")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Return\tVol\tSharpe\t")
+	for _, p := range frontier.Points {
+		fmt.Fprintf(tw, "%.1f%%\t%.1f%%\t%.2f\t\n", p.Return*100, p.Volatility*100, p.Sharpe)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("AllocationService.WriteReport: %w", err)
+	}
+	return nil
+}
+
+// SaveChart renders the frontier chart into the file from the config.
+func (as *AllocationService) SaveChart(frontier dto.EfficientFrontier, names map[dto.Isin]string) error {
+	f, err := os.Create(as.config.Chart)
+	if err != nil {
+		return fmt.Errorf("AllocationService.SaveChart: %w", err)
+	}
+	defer f.Close()
+	if err := as.chart.GenerateFrontier(frontier, names, f); err != nil {
+		return fmt.Errorf("AllocationService.SaveChart: %w", err)
+	}
+	return nil
+}
@@ -19,12 +19,14 @@ func NewChartService() *ChartService {
 }
 
 type ChartValues struct {
-	Title   string
-	Candles []dto.Candle
-	Trends  []dto.TrendChange
-	EMAs    []dto.EMA
-	Swings  []dto.Swing
-	ZigZags []dto.ZigZagPoint
+	Title    string
+	Candles  []dto.Candle
+	Trends   []dto.TrendChange
+	EMAs     []dto.EMA
+	Swings   []dto.Swing
+	ZigZags  []dto.ZigZagPoint
+	Patterns []dto.Pattern
+	Levels   []dto.Level
 }
 
 // https://github.com/wcharczuk/go-chart/blob/main/examples/stock_analysis/main.go
@@ -53,6 +55,7 @@ func (cs *ChartService) Generate(chart *ChartValues, w io.Writer) error {
 
 	// swingsHigh, swingsLow := getSwingsTimeSeries(chart.Swings)
 	zzHigh, zzLow := getZigZagsTimeSeries(chart.ZigZags)
+	patternsBullish, patternsBearish := getPatternsTimeSeries(chart.Patterns)
 	// trendsUp, trendsDown, trendsNo, _ := getTrendsTimeSeries(chart.Trends)
 	series := []gc.Series{bbSeries,
 		close, high, low,
@@ -60,12 +63,16 @@ func (cs *ChartService) Generate(chart *ChartValues, w io.Writer) error {
 		// trendsUp, trendsDown, trendsNo,
 		// swingsHigh, swingsLow,
 		zzHigh, zzLow,
+		patternsBullish, patternsBearish,
 		// trendAnnotations,
 	}
 
 	for _, ema := range chart.EMAs {
 		series = append(series, getEMATimeSeries(ema))
 	}
+	for _, level := range chart.Levels {
+		series = append(series, getLevelTimeSeries(level, close.XValues))
+	}
 
 	min, max := findMinMax(close.YValues)
 	graph := gc.Chart{
@@ -97,6 +104,82 @@ func (cs *ChartService) Generate(chart *ChartValues, w io.Writer) error {
 	return graph.Render(gc.PNG, w)
 }
 
+// GenerateFrontier draws the efficient frontier, the instruments and the optimal portfolios
+// on the volatility-return plane in percents.
+func (cs *ChartService) GenerateFrontier(frontier dto.EfficientFrontier, names map[dto.Isin]string, w io.Writer) error {
+	line := gc.ContinuousSeries{
+		Name: "Efficient frontier",
+		Style: gc.Style{
+			Show:        true,
+			StrokeColor: gc.GetDefaultColor(0),
+			StrokeWidth: 2,
+		},
+	}
+	for _, p := range frontier.Points {
+		line.XValues = append(line.XValues, p.Volatility*100)
+		line.YValues = append(line.YValues, p.Return*100)
+	}
+	assets := gc.ContinuousSeries{
+		Name: "Instruments",
+		Style: gc.Style{
+			Show:        true,
+			StrokeWidth: gc.Disabled,
+			DotWidth:    5,
+			DotColor:    gc.GetDefaultColor(1),
+		},
+	}
+	labels := gc.AnnotationSeries{Style: gc.Style{Show: true}}
+	for i, p := range frontier.Assets {
+		assets.XValues = append(assets.XValues, p.Volatility*100)
+		assets.YValues = append(assets.YValues, p.Return*100)
+		name := names[frontier.Isins[i]]
+		if name == "" {
+			name = string(frontier.Isins[i])
+		}
+		labels.Annotations = append(labels.Annotations, gc.Value2{Label: name, XValue: p.Volatility * 100, YValue: p.Return * 100})
+	}
+	optimal := gc.ContinuousSeries{
+		Name: "Min variance / max Sharpe",
+		Style: gc.Style{
+			Show:        true,
+			StrokeWidth: gc.Disabled,
+			DotWidth:    7,
+			DotColor:    gc.GetDefaultColor(2),
+		},
+	}
+	for _, p := range []struct {
+		label string
+		point dto.PortfolioPoint
+	}{{"Min variance", frontier.MinVariance}, {"Max Sharpe", frontier.MaxSharpe}} {
+		optimal.XValues = append(optimal.XValues, p.point.Volatility*100)
+		optimal.YValues = append(optimal.YValues, p.point.Return*100)
+		labels.Annotations = append(labels.Annotations, gc.Value2{Label: p.label, XValue: p.point.Volatility * 100, YValue: p.point.Return * 100})
+	}
+
+	graph := gc.Chart{
+		Title:      "Efficient frontier",
+		TitleStyle: gc.Style{Show: true},
+		XAxis: gc.XAxis{
+			Name:      "Volatility, %",
+			NameStyle: gc.Style{Show: true},
+			Style:     gc.Style{Show: true},
+		},
+		YAxis: gc.YAxis{
+			Name:      "Return, %",
+			NameStyle: gc.Style{Show: true},
+			Style:     gc.Style{Show: true},
+		},
+		Series: []gc.Series{line, assets, optimal, labels},
+	}
+	graph.Elements = []gc.Renderable{
+		gc.Legend(&graph),
+	}
+	if err := graph.Render(gc.PNG, w); err != nil {
+		return fmt.Errorf("ChartService.GenerateFrontier: %w", err)
+	}
+	return nil
+}
+
 func findMinMax(slice []float64) (min, max float64) {
 	if len(slice) == 0 {
 		return 0, 0
@@ -169,6 +252,33 @@ func getEMATimeSeries(ema dto.EMA) gc.TimeSeries {
 	}
 }
 
+// Горизонтальная линия уровня от его начала до конца графика
+func getLevelTimeSeries(level dto.Level, dates []time.Time) gc.TimeSeries {
+	var levelDates []time.Time
+	var values []float64
+	for _, d := range dates {
+		if d.Before(level.Time) {
+			continue
+		}
+		levelDates = append(levelDates, d)
+		values = append(values, level.Price)
+	}
+	color := drawing.ColorGreen
+	if level.Type == dto.LevelResistance {
+		color = drawing.ColorRed
+	}
+	return gc.TimeSeries{
+		Name: level.Name,
+		Style: gc.Style{
+			Show:            true,
+			StrokeColor:     color.WithAlpha(128),
+			StrokeDashArray: []float64{2.0, 2.0},
+		},
+		XValues: levelDates,
+		YValues: values,
+	}
+}
+
 func getTrendsTimeSeries(trends []dto.TrendChange) (up gc.TimeSeries, down gc.TimeSeries, no gc.TimeSeries, annotations gc.AnnotationSeries) {
 	var upDates, downDates, noDates []time.Time
 	var upValues, downValues, noValues []float64
@@ -300,3 +410,39 @@ func getZigZagsTimeSeries(zz []dto.ZigZagPoint) (gc.TimeSeries, gc.TimeSeries) {
 			YValues: lValues,
 		}
 }
+
+func getPatternsTimeSeries(patterns []dto.Pattern) (gc.TimeSeries, gc.TimeSeries) {
+	var bullDates, bearDates []time.Time
+	var bullValues, bearValues []float64
+	for _, p := range patterns {
+		if p.Direction == dto.DirectionBullish {
+			bullDates = append(bullDates, p.Time)
+			bullValues = append(bullValues, p.Candle.Low)
+		} else if p.Direction == dto.DirectionBearish {
+			bearDates = append(bearDates, p.Time)
+			bearValues = append(bearValues, p.Candle.High)
+		}
+	}
+	return gc.TimeSeries{
+			Name: "Patterns Bullish",
+			Style: gc.Style{
+				StrokeWidth: gc.Disabled,
+				DotWidth:    4,
+				DotColor:    drawing.ColorGreen,
+				Show:        true,
+			},
+			XValues: bullDates,
+			YValues: bullValues,
+		},
+		gc.TimeSeries{
+			Name: "Patterns Bearish",
+			Style: gc.Style{
+				StrokeWidth: gc.Disabled,
+				DotWidth:    4,
+				DotColor:    drawing.ColorRed,
+				Show:        true,
+			},
+			XValues: bearDates,
+			YValues: bearValues,
+		}
+}
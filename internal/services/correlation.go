@@ -0,0 +1,75 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg/config"
+	"github.com/tikhomirovv/lazy-investor/pkg/logging"
+)
+
+type CorrelationService struct {
+	config config.CorrelationConf
+	logger logging.Logger
+}
+
+func NewCorrelationService(config *config.Config, logger logging.Logger) *CorrelationService {
+	return &CorrelationService{
+		config: config.Correlation,
+		logger: logger,
+	}
+}
+
+// Rolling calculates correlation and covariance matrices over the rolling window.
+func (cs *CorrelationService) Rolling(candlesByIsin map[dto.Isin][]dto.Candle) []dto.CorrelationReport {
+	return analytics.CorrelationReports(candlesByIsin, cs.config.Window, cs.config.Step, dto.ReturnType(cs.config.Returns))
+}
+
+// Latest calculates matrices for the last window.
+func (cs *CorrelationService) Latest(candlesByIsin map[dto.Isin][]dto.Candle) (*dto.CorrelationReport, error) {
+	reports := cs.Rolling(candlesByIsin)
+	if len(reports) == 0 {
+		return nil, fmt.Errorf("CorrelationService.Latest: not enough common candles for window %d", cs.config.Window)
+	}
+	return &reports[len(reports)-1], nil
+}
+
+// WriteReport writes the correlation matrix and clusters as a text table.
+func (cs *CorrelationService) WriteReport(w io.Writer, report *dto.CorrelationReport, instruments map[dto.Isin]*dto.Instrument) error {
+	name := func(isin dto.Isin) string {
+		if i, exists := instruments[isin]; exists && i != nil {
+			return i.Name
+		}
+		return string(isin)
+	}
+	fmt.Fprintf(w, "Correlation (%s returns, %d days to %s)\n",
+		report.Returns, report.Window, report.Time.Format("2006-01-02"))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	m := report.Correlation
+	fmt.Fprint(tw, "\t")
+	for i := range m.Isins {
+		fmt.Fprintf(tw, "%d\t", i+1)
+	}
+	fmt.Fprintln(tw)
+	for i, isin := range m.Isins {
+		fmt.Fprintf(tw, "%d. %s\t", i+1, name(isin))
+		for j := range m.Isins {
+			fmt.Fprintf(tw, "%.2f\t", m.Values[i][j])
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("CorrelationService.WriteReport: %w", err)
+	}
+	for i, group := range analytics.CutClusters(report.Clusters, cs.config.Clusters) {
+		fmt.Fprintf(w, "Cluster #%d:", i+1)
+		for _, isin := range group {
+			fmt.Fprintf(w, " %s;", name(isin))
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"text/tabwriter"
+
+	"github.com/tikhomirovv/lazy-investor/internal/backtest"
+)
+
+// MonteCarlo checks whether the backtest result is luck: bootstrap of daily returns,
+// shuffling and resampling of trades.
+func (ss *StrategyService) MonteCarlo(result backtest.Result) ([]backtest.MonteCarloResult, error) {
+	mc := ss.config.MonteCarlo
+	if mc.Iterations < 1 {
+		return nil, fmt.Errorf("StrategyService.MonteCarlo: iterations must be positive, got %d", mc.Iterations)
+	}
+	if mc.Confidence <= 0 || mc.Confidence > 1 {
+		return nil, fmt.Errorf("StrategyService.MonteCarlo: confidence must be in (0, 1], got %g", mc.Confidence)
+	}
+	opts := backtest.MonteCarloOptions{
+		Iterations: mc.Iterations,
+		Confidence: mc.Confidence,
+		BlockSize:  mc.BlockSize,
+		Seed:       mc.Seed,
+		Workers:    mc.Workers,
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	results := []backtest.MonteCarloResult{backtest.BlockBootstrap(result.Equity, opts)}
+	if trades := backtest.Trades(result.Fills); len(trades) > 0 {
+		results = append(results,
+			backtest.ShuffleTrades(trades, result.Equity, false, opts),
+			backtest.ShuffleTrades(trades, result.Equity, true, opts))
+	}
+	return results, nil
+}
+
+// WriteMonteCarlo writes confidence intervals as a text table.
+func (ss *StrategyService) WriteMonteCarlo(w io.Writer, results []backtest.MonteCarloResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Method\tConfidence\tFinal equity\tMax drawdown\tSharpe\tLoss share\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%.0f%%\t%.0f [%.0f; %.0f]\t%.1f%% [%.1f%%; %.1f%%]\t%.2f [%.2f; %.2f]\t%.0f%%\t\n",
+			r.Method, r.Confidence*100,
+			r.FinalEquity.Median, r.FinalEquity.Low, r.FinalEquity.High,
+			r.MaxDrawdown.Median*100, r.MaxDrawdown.Low*100, r.MaxDrawdown.High*100,
+			r.Sharpe.Median, r.Sharpe.Low, r.Sharpe.High,
+			r.LossShare*100)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("StrategyService.WriteMonteCarlo: %w", err)
+	}
+	return nil
+}
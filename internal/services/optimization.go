@@ -0,0 +1,174 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/backtest"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// Параметры трендовой стратегии по умолчанию, если их нет в наборе
+var defaultTrendParams = backtest.Params{"swing": 2, "fast": 20, "slow": 50, "trail": 0}
+
+func trendParam(params backtest.Params, name string) int {
+	if v, exists := params[name]; exists && v >= 1 {
+		return int(v)
+	}
+	return int(defaultTrendParams[name])
+}
+
+// trendRunner runs the trend strategy with a new broker on each call.
+func (ss *StrategyService) trendRunner(instruments []*dto.Instrument, tradable func(isin dto.Isin, t time.Time) bool) (backtest.Runner, error) {
+	execution, err := ss.execution(instruments)
+	if err != nil {
+		return nil, fmt.Errorf("StrategyService.trendRunner: %w", err)
+	}
+	slippage, err := ss.slippage(execution.Instruments)
+	if err != nil {
+		return nil, fmt.Errorf("StrategyService.trendRunner: %w", err)
+	}
+	policy, err := sizingPolicy(ss.sizing)
+	if err != nil {
+		return nil, fmt.Errorf("StrategyService.trendRunner: %w", err)
+	}
+	exclude := ss.holders()
+	return func(params backtest.Params, bars []backtest.TimePrices) backtest.Result {
+		// модели проскальзывания хранят состояние, поэтому у каждого запуска своя
+		execution := execution
+		execution.Slippage = slippage()
+		// трейлинг-стоп в ATR может быть дробным и нулевым
+		trail, exists := params["trail"]
+		if !exists {
+			trail = defaultTrendParams["trail"]
+		}
+		strategy := backtest.NewTrendStrategy(backtest.TrendOptions{
+			Swing:     trendParam(params, "swing"),
+			Fast:      trendParam(params, "fast"),
+			Slow:      trendParam(params, "slow"),
+			Trail:     trail,
+			Sizing:    policy,
+			MaxWeight: ss.sizing.MaxWeight,
+			ATRPeriod: ss.sizing.ATRPeriod,
+			Window:    ss.sizing.Window,
+			Exclude:   exclude,
+			Tradable:  tradable,
+		})
+		return backtest.NewEngine(backtest.NewSimBroker(ss.config.Cash, execution), strategy).Run(bars)
+	}, nil
+}
+
+// validTrendParams drops parameter sets where the fast average is not faster than the slow one.
+func validTrendParams(candidates []backtest.Params) []backtest.Params {
+	var valid []backtest.Params
+	for _, params := range candidates {
+		if trendParam(params, "fast") < trendParam(params, "slow") {
+			valid = append(valid, params)
+		}
+	}
+	return valid
+}
+
+// Optimize searches parameters of the trend strategy on the whole history and validates
+// the search by walk-forward windows.
+func (ss *StrategyService) Optimize(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle) ([]backtest.OptimizationResult, []backtest.WalkForwardWindow, error) {
+	oc := ss.config.Optimize
+	var ranges []backtest.ParamRange
+	for _, p := range oc.Params {
+		ranges = append(ranges, backtest.ParamRange{Name: p.Name, Min: p.Min, Max: p.Max, Step: p.Step})
+	}
+	var candidates []backtest.Params
+	switch oc.Method {
+	case "grid":
+		candidates = backtest.Grid(ranges)
+	case "random":
+		candidates = backtest.RandomSearch(ranges, oc.Samples, oc.Seed)
+	default:
+		return nil, nil, fmt.Errorf("StrategyService.Optimize: unknown method `%s`", oc.Method)
+	}
+
+	valid := validTrendParams(candidates)
+	if skipped := len(candidates) - len(valid); skipped > 0 {
+		ss.logger.Warn("Optimization: parameter sets with fast >= slow are skipped", "skipped", skipped)
+	}
+	if len(valid) == 0 {
+		return nil, nil, fmt.Errorf("StrategyService.Optimize: no parameter sets with fast < slow")
+	}
+	candidates = valid
+
+	candlesByIsin = ss.valuation.ToRUB(instruments, candlesByIsin)
+	// у трендовой стратегии свой список режимов: фильтр основной стратегии противоречит её идее
+	run, err := ss.trendRunner(instruments, ss.tradable(candlesByIsin, oc.Regimes))
+	if err != nil {
+		return nil, nil, fmt.Errorf("StrategyService.Optimize: %w", err)
+	}
+	workers := oc.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	optimizer := backtest.Optimizer{Run: run, Metric: oc.Metric, Workers: workers}
+	bars := backtest.GroupCandlesByTime(candlesByIsin)
+	ss.logger.Info("Optimization", "candidates", len(candidates), "bars", len(bars), "workers", workers)
+
+	results, err := optimizer.Optimize(candidates, bars, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("StrategyService.Optimize: %w", err)
+	}
+	windows, err := optimizer.WalkForward(candidates, bars, oc.InSample, oc.OutOfSample)
+	if err != nil {
+		return nil, nil, fmt.Errorf("StrategyService.Optimize: %w", err)
+	}
+	return results, windows, nil
+}
+
+func formatParams(params backtest.Params) string {
+	var names []string
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%g", name, params[name])
+	}
+	return strings.Join(parts, " ")
+}
+
+// WriteOptimization writes the best parameters, walk-forward windows and stability of parameters.
+func (ss *StrategyService) WriteOptimization(w io.Writer, results []backtest.OptimizationResult, windows []backtest.WalkForwardWindow, top int) error {
+	fmt.Fprintf(w, "Optimization by %s\n", ss.config.Optimize.Metric)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tParams\tScore\tReturn\tMaxDD\tTrades\t")
+	for i, r := range results {
+		if i >= top {
+			break
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%.2f\t%.1f%%\t%.1f%%\t%d\t\n",
+			i+1, formatParams(r.Params), r.Score, r.Metrics.TotalReturn*100, r.Metrics.MaxDrawdown*100, r.Metrics.Trades)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("StrategyService.WriteOptimization: %w", err)
+	}
+
+	fmt.Fprintln(w, "Walk-forward")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Out of sample\tParams\tIn sample\tOut of sample\tOOS return\t")
+	for _, win := range windows {
+		fmt.Fprintf(tw, "%s - %s\t%s\t%.2f\t%.2f\t%.1f%%\t\n",
+			win.OutOfSampleStart.Format("2006-01-02"), win.OutOfSampleEnd.Format("2006-01-02"),
+			formatParams(win.Best), win.InSampleScore, win.OutOfSampleScore, win.OutOfSample.TotalReturn*100)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("StrategyService.WriteOptimization: %w", err)
+	}
+	fmt.Fprintf(w, "Walk-forward efficiency: %.2f\n", backtest.WalkForwardEfficiency(windows))
+	for _, s := range backtest.Stability(windows) {
+		fmt.Fprintf(w, "Param %s: mean %.2f, std %.2f, CV %.2f, values %v\n", s.Name, s.Mean, s.StdDev, s.CV, s.Values)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/backtest"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+func (ss *StrategyService) pairOptions() analytics.PairOptions {
+	pc := ss.config.Pairs
+	return analytics.PairOptions{
+		MaxLag:       pc.MaxLag,
+		Significance: pc.Significance,
+		MaxHalfLife:  pc.MaxHalfLife,
+	}
+}
+
+// FindPairs searches cointegrated pairs on the last formation window of the candles in RUB.
+func (ss *StrategyService) FindPairs(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle) []dto.Pair {
+	window := make(map[dto.Isin][]dto.Candle)
+	for isin, candles := range ss.valuation.ToRUB(instruments, candlesByIsin) {
+		window[isin] = analytics.LastCandles(candles, ss.config.Pairs.Formation)
+	}
+	return analytics.FindPairs(window, ss.pairOptions())
+}
+
+// WritePairs writes the pairs as a text table.
+func (ss *StrategyService) WritePairs(w io.Writer, pairs []dto.Pair, names map[dto.Isin]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "A\tB\tHedge\tADF\t5%\tLags\tHalf-life\tZ\tCorr\t")
+	for _, p := range pairs {
+		fmt.Fprintf(tw, "%s\t%s\t%.3f\t%.2f\t%.2f\t%d\t%.1f\t%.2f\t%.2f\t\n",
+			names[p.A], names[p.B], p.HedgeRatio, p.Test.Statistic, p.Test.Critical[1], p.Test.Lags,
+			p.HalfLife, p.ZScore, p.Correlation)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("StrategyService.WritePairs: %w", err)
+	}
+	return nil
+}
+
+// pairs backtests long-only buys of the cheap leg of cointegrated pairs: спред не хеджируется.
+func (ss *StrategyService) pairs(instruments []*dto.Instrument, bars []backtest.TimePrices, names map[dto.Isin]string) (backtest.Result, error) {
+	execution, err := ss.execution(instruments)
+	if err != nil {
+		return backtest.Result{}, fmt.Errorf("StrategyService.pairs: %w", err)
+	}
+	pc := ss.config.Pairs
+	strategy := backtest.NewPairsStrategy(backtest.PairsOptions{
+		Formation: pc.Formation,
+		Refit:     pc.Refit,
+		Entry:     pc.Entry,
+		Exit:      pc.Exit,
+		Stop:      pc.Stop,
+		MaxPairs:  pc.MaxPairs,
+		Pair:      ss.pairOptions(),
+	})
+	result := backtest.NewEngine(backtest.NewSimBroker(ss.config.Cash, execution), strategy).Run(bars)
+	ss.logger.Info("Pairs long-only", "fills", len(result.Fills), "realized", result.Realized)
+	for _, p := range strategy.Pairs() {
+		ss.logger.Debug("Pair", "a", names[p.A], "b", names[p.B], "hedge", p.HedgeRatio,
+			"adf", p.Test.Statistic, "halfLife", p.HalfLife)
+	}
+	return result, nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+)
+
+// Performance calculates returns of each account by the stored operations and, if there are
+// several accounts, of all of them together. Цены, курсы и альтернативы (единицы оценки
+// из настроек - золото, индекс) загружаются с первой операции, платежи в валюте
+// пересчитываются в рубли по курсу дня.
+func (ps *PortfolioService) Performance(portfolio dto.Portfolio) ([]dto.PerformanceReport, error) {
+	if len(portfolio.Operations) == 0 {
+		return nil, nil
+	}
+	since := portfolio.Operations[0].Time
+	for _, o := range portfolio.Operations {
+		if o.Time.Before(since) {
+			since = o.Time
+		}
+	}
+	// неделя запаса: курс и цена нужны на последний торговый день до первой операции
+	from := since.AddDate(0, 0, -7)
+	operations, err := ps.operationsToRUB(portfolio.Operations, from)
+	if err != nil {
+		return nil, fmt.Errorf("PortfolioService.Performance: %w", err)
+	}
+	instruments := make(map[dto.Isin]*dto.Instrument)
+	var loaded []*dto.Instrument
+	for _, o := range operations {
+		if o.Uid == "" || instruments[o.Isin] != nil {
+			continue
+		}
+		if o.Isin == "" {
+			ps.logger.Warn("Operation instrument has no ISIN", "uid", o.Uid, "operation", o.Id)
+			continue
+		}
+		instrument, err := ps.tinkoff.GetInstrumentByUid(o.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("PortfolioService.Performance: %w", err)
+		}
+		instruments[o.Isin] = instrument
+		loaded = append(loaded, instrument)
+	}
+	candlesByIsin := make(map[dto.Isin][]dto.Candle)
+	for _, i := range loaded {
+		candles, err := ps.tinkoff.GetCandlesFrom(i, from)
+		if err != nil {
+			return nil, fmt.Errorf("PortfolioService.Performance: %w", err)
+		}
+		candlesByIsin[i.Isin] = candles
+	}
+	candlesByIsin = ps.valuation.toRUB(loaded, candlesByIsin, from)
+	var benchmarks []dto.Numeraire
+	for _, n := range ps.valuation.numeraires(0, from) {
+		if len(n.Prices) > 0 {
+			benchmarks = append(benchmarks, n)
+		}
+	}
+
+	accounts := make([]string, 0, len(portfolio.Accounts)+1)
+	for _, a := range portfolio.Accounts {
+		accounts = append(accounts, a.Id)
+	}
+	if len(accounts) > 1 {
+		accounts = append(accounts, "")
+	}
+	var reports []dto.PerformanceReport
+	for _, id := range accounts {
+		var account []dto.Operation
+		for _, o := range operations {
+			if id == "" || o.AccountId == id {
+				account = append(account, o)
+			}
+		}
+		report := analytics.Performance(account, candlesByIsin, benchmarks)
+		report.AccountId = id
+		switch {
+		case len(report.Values) == 0:
+			ps.logger.Warn("Account is not valued: no prices for positions", "account", id, "operations", len(account))
+		case report.From.Sub(report.Since) > 7*24*time.Hour:
+			ps.logger.Warn("Account is valued later than the first operation: no prices for positions",
+				"account", id, "since", report.Since, "from", report.From)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// operationsToRUB converts payments and prices in other currencies by the rate on the date.
+// Без курса операцию нельзя сложить с рублёвыми, а пропуск исказил бы лоты и деньги, поэтому это ошибка.
+func (ps *PortfolioService) operationsToRUB(operations []dto.Operation, from time.Time) ([]dto.Operation, error) {
+	rates := make(map[string][]dto.Candle)
+	converted := make([]dto.Operation, 0, len(operations))
+	for _, o := range operations {
+		currency := strings.ToLower(o.Currency)
+		if currency == "" || currency == "rub" {
+			converted = append(converted, o)
+			continue
+		}
+		if _, loaded := rates[currency]; !loaded {
+			rates[currency] = ps.valuation.rates(currency, from)
+		}
+		rate, ok := analytics.PriceAt(rates[currency], o.Time)
+		if !ok {
+			return nil, fmt.Errorf("PortfolioService.operationsToRUB: no %s rate for operation %s at %s",
+				o.Currency, o.Id, o.Time.Format("2006-01-02"))
+		}
+		o.Payment *= rate
+		o.Price *= rate
+		converted = append(converted, o)
+	}
+	return converted, nil
+}
+
+// WritePerformance writes returns of the accounts, the lazy alternatives and results by instrument.
+// Since - первая операция, From - To - период, за который посчитаны доходности.
+func (ps *PortfolioService) WritePerformance(w io.Writer, reports []dto.PerformanceReport, names map[dto.Isin]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Account\tSince\tFrom\tTo\tStart\tEnd\tIn\tOut\tTWR\tTWR/yr\tMWR\tRealized\tDividends\tTaxes\tFees\t")
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.0f\t%.0f\t%.0f\t%.0f\t%.1f%%\t%.1f%%\t%.1f%%\t%.0f\t%.0f\t%.0f\t%.0f\t\n",
+			accountName(r.AccountId), r.Since.Format("2006-01-02"), r.From.Format("2006-01-02"), r.To.Format("2006-01-02"), r.StartValue, r.EndValue,
+			r.Deposits, r.Withdrawals, r.TWR*100, r.TWRAnnual*100, r.MWR*100, r.Realized, r.Dividends, r.Taxes, r.Fees)
+	}
+	fmt.Fprintln(tw, "\t")
+	// те же вводы и выводы денег в одном инструменте без сделок
+	fmt.Fprintln(tw, "Account\tInstead\tEnd\tTWR\tMWR\tAccount - instead\t")
+	for _, r := range reports {
+		for _, b := range r.Baselines {
+			fmt.Fprintf(tw, "%s\t%s\t%.0f\t%.1f%%\t%.1f%%\t%+.0f\t\n",
+				accountName(r.AccountId), b.Name, b.EndValue, b.Return*100, b.MWR*100, b.Difference)
+		}
+	}
+	fmt.Fprintln(tw, "\t")
+	fmt.Fprintln(tw, "Account\tInstrument\tQuantity\tCost\tRealized\tDividends\tTaxes\tFees\tTrades\t")
+	for _, r := range reports {
+		if r.AccountId == "" {
+			continue
+		}
+		for _, p := range r.Positions {
+			name := names[p.Isin]
+			if name == "" {
+				name = string(p.Isin)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%g\t%.0f\t%.0f\t%.0f\t%.0f\t%.0f\t%d\t\n",
+				r.AccountId, name, p.Quantity, p.Cost, p.Realized, p.Dividends, p.Taxes, p.Fees, p.Trades)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("PortfolioService.WritePerformance: %w", err)
+	}
+	return nil
+}
+
+func accountName(id string) string {
+	if id == "" {
+		return "all"
+	}
+	return id
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg/config"
+	"github.com/tikhomirovv/lazy-investor/pkg/logging"
+)
+
+// Операции за последние дни запрашиваются повторно: брокер проводит часть из них с задержкой
+const operationsOverlap = 7 * 24 * time.Hour
+
+type PortfolioService struct {
+	config    config.PortfolioConf
+	logger    logging.Logger
+	tinkoff   *TinkoffService
+	valuation *ValuationService
+}
+
+func NewPortfolioService(config *config.Config, logger logging.Logger, tinkoff *TinkoffService, valuation *ValuationService) *PortfolioService {
+	return &PortfolioService{
+		config:    config.Portfolio,
+		logger:    logger,
+		tinkoff:   tinkoff,
+		valuation: valuation,
+	}
+}
+
+// Sync loads accounts, their positions and new operations from the broker and stores them
+// in the local file. В песочнице без счетов открывается новый счёт с начальной суммой.
+func (ps *PortfolioService) Sync() (dto.Portfolio, error) {
+	portfolio, err := ps.Load()
+	if err != nil {
+		return portfolio, fmt.Errorf("PortfolioService.Sync: %w", err)
+	}
+	accounts, err := ps.tinkoff.GetAccounts()
+	if err != nil {
+		return portfolio, fmt.Errorf("PortfolioService.Sync: %w", err)
+	}
+	if len(accounts) == 0 && ps.tinkoff.IsSandbox() {
+		account, err := ps.tinkoff.OpenSandboxAccount(ps.config.SandboxPayIn)
+		if err != nil {
+			return portfolio, fmt.Errorf("PortfolioService.Sync: %w", err)
+		}
+		ps.logger.Info("Sandbox account opened", "account", account.Id, "payIn", ps.config.SandboxPayIn)
+		accounts = append(accounts, account)
+	}
+	accounts = ps.filter(accounts)
+
+	now := time.Now()
+	for _, a := range accounts {
+		snapshot, err := ps.tinkoff.GetPortfolio(a.Id)
+		if err != nil {
+			return portfolio, fmt.Errorf("PortfolioService.Sync: %w", err)
+		}
+		portfolio.Snapshots = append(portfolio.Snapshots, snapshot)
+		from, err := ps.from(portfolio, a)
+		if err != nil {
+			return portfolio, fmt.Errorf("PortfolioService.Sync: %w", err)
+		}
+		operations, err := ps.tinkoff.GetOperations(a.Id, from, now)
+		if err != nil {
+			return portfolio, fmt.Errorf("PortfolioService.Sync: %w", err)
+		}
+		portfolio.Operations = mergeOperations(portfolio.Operations, operations)
+		ps.logger.Info("Account synced", "account", a.Id, "name", a.Name, "total", snapshot.Total,
+			"positions", len(snapshot.Positions), "operations", len(operations))
+	}
+	portfolio.Accounts = accounts
+	portfolio.Synced = now
+	if err := ps.Save(portfolio); err != nil {
+		return portfolio, fmt.Errorf("PortfolioService.Sync: %w", err)
+	}
+	return portfolio, nil
+}
+
+// filter keeps the accounts from the config.
+func (ps *PortfolioService) filter(accounts []dto.Account) []dto.Account {
+	if len(ps.config.Accounts) == 0 {
+		return accounts
+	}
+	allowed := make(map[string]bool)
+	for _, id := range ps.config.Accounts {
+		allowed[id] = true
+	}
+	var filtered []dto.Account
+	for _, a := range accounts {
+		if allowed[a.Id] {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
+}
+
+// from returns the start of the operations to load: после уже сохранённых операций счёта,
+// иначе с даты из настроек или с открытия счёта.
+func (ps *PortfolioService) from(portfolio dto.Portfolio, account dto.Account) (time.Time, error) {
+	var last time.Time
+	for _, o := range portfolio.Operations {
+		if o.AccountId == account.Id && o.Time.After(last) {
+			last = o.Time
+		}
+	}
+	if !last.IsZero() {
+		return last.Add(-operationsOverlap), nil
+	}
+	if ps.config.From != "" {
+		from, err := time.Parse("2006-01-02", ps.config.From)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("PortfolioService.from: %w", err)
+		}
+		return from, nil
+	}
+	if !account.Opened.IsZero() {
+		return account.Opened, nil
+	}
+	return time.Now().AddDate(-1, 0, 0), nil
+}
+
+// mergeOperations adds new operations by ID and sorts them by time.
+func mergeOperations(operations, loaded []dto.Operation) []dto.Operation {
+	index := make(map[string]int, len(operations))
+	for i, o := range operations {
+		index[o.Id] = i
+	}
+	for _, o := range loaded {
+		if i, exists := index[o.Id]; exists {
+			operations[i] = o
+			continue
+		}
+		index[o.Id] = len(operations)
+		operations = append(operations, o)
+	}
+	sort.SliceStable(operations, func(i, j int) bool {
+		return operations[i].Time.Before(operations[j].Time)
+	})
+	return operations
+}
+
+// Current combines the last snapshots of the accounts into one: позиции одного инструмента
+// на разных счетах складываются.
+func (ps *PortfolioService) Current(portfolio dto.Portfolio) dto.PortfolioSnapshot {
+	last := make(map[string]dto.PortfolioSnapshot)
+	for _, s := range portfolio.Snapshots {
+		if prev, exists := last[s.AccountId]; !exists || !s.Time.Before(prev.Time) {
+			last[s.AccountId] = s
+		}
+	}
+	var current dto.PortfolioSnapshot
+	positions := make(map[string]*dto.PortfolioPosition)
+	var keys []string
+	for _, a := range portfolio.Accounts {
+		s, exists := last[a.Id]
+		if !exists {
+			continue
+		}
+		current.Total += s.Total
+		current.Cash += s.Cash
+		if s.Time.After(current.Time) {
+			current.Time = s.Time
+		}
+		for _, p := range s.Positions {
+			key := p.Uid
+			if key == "" {
+				key = string(p.Isin)
+			}
+			total, exists := positions[key]
+			if !exists {
+				position := p
+				positions[key] = &position
+				keys = append(keys, key)
+				continue
+			}
+			cost := total.AveragePrice*total.Quantity + p.AveragePrice*p.Quantity
+			total.Quantity += p.Quantity
+			total.ExpectedYield += p.ExpectedYield
+			if total.Quantity != 0 {
+				total.AveragePrice = cost / total.Quantity
+			}
+		}
+	}
+	for _, key := range keys {
+		current.Positions = append(current.Positions, *positions[key])
+	}
+	return current
+}
+
+// WriteReport writes the positions of the snapshot as a text table.
+func (ps *PortfolioService) WriteReport(w io.Writer, snapshot dto.PortfolioSnapshot, names map[dto.Isin]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Total %.2f RUB, cash %.2f RUB\t\n", snapshot.Total, snapshot.Cash)
+	fmt.Fprintln(tw, "Instrument\tType\tQuantity\tAverage\tPrice\tValue\tYield\t")
+	for _, p := range snapshot.Positions {
+		name := names[p.Isin]
+		if name == "" {
+			name = string(p.Isin)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%g\t%.2f\t%.2f\t%.2f %s\t%.2f\t\n",
+			name, p.InstrumentType, p.Quantity, p.AveragePrice, p.CurrentPrice, p.Value(), p.Currency, p.ExpectedYield)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("PortfolioService.WriteReport: %w", err)
+	}
+	return nil
+}
+
+// Load reads the local copy. Без файла - пустой портфель.
+func (ps *PortfolioService) Load() (dto.Portfolio, error) {
+	var portfolio dto.Portfolio
+	data, err := os.ReadFile(ps.config.File)
+	if errors.Is(err, fs.ErrNotExist) {
+		return portfolio, nil
+	}
+	if err != nil {
+		return portfolio, fmt.Errorf("PortfolioService.Load: %w", err)
+	}
+	if err := json.Unmarshal(data, &portfolio); err != nil {
+		return portfolio, fmt.Errorf("PortfolioService.Load: %w", err)
+	}
+	return portfolio, nil
+}
+
+func (ps *PortfolioService) Save(portfolio dto.Portfolio) error {
+	data, err := json.MarshalIndent(portfolio, "", "  ")
+	if err != nil {
+		return fmt.Errorf("PortfolioService.Save: %w", err)
+	}
+	if err := os.WriteFile(ps.config.File, data, 0o644); err != nil {
+		return fmt.Errorf("PortfolioService.Save: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg/config"
+	"github.com/tikhomirovv/lazy-investor/pkg/logging"
+)
+
+type RankingService struct {
+	config config.RankingConf
+	logger logging.Logger
+}
+
+func NewRankingService(config *config.Config, logger logging.Logger) *RankingService {
+	return &RankingService{
+		config: config.Ranking,
+		logger: logger,
+	}
+}
+
+// Rank scores instruments by momentum, relative strength to the benchmark and trend,
+// and sorts them from the strongest. Previous places are read from the state file.
+func (rs *RankingService) Rank(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle, benchmark []dto.Candle) dto.Ranking {
+	ranking := dto.Ranking{Periods: rs.config.Periods}
+	for _, i := range instruments {
+		candles := candlesByIsin[i.Isin]
+		if len(candles) == 0 {
+			continue
+		}
+		entry := dto.RankEntry{Instrument: i}
+		// без части периодов моментум - среднее по остальным в масштабе всех весов
+		var momentum, used, total float64
+		for k, period := range rs.config.Periods {
+			var weight float64
+			if k < len(rs.config.Weights) {
+				weight = rs.config.Weights[k]
+			}
+			total += weight
+			m, ok := analytics.Momentum(candles, period)
+			if !ok {
+				rs.logger.Warn("Momentum period is longer than history", "isin", i.Isin, "period", period, "candles", len(candles))
+				entry.Momentum = append(entry.Momentum, math.NaN())
+				continue
+			}
+			entry.Momentum = append(entry.Momentum, m)
+			momentum += weight * m
+			used += weight
+		}
+		if used > 0 {
+			entry.Score += momentum / used * total
+		}
+		if len(benchmark) > 0 {
+			a, b := analytics.AlignCandles(candles, benchmark)
+			entry.RelativeStrength = analytics.RelativeStrength(
+				analytics.LastCandles(a, rs.config.RSPeriod+1),
+				analytics.LastCandles(b, rs.config.RSPeriod+1))
+			if entry.RelativeStrength > 0 {
+				entry.Score += rs.config.RSWeight * (entry.RelativeStrength - 1)
+			}
+		}
+		entry.Trend, _ = analytics.GetTrends(analytics.FindSwings(candles, rs.config.SwingPeriod))
+		entry.Score += rs.config.TrendWeight * trendSign(entry.Trend)
+		if last := candles[len(candles)-1].Time; last.After(ranking.Time) {
+			ranking.Time = last
+		}
+		ranking.Entries = append(ranking.Entries, entry)
+	}
+	sort.SliceStable(ranking.Entries, func(i, j int) bool {
+		return ranking.Entries[i].Score > ranking.Entries[j].Score
+	})
+
+	prev, err := rs.load()
+	if err != nil {
+		rs.logger.Warn("Previous ranking is not loaded", "error", err)
+	}
+	for i := range ranking.Entries {
+		e := &ranking.Entries[i]
+		e.Rank = i + 1
+		e.PrevRank = prev[e.Instrument.Isin]
+	}
+	return ranking
+}
+
+// Save stores places of the ranking to compare with on the next run.
+func (rs *RankingService) Save(ranking dto.Ranking) error {
+	places := make(map[dto.Isin]int, len(ranking.Entries))
+	for _, e := range ranking.Entries {
+		places[e.Instrument.Isin] = e.Rank
+	}
+	data, err := json.MarshalIndent(places, "", "  ")
+	if err != nil {
+		return fmt.Errorf("RankingService.Save: %w", err)
+	}
+	if err := os.WriteFile(rs.config.StateFile, data, 0o644); err != nil {
+		return fmt.Errorf("RankingService.Save: %w", err)
+	}
+	return nil
+}
+
+func (rs *RankingService) load() (map[dto.Isin]int, error) {
+	places := make(map[dto.Isin]int)
+	data, err := os.ReadFile(rs.config.StateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return places, nil
+	}
+	if err != nil {
+		return places, fmt.Errorf("RankingService.load: %w", err)
+	}
+	if err := json.Unmarshal(data, &places); err != nil {
+		return places, fmt.Errorf("RankingService.load: %w", err)
+	}
+	return places, nil
+}
+
+// WriteLeaderboard writes the ranking as a text table.
+func (rs *RankingService) WriteLeaderboard(w io.Writer, ranking dto.Ranking) error {
+	fmt.Fprintf(w, "Leaderboard on %s\n", ranking.Time.Format("2006-01-02"))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "#\tChange\tInstrument\tScore\t")
+	for _, p := range ranking.Periods {
+		fmt.Fprintf(tw, "%dd\t", p)
+	}
+	fmt.Fprintln(tw, "RS\tTrend\t")
+	for _, e := range ranking.Entries {
+		change := "new"
+		if e.PrevRank > 0 {
+			change = fmt.Sprintf("%+d", e.Change())
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%.3f\t", e.Rank, change, e.Instrument.Name, e.Score)
+		for _, m := range e.Momentum {
+			if math.IsNaN(m) {
+				fmt.Fprint(tw, "-\t")
+				continue
+			}
+			fmt.Fprintf(tw, "%.1f%%\t", m*100)
+		}
+		fmt.Fprintf(tw, "%.2f\t%s\t\n", e.RelativeStrength, e.Trend)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("RankingService.WriteLeaderboard: %w", err)
+	}
+	return nil
+}
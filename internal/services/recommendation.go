@@ -0,0 +1,225 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/internal/sizing"
+	"github.com/tikhomirovv/lazy-investor/pkg/config"
+	"github.com/tikhomirovv/lazy-investor/pkg/logging"
+)
+
+type RecommendationService struct {
+	rules     config.RecommendationConf
+	sizing    config.SizingConf
+	slots     int // капитал делится между инструментами из настроек
+	logger    logging.Logger
+	valuation *ValuationService
+}
+
+func NewRecommendationService(config *config.Config, logger logging.Logger, valuation *ValuationService) *RecommendationService {
+	return &RecommendationService{
+		rules:     config.Recommendation,
+		sizing:    config.Sizing,
+		slots:     len(config.Instruments),
+		logger:    logger,
+		valuation: valuation,
+	}
+}
+
+// Порядок важен для цепочки рассуждений: от старшего таймфрейма к младшему
+var recommendationTimeframes = []dto.Timeframe{
+	dto.TimeframeMonth,
+	dto.TimeframeWeek,
+	dto.TimeframeDay,
+}
+
+func trendSign(trend dto.TrendType) float64 {
+	switch trend {
+	case dto.TrendUp:
+		return 1
+	case dto.TrendDown:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// Recommend решает, что делать с инструментом: ждать, покупать или продавать.
+// Score в диапазоне [-1, 1] складывается из трендов таймфреймов и ослабляется
+// фазой, близостью уровня против направления, волатильностью и индексами.
+// С портфелем у брокера (может быть nil) размер считается от реального капитала
+// с учётом уже купленного, а продажа - от позиции.
+func (rs *RecommendationService) Recommend(instrument *dto.Instrument, candles []dto.Candle, comparisons []dto.BenchmarkComparison, portfolio *dto.PortfolioSnapshot) dto.Recommendation {
+	rec := dto.Recommendation{Instrument: instrument, Action: dto.ActionWait}
+	addReason := func(format string, args ...interface{}) {
+		rec.Reasons = append(rec.Reasons, fmt.Sprintf(format, args...))
+	}
+	if len(candles) == 0 {
+		addReason("no candles")
+		return rec
+	}
+	last := candles[len(candles)-1]
+	rec.Time = last.Time
+	price := last.Close
+
+	// 1. Тренд по таймфреймам
+	var score, total float64
+	for _, tf := range recommendationTimeframes {
+		weight := rs.rules.Timeframes[string(tf)]
+		if weight == 0 {
+			continue
+		}
+		trend, _ := analytics.GetTrends(analytics.FindSwings(analytics.ResampleCandles(candles, tf), rs.rules.SwingPeriod))
+		total += weight
+		score += weight * trendSign(trend)
+		addReason("%s trend: %s (weight %.2f)", tf, trend, weight)
+	}
+	if total == 0 {
+		addReason("no timeframe rules")
+		return rec
+	}
+	score /= total
+
+	// 2. Фаза дневного тренда
+	swings := analytics.FindSwings(candles, rs.rules.SwingPeriod)
+	trend, _ := analytics.GetTrends(swings)
+	phase := analytics.GetPhase(candles, swings, trend)
+	if k, exists := rs.rules.Phases[strings.ToLower(phase.String())]; exists {
+		score *= k
+		addReason("phase: %s (x%.2f)", phase, k)
+	}
+
+	// 3. Ближайшие уровни против направления
+	levels := analytics.FindLevels(swings, price, rs.rules.LevelTolerance)
+	support, resistance := analytics.NearestLevels(levels, price)
+	if score > 0 && resistance != nil && (resistance.Price-price)/price <= rs.rules.LevelDistance {
+		score *= 1 - rs.rules.LevelPenalty
+		addReason("close to resistance %.2f (touches %d)", resistance.Price, resistance.Touches)
+	}
+	if score < 0 && support != nil && (price-support.Price)/price <= rs.rules.LevelDistance {
+		score *= 1 - rs.rules.LevelPenalty
+		addReason("close to support %.2f (touches %d)", support.Price, support.Touches)
+	}
+
+	// 4. Волатильность
+	if rs.rules.ATRPeriod > 0 && price > 0 {
+		atr := analytics.CalculateATR(candles, rs.rules.ATRPeriod)
+		volatility := atr[len(atr)-1] / price
+		if volatility > rs.rules.MaxVolatility {
+			score *= 1 - rs.rules.VolatilityPenalty
+			addReason("high volatility: ATR %.2f%% of price", volatility*100)
+		}
+	}
+
+	// 5. Тренд индексов
+	for _, cmp := range comparisons {
+		if score*trendSign(cmp.BenchmarkTrend) < 0 {
+			score *= 1 - rs.rules.BenchmarkPenalty
+			addReason("against benchmark %s trend: %s", cmp.Benchmark.Name, cmp.BenchmarkTrend)
+		}
+	}
+
+	rec.Confidence = math.Abs(score)
+	if rec.Confidence < rs.rules.MinConfidence || score == 0 {
+		addReason("confidence %.2f below %.2f", rec.Confidence, rs.rules.MinConfidence)
+		return rec
+	}
+	var position dto.PortfolioPosition
+	if portfolio != nil && instrument != nil {
+		position, _ = portfolio.Position(instrument.Isin)
+	}
+	if position.Quantity > 0 {
+		addReason("held: %g pcs for %.2f %s", position.Quantity, position.Value(), position.Currency)
+	}
+	if score > 0 {
+		rec.Action = dto.ActionLong
+		if err := rs.size(&rec, candles, swings, portfolio, position); err != nil {
+			addReason("sizing: %v", err)
+		} else {
+			addReason("size: %.0f RUB, %g pcs, stop %.2f (%s)", rec.Value, rec.Quantity, rec.Stop, rs.sizing.Policy)
+		}
+	} else {
+		rec.Action = dto.ActionShort
+		if position.Quantity > 0 {
+			rec.Quantity = position.Quantity
+			if rub, err := rs.toRUB(instrument, candles); err != nil {
+				addReason("value: %v", err)
+			} else {
+				rec.Value = position.Quantity * rub[len(rub)-1].Close
+			}
+			addReason("close: %g pcs", rec.Quantity)
+		} else if portfolio != nil {
+			addReason("no position to close")
+		}
+	}
+	return rec
+}
+
+// toRUB converts the candles of the instrument into RUB, as the capital is in RUB.
+func (rs *RecommendationService) toRUB(instrument *dto.Instrument, candles []dto.Candle) ([]dto.Candle, error) {
+	if instrument == nil {
+		return candles, nil
+	}
+	converted := rs.valuation.ToRUB([]*dto.Instrument{instrument}, map[dto.Isin][]dto.Candle{instrument.Isin: candles})
+	if len(converted[instrument.Isin]) == 0 {
+		return nil, fmt.Errorf("no exchange rate for %s", instrument.Currency)
+	}
+	return converted[instrument.Isin], nil
+}
+
+// size calculates the purchase by the sizing policy from the capital in the config or, if known,
+// from the portfolio: докупается только разница между целевым размером и позицией.
+// Стоп остаётся в валюте цены, размер считается по свечам в рублях.
+func (rs *RecommendationService) size(rec *dto.Recommendation, candles []dto.Candle, swings []dto.Swing, portfolio *dto.PortfolioSnapshot, position dto.PortfolioPosition) error {
+	policy, err := sizingPolicy(rs.sizing)
+	if err != nil {
+		return fmt.Errorf("RecommendationService.size: %w", err)
+	}
+	price := candles[len(candles)-1].Close
+	for i := len(swings) - 1; i >= 0; i-- {
+		if swings[i].Type == dto.SwingLow && swings[i].Candle.Low < price {
+			rec.Stop = swings[i].Candle.Low
+			break
+		}
+	}
+	candles, err = rs.toRUB(rec.Instrument, candles)
+	if err != nil {
+		return fmt.Errorf("RecommendationService.size: %w", err)
+	}
+	// курс на последнюю свечу
+	rate := candles[len(candles)-1].Close / price
+	price = candles[len(candles)-1].Close
+	equity, cash := rs.sizing.Capital, rs.sizing.Capital
+	if portfolio != nil && portfolio.Total > 0 {
+		equity, cash = portfolio.Total, portfolio.Cash
+	}
+	// деньги ограничивают только докупку, а не целевой размер
+	in := sizing.Input{
+		Equity: equity,
+		Cash:   equity,
+		Price:  price,
+		Stop:   rec.Stop * rate,
+		Slots:  rs.slots,
+	}
+	if rs.sizing.ATRPeriod > 0 {
+		atr := analytics.CalculateATR(candles, rs.sizing.ATRPeriod)
+		in.ATR = atr[len(atr)-1]
+	}
+	returns := analytics.Returns(candles)
+	if w := rs.sizing.Window; w > 0 && len(returns) > w {
+		returns = returns[len(returns)-w:]
+	}
+	in.Returns = returns
+	rec.Value = math.Min(sizing.Size(policy, in, rs.sizing.MaxWeight)-position.Quantity*price, cash)
+	var lot int
+	if rec.Instrument != nil {
+		lot = rec.Instrument.Lot
+	}
+	rec.Quantity = sizing.Quantity(rec.Value, price, lot)
+	rec.Value = rec.Quantity * price
+	return nil
+}
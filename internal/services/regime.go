@@ -0,0 +1,58 @@
+package services
+
+import (
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg/config"
+	"github.com/tikhomirovv/lazy-investor/pkg/logging"
+)
+
+type RegimeService struct {
+	options analytics.RegimeOptions
+	logger  logging.Logger
+}
+
+func NewRegimeService(config *config.Config, logger logging.Logger) *RegimeService {
+	rc := config.Regime
+	return &RegimeService{
+		options: analytics.RegimeOptions{
+			Window:             rc.Window,
+			ADXPeriod:          rc.ADXPeriod,
+			ADXTrend:           rc.ADXTrend,
+			HurstTrend:         rc.HurstTrend,
+			HurstMeanReversion: rc.HurstMeanReversion,
+			VarianceRatioLag:   rc.VarianceRatioLag,
+			MaxVolatility:      rc.MaxVolatility,
+			HMMStates:          rc.HMMStates,
+			HMMIterations:      rc.HMMIterations,
+		},
+		logger: logger,
+	}
+}
+
+// Detect labels the regime of each candle.
+func (rs *RegimeService) Detect(candles []dto.Candle) []dto.Regime {
+	return analytics.DetectRegimes(candles, rs.options)
+}
+
+// Current returns the regime of the last candle.
+func (rs *RegimeService) Current(candles []dto.Candle) dto.Regime {
+	regimes := rs.Detect(candles)
+	if len(regimes) == 0 {
+		return dto.Regime{Type: dto.RegimeUnknown}
+	}
+	return regimes[len(regimes)-1]
+}
+
+// IsRegimeAllowed checks the regime against the list of allowed regimes. Empty list allows all.
+func IsRegimeAllowed(regime dto.RegimeType, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if a == regime.String() {
+			return true
+		}
+	}
+	return false
+}
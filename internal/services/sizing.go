@@ -0,0 +1,29 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/tikhomirovv/lazy-investor/internal/sizing"
+	"github.com/tikhomirovv/lazy-investor/pkg/config"
+)
+
+// sizingPolicy creates the position sizing policy by the config.
+func sizingPolicy(sc config.SizingConf) (sizing.Policy, error) {
+	switch sc.Policy {
+	case "", "equal":
+		return sizing.EqualShare{}, nil
+	case "fixed-fraction":
+		return sizing.FixedFraction{Fraction: sc.Fraction}, nil
+	case "fixed-risk":
+		return sizing.FixedRisk{Risk: sc.Risk}, nil
+	case "atr":
+		return sizing.ATRRisk{Risk: sc.Risk, Multiplier: sc.ATRMultiplier}, nil
+	case "inverse-volatility":
+		return sizing.InverseVolatility{Target: sc.Target}, nil
+	case "volatility-target":
+		return sizing.VolatilityTarget{Target: sc.Target}, nil
+	case "kelly":
+		return sizing.Kelly{Fraction: sc.Fraction, Cap: sc.MaxWeight}, nil
+	}
+	return nil, fmt.Errorf("unknown sizing policy `%s`", sc.Policy)
+}
@@ -1,247 +1,317 @@
 package services
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"sort"
+	"text/tabwriter"
 	"time"
 
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/backtest"
 	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/internal/sizing"
+	"github.com/tikhomirovv/lazy-investor/pkg/config"
 	"github.com/tikhomirovv/lazy-investor/pkg/logging"
 )
 
 type StrategyService struct {
-	logger  logging.Logger
-	tinkoff *TinkoffService
+	config    config.StrategyConf
+	sizing    config.SizingConf
+	logger    logging.Logger
+	tinkoff   *TinkoffService
+	regime    *RegimeService
+	valuation *ValuationService
 }
 
-func NewStrategyService(logger logging.Logger, tinkoff *TinkoffService) *StrategyService {
+func NewStrategyService(config *config.Config, logger logging.Logger, tinkoff *TinkoffService, regime *RegimeService, valuation *ValuationService) *StrategyService {
 	return &StrategyService{
-		logger:  logger,
-		tinkoff: tinkoff,
+		config:    config.Strategy,
+		sizing:    config.Sizing,
+		logger:    logger,
+		tinkoff:   tinkoff,
+		regime:    regime,
+		valuation: valuation,
 	}
 }
 
-// ---------
-
-type Portfolio struct {
-	Name    string
-	Amount  float64 // RUB
-	Actives map[dto.Isin]float64
-}
-
-type Market struct {
-	Instruments map[dto.Isin]*dto.Instrument
-	State       MarketState
-}
-type MarketState struct {
-	Portfolio   *Portfolio
-	Alternative map[dto.Isin]*Portfolio
-	Prices      map[dto.Isin]float64
-	History     map[dto.Isin][]float64
+// holders returns instruments holding numeraires: основная и трендовая стратегии ими не торгуют.
+func (ss *StrategyService) holders() []dto.Isin {
+	var isins []dto.Isin
+	for isin := range ss.valuation.Holders() {
+		isins = append(isins, isin)
+	}
+	sortIsins(isins)
+	return isins
 }
 
-type TimePrices struct {
-	Time   time.Time
-	Prices map[dto.Isin]dto.Candle
+// tradable allows trading of the instrument only in the allowed market regimes.
+func (ss *StrategyService) tradable(candlesByIsin map[dto.Isin][]dto.Candle, allowed []string) func(isin dto.Isin, t time.Time) bool {
+	regimes := make(map[dto.Isin]map[time.Time]dto.RegimeType)
+	for isin, candles := range candlesByIsin {
+		regimes[isin] = make(map[time.Time]dto.RegimeType)
+		for _, r := range ss.regime.Detect(candles) {
+			regimes[isin][r.Time] = r.Type
+		}
+	}
+	return func(isin dto.Isin, t time.Time) bool {
+		return IsRegimeAllowed(regimes[isin][t], allowed)
+	}
 }
 
-const GoldIsin = "RU000A101NZ2"
-
-func (m *Market) PrintPortfolio(p *Portfolio, onlyValue bool) {
-	if !onlyValue {
-		fmt.Printf("💼 %s: RUB - %.2f\n", p.Name, p.Amount)
+// execution builds the execution model of the simulated broker from the config.
+func (ss *StrategyService) execution(instruments []*dto.Instrument) (backtest.Execution, error) {
+	ec := ss.config.Execution
+	execution := backtest.Execution{
+		Commission:  backtest.Commission{Rate: ec.Commission, Min: ec.MinCommission},
+		Instruments: make(map[dto.Isin]*dto.Instrument),
+		ATRPeriod:   ec.ATRPeriod,
 	}
-	for isin, value := range p.Actives {
-		name := m.Instruments[isin].Name
-		rub := value * m.State.Prices[isin]
-		gold := value * m.State.Prices[isin] / m.State.Prices[GoldIsin]
-		if onlyValue {
-			fmt.Printf("\t %.2f RUB,\t%.2f GOLD |  %s\n", rub, gold, name)
-		} else {
-			fmt.Printf("\t - %s: %.2f (%.2f RUB, %.2f GOLD)\n", name, value, rub, gold)
-			fmt.Println("---")
+	for _, i := range instruments {
+		if i == nil {
+			continue
+		}
+		// свечи пересчитываются в рубли, шаг цены в валюте инструмента к ним не применим
+		if i.Currency != "" && i.Currency != "rub" {
+			converted := *i
+			converted.MinPriceIncrement = 0
+			i = &converted
 		}
+		execution.Instruments[i.Isin] = i
 	}
-}
-func (p *Portfolio) Buy(isin dto.Isin, price float64) bool {
-	if p.Amount <= 0 {
-		// fmt.Println("No money in portfolio")
-		return false
-	}
-	value := p.Amount / price
-	p.Amount = 0
-	p.Actives[isin] = value
-	fmt.Printf("💰: %.4f %s by %.4f (%.4f RUB)\n",
-		value, isin, price, p.Amount)
-	return true
-}
-
-func (p *Portfolio) Sale(isin dto.Isin, price float64) bool {
-	value, exists := p.Actives[isin]
-	if !exists || value <= 0 {
-		// fmt.Printf("No active in portfolio `%s`\n", isin)
-		return false
-	}
-	delete(p.Actives, isin)
-	p.Amount = value * price
-	fmt.Printf("🔻: %.4f %s by %.4f (%.4f RUB)\n",
-		value, isin, price, p.Amount)
-	return true
-}
-
-func (m *Market) GetAmountInRub(p *Portfolio) float64 {
-	amount := p.Amount
-	for isin, active := range p.Actives {
-		amount += active * m.State.Prices[isin]
+	if ec.Tariff != "" {
+		commission, exists := backtest.TinkoffTariffs[ec.Tariff]
+		if !exists {
+			return execution, fmt.Errorf("StrategyService.execution: unknown tariff `%s`", ec.Tariff)
+		}
+		execution.Commission = commission
 	}
-
-	return amount
+	slippage, err := ss.slippage(execution.Instruments)
+	if err != nil {
+		return execution, fmt.Errorf("StrategyService.execution: %w", err)
+	}
+	execution.Slippage = slippage()
+	return execution, nil
 }
 
-func NewPortfolio(name string) *Portfolio {
-	return &Portfolio{Name: name, Amount: 1000, Actives: make(map[dto.Isin]float64)}
+// slippage returns the constructor of the slippage model from the config:
+// модели хранят состояние, поэтому каждому запуску нужна своя.
+func (ss *StrategyService) slippage(instruments map[dto.Isin]*dto.Instrument) (func() backtest.SlippageModel, error) {
+	ec := ss.config.Execution
+	switch ec.Slippage {
+	case "", "none":
+		return func() backtest.SlippageModel { return nil }, nil
+	case "fixed":
+		return func() backtest.SlippageModel { return &backtest.FixedSlippage{Bps: ec.SlippageBps} }, nil
+	case "atr":
+		return func() backtest.SlippageModel { return backtest.NewATRSlippage(ec.ATRPeriod, ec.ATRFraction) }, nil
+	case "volume":
+		return func() backtest.SlippageModel { return backtest.NewVolumeSlippage(ec.VolumeImpact, instruments) }, nil
+	}
+	return nil, fmt.Errorf("StrategyService.slippage: unknown slippage model `%s`", ec.Slippage)
 }
 
-func NewMarket() *Market {
-	state := MarketState{
-		Portfolio:   NewPortfolio("main"),
-		Alternative: make(map[dto.Isin]*Portfolio),
-		Prices:      make(map[dto.Isin]float64),
-		History:     make(map[dto.Isin][]float64),
+// Test backtests the pairwise strategy on the candles of the instruments converted into RUB.
+// Metrics are calculated in each numeraire: the strategy first, then long-only entries on cointegrated pairs if enabled,
+// rebalancing by each method and buy-and-hold of each instrument.
+func (ss *StrategyService) Test(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle) (backtest.Result, []backtest.Metrics, error) {
+	execution, err := ss.execution(instruments)
+	if err != nil {
+		return backtest.Result{}, nil, fmt.Errorf("StrategyService.Test: %w", err)
+	}
+	names := make(map[dto.Isin]string)
+	for _, i := range instruments {
+		if i != nil {
+			names[i.Isin] = i.Name
+		}
 	}
-	instruments := make(map[dto.Isin]*dto.Instrument)
-	return &Market{State: state, Instruments: instruments}
-}
 
-func (m *Market) SimulateNextStep(tp TimePrices, prev TimePrices) {
-	// fmt.Printf("Time: %s\n", tp.Time)
-	// for isin, candle := range tp.Prices {
-	// 	fmt.Printf("\t%s -> Open: %.2f,\tClose: %.2f\t| %s\n", isin, candle.Open, candle.Close, m.Instruments[isin].Name)
-	// }
-
-	fmt.Println("--------------")
-	beforeAfter := map[dto.Isin][3]float64{}
-	for isin := range tp.Prices {
-		before := prev.Prices[isin].Close
-		if before <= 0 {
-			continue
+	candlesByIsin = ss.valuation.ToRUB(instruments, candlesByIsin)
+	bars := backtest.GroupCandlesByTime(candlesByIsin)
+	var policy sizing.Policy
+	if ss.config.Sizing {
+		if policy, err = sizingPolicy(ss.sizing); err != nil {
+			return backtest.Result{}, nil, fmt.Errorf("StrategyService.Test: %w", err)
 		}
-		after := tp.Prices[isin].Close
-		change := (after - before) / before * 100
-		beforeAfter[isin] = [3]float64{before, after, change}
-		m.State.Prices[isin] = after
-		fmt.Printf("%s: %.2f -> %.2f (%.2f%%) | %s\n", isin, before, after, change, m.Instruments[isin].Name)
-	}
-	fmt.Println("--------------")
-
-	// Структура для хранения результатов
-	type DiffResult struct {
-		Active1        dto.Isin
-		Active2        dto.Isin
-		DiffPercentage float64
-	}
-	type Step struct {
-		diffs []DiffResult
-	}
-	var step Step
-	for isin, change := range beforeAfter {
-		for isin2, change2 := range beforeAfter {
-			diff := (change[2] - change2[2])
-			if diff == 0 || isin == GoldIsin || isin2 == GoldIsin {
-				continue
-			}
-			step.diffs = append(step.diffs, DiffResult{Active1: isin, Active2: isin2, DiffPercentage: diff})
-			fmt.Printf("%s / %s:  %.2f%%\n",
-				m.Instruments[isin].Name, m.Instruments[isin2].Name, diff)
+		if ss.sizing.Policy == "fixed-risk" {
+			// у стратегии нет стопов, по риску до стопа позиция не открылась бы
+			ss.logger.Warn("Pairwise strategy has no stops: fixed-risk sizing is replaced by all cash")
+			policy = nil
 		}
 	}
-
-	// Сортируем по убыванию разницы
-	sort.Slice(step.diffs, func(i, j int) bool {
-		// return step.diffs[i].DiffPercentage > step.diffs[j].DiffPercentage
-		return step.diffs[i].DiffPercentage < step.diffs[j].DiffPercentage
+	strategy := backtest.NewPairwiseStrategy(backtest.PairwiseOptions{
+		Exclude:   ss.holders(),
+		Tradable:  ss.tradable(candlesByIsin, ss.config.Regimes),
+		Sizing:    policy,
+		MaxWeight: ss.sizing.MaxWeight,
+		ATRPeriod: ss.sizing.ATRPeriod,
+		Window:    ss.sizing.Window,
 	})
+	result := backtest.NewEngine(backtest.NewSimBroker(ss.config.Cash, execution), strategy).Run(bars)
 
-	// 1 Strategy
-	isAct := false
-	fmt.Println("Изменения:")
-	for i := 0; i < len(step.diffs); i++ {
-		fmt.Printf("%s / %s: %.2f%%\n", m.Instruments[step.diffs[i].Active1].Name, m.Instruments[step.diffs[i].Active2].Name, step.diffs[i].DiffPercentage)
-		// переводим актив из дорогого в дешевый?
-		if !isAct && step.diffs[i].DiffPercentage < 0 {
-			m.State.Portfolio.Sale(step.diffs[i].Active2, tp.Prices[step.diffs[i].Active2].Close)
-			// if isSale {
-			isBuy := m.State.Portfolio.Buy(step.diffs[i].Active1, tp.Prices[step.diffs[i].Active1].Close)
-			if isBuy {
-				isAct = true
-				continue
+	for _, f := range result.Fills {
+		ss.logger.Debug("Fill", "time", f.Time, "side", f.Side.String(), "instrument", names[f.Isin],
+			"quantity", f.Quantity, "price", f.Price, "value", f.Value(), "commission", f.Commission)
+	}
+	for _, o := range result.Rejected {
+		ss.logger.Warn("Order rejected", "time", o.Time, "side", o.Side.String(), "instrument", names[o.Isin])
+	}
+	numeraires := ss.valuation.Numeraires(ss.config.RiskFree)
+	ss.logResult(result, names, numeraires)
+
+	var isins []dto.Isin
+	for isin := range candlesByIsin {
+		isins = append(isins, isin)
+	}
+	sortIsins(isins)
+	rebalanced, err := ss.rebalance(instruments, bars, names)
+	if err != nil {
+		return result, nil, fmt.Errorf("StrategyService.Test: %w", err)
+	}
+	var pairs *backtest.Result
+	if ss.config.Pairs.Enabled {
+		r, err := ss.pairs(instruments, bars, names)
+		if err != nil {
+			return result, nil, fmt.Errorf("StrategyService.Test: %w", err)
+		}
+		pairs = &r
+	}
+	var metrics []backtest.Metrics
+	for _, n := range numeraires {
+		metrics = append(metrics, backtest.CalculateMetrics("Pairwise", result.Equity, result.Fills, n))
+		if pairs != nil {
+			metrics = append(metrics, backtest.CalculateMetrics("Pairs long-only", pairs.Equity, pairs.Fills, n))
+		}
+		for _, r := range rebalanced {
+			metrics = append(metrics, backtest.CalculateMetrics("Rebalance "+r.name, r.result.Equity, r.result.Fills, n))
+		}
+		for _, isin := range isins {
+			name := names[isin]
+			if holder, exists := ss.valuation.Holders()[isin]; exists {
+				name = holder
 			}
+			curve := backtest.BuyAndHold(bars, isin, ss.config.Cash)
+			metrics = append(metrics, backtest.CalculateMetrics("B&H "+name, curve, nil, n))
 		}
 	}
+	return result, metrics, nil
+}
 
-	// 2 Alt
-	for i := 0; i < len(step.diffs); i++ {
-		isin := step.diffs[i].Active1
-		if m.State.Alternative[isin] == nil {
-			m.State.Alternative[isin] = NewPortfolio(fmt.Sprintf("Alternative #%d", i))
-			pp := m.State.Alternative[isin]
-			pp.Amount = m.GetAmountInRub(m.State.Portfolio)
-			// // pp.Sale(diffs[i].Active1, tp.Prices[diffs[i].Active1].Close)
-			pp.Buy(step.diffs[i].Active1, tp.Prices[step.diffs[i].Active1].Close)
-			m.State.Alternative[isin] = pp
+// weightMethod returns the rebalancing method by its name.
+func (ss *StrategyService) weightMethod(name string) (backtest.WeightMethod, error) {
+	switch name {
+	case "equal":
+		return backtest.EqualWeights, nil
+	case "custom":
+		weights := make(map[dto.Isin]float64)
+		for isin, w := range ss.config.Rebalance.Weights {
+			weights[dto.Isin(isin)] = w
 		}
+		return backtest.FixedWeights(weights), nil
+	case "inverse-volatility":
+		return analytics.InverseVolatilityWeights, nil
+	case "risk-parity":
+		return analytics.RiskParityWeights, nil
+	case "min-variance":
+		return analytics.MinVarianceWeights, nil
 	}
+	return nil, fmt.Errorf("unknown rebalancing method `%s`", name)
+}
 
-	m.PrintPortfolio(m.State.Portfolio, false)
-	for _, alt := range m.State.Alternative {
-		m.PrintPortfolio(alt, true)
-	}
+type rebalanced struct {
+	name   string
+	result backtest.Result
 }
 
-func GroupCandlesByTime(candlesByIsin map[dto.Isin][]dto.Candle) []TimePrices {
-	timeMap := make(map[time.Time]map[dto.Isin]dto.Candle)
-	for isin, candles := range candlesByIsin {
-		for _, candle := range candles {
-			if _, exists := timeMap[candle.Time]; !exists {
-				timeMap[candle.Time] = make(map[dto.Isin]dto.Candle)
-			}
-			timeMap[candle.Time][isin] = candle
+// rebalance backtests rebalancing to the target weights by each method from the config.
+func (ss *StrategyService) rebalance(instruments []*dto.Instrument, bars []backtest.TimePrices, names map[dto.Isin]string) ([]rebalanced, error) {
+	rc := ss.config.Rebalance
+	var results []rebalanced
+	for _, name := range rc.Methods {
+		method, err := ss.weightMethod(name)
+		if err != nil {
+			return nil, fmt.Errorf("StrategyService.rebalance: %w", err)
+		}
+		// модели проскальзывания хранят состояние, поэтому у каждого запуска своя
+		execution, err := ss.execution(instruments)
+		if err != nil {
+			return nil, fmt.Errorf("StrategyService.rebalance: %w", err)
+		}
+		strategy := backtest.NewRebalanceStrategy(backtest.RebalanceOptions{
+			Method:    method,
+			Period:    rc.Period,
+			Threshold: rc.Threshold,
+			Window:    rc.Window,
+		})
+		result := backtest.NewEngine(backtest.NewSimBroker(ss.config.Cash, execution), strategy).Run(bars)
+		ss.logger.Info("Rebalance", "method", name, "fills", len(result.Fills), "realized", result.Realized)
+		for _, h := range result.Holdings {
+			ss.logger.Debug("Rebalance position", "method", name, "instrument", names[h.Isin],
+				"quantity", h.Quantity, "averagePrice", h.AveragePrice(), "value", h.Quantity*result.Prices[h.Isin])
 		}
+		results = append(results, rebalanced{name: name, result: result})
 	}
-	// Преобразуем map в слайс с сортировкой по времени
-	var timePrices []TimePrices
-	for t, prices := range timeMap {
-		timePrices = append(timePrices, TimePrices{Time: t, Prices: prices})
+	return results, nil
+}
+
+// WriteReport writes the metrics as a text table.
+func (ss *StrategyService) WriteReport(w io.Writer, metrics []backtest.Metrics) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Name\tIn\tReturn\tCAGR\tVol\tSharpe\tSortino\tCalmar\tMaxDD\tDD days\tExposure\tTurnover\tTrades\tWin rate\tPF\t")
+	for _, m := range metrics {
+		fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t%.1f%%\t%.1f%%\t%.2f\t%.2f\t%.2f\t%.1f%%\t%d\t%.0f%%\t%.1f\t%d\t%.0f%%\t%.2f\t\n",
+			m.Name, m.Numeraire, m.TotalReturn*100, m.CAGR*100, m.Volatility*100, m.Sharpe, m.Sortino, m.Calmar,
+			m.MaxDrawdown*100, m.MaxDrawdownDays, m.Exposure*100, m.Turnover, m.Trades, m.WinRate*100, m.ProfitFactor)
 	}
-	sort.Slice(timePrices, func(i, j int) bool {
-		return timePrices[i].Time.Before(timePrices[j].Time)
-	})
-	return timePrices
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("StrategyService.WriteReport: %w", err)
+	}
+	return nil
 }
 
-func (ss *StrategyService) Test(instruments []*dto.Instrument) {
-	ss.logger.Debug("Instruments", "is", instruments)
+// SaveReport stores the metrics as JSON.
+func (ss *StrategyService) SaveReport(metrics []backtest.Metrics) error {
+	data, err := json.MarshalIndent(metrics, "", "  ")
+	if err != nil {
+		return fmt.Errorf("StrategyService.SaveReport: %w", err)
+	}
+	if err := os.WriteFile(ss.config.Report, data, 0o644); err != nil {
+		return fmt.Errorf("StrategyService.SaveReport: %w", err)
+	}
+	return nil
+}
 
-	instrs := make(map[dto.Isin]*dto.Instrument)
-	candlesByIsin := make(map[dto.Isin][]dto.Candle)
-	for _, inst := range instruments {
-		instrs[inst.Isin] = inst
-		candles, err := ss.tinkoff.GetCandles(inst)
-		if err != nil {
-			ss.logger.Error("StrategyService.Test: %w", err)
-		}
-		candlesByIsin[inst.Isin] = candles
+func (ss *StrategyService) logResult(result backtest.Result, names map[dto.Isin]string, numeraires []dto.Numeraire) {
+	if len(result.Equity) == 0 {
+		ss.logger.Warn("Backtest: no bars")
+		return
 	}
-	market := NewMarket()
-	market.Instruments = instrs
-	// market.State.Portfolio.Amount = 1000
-	grouped := GroupCandlesByTime(candlesByIsin)
-	for i := range grouped {
-		if i <= 0 { // skip first
-			continue
+	equity := result.Equity[len(result.Equity)-1].Equity
+	var commission, slippage float64
+	for _, f := range result.Fills {
+		commission += f.Commission
+		slippage += f.Slippage
+	}
+	ss.logger.Info("Backtest result", "cash", result.Cash, "equity", equity, "fills", len(result.Fills),
+		"commission", commission, "slippage", slippage, "realized", result.Realized)
+	last := result.Equity[len(result.Equity)-1].Time
+	for _, n := range numeraires {
+		if value, ok := analytics.ToNumeraire(equity, n, last); ok {
+			ss.logger.Info("Equity", "numeraire", n.Name, "value", value)
 		}
-		market.SimulateNextStep(grouped[i], grouped[i-1])
-		fmt.Scanln()
 	}
-	fmt.Println(market.State.Portfolio)
+	for _, h := range result.Holdings {
+		price := result.Prices[h.Isin]
+		ss.logger.Info("Position", "instrument", names[h.Isin], "quantity", h.Quantity, "value", h.Quantity*price,
+			"averagePrice", h.AveragePrice(), "unrealized", h.Unrealized(price), "realized", h.Realized)
+	}
+}
+
+func sortIsins(isins []dto.Isin) []dto.Isin {
+	sort.Slice(isins, func(i, j int) bool {
+		return isins[i] < isins[j]
+	})
+	return isins
 }
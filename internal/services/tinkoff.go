@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/russianinvestments/invest-api-go-sdk/investgo"
@@ -15,12 +16,16 @@ type TinkoffConfig struct {
 	AppName string
 	Host    string
 	Token   string
+	// Песочница: Host и Token песочницы, счёт открывается при первой синхронизации
+	Sandbox bool
 }
 
 type TinkoffService struct {
 	config TinkoffConfig
 	logger logging.Logger
 	client *investgo.Client
+	// Инструменты по UID брокера: в операциях и позициях нет ISIN
+	instruments map[string]*dto.Instrument
 }
 
 func NewTinkoffService(config TinkoffConfig, logger logging.Logger) (*TinkoffService, error) {
@@ -36,9 +41,10 @@ func NewTinkoffService(config TinkoffConfig, logger logging.Logger) (*TinkoffSer
 		return nil, fmt.Errorf("client creating error %w", err)
 	}
 	return &TinkoffService{
-		config: config,
-		logger: logger,
-		client: client,
+		config:      config,
+		logger:      logger,
+		client:      client,
+		instruments: make(map[string]*dto.Instrument),
 	}, nil
 }
 
@@ -50,31 +56,35 @@ func (t *TinkoffService) Stop() {
 	}
 }
 
+// Дневные свечи API отдаёт не больше чем за год на запрос
+const candlesRequestPeriod = 360 * 24 * time.Hour
+
 // Разово получить котировки по инструменту
 func (t *TinkoffService) GetCandles(instrument *dto.Instrument) ([]dto.Candle, error) {
+	return t.GetCandlesFrom(instrument, time.Now().Add(-24*30*12*time.Hour))
+}
+
+// GetCandlesFrom loads daily candles since `from` by requests of a year.
+func (t *TinkoffService) GetCandlesFrom(instrument *dto.Instrument, from time.Time) ([]dto.Candle, error) {
 	var candles []dto.Candle
-	dates := [][]time.Time{
-		// {
-		// 	time.Now().Add(-24 * 30 * 24 * time.Hour),
-		// 	time.Now().Add(-24 * 30 * 12 * time.Hour),
-		// },
-		{
-			time.Now().Add(-24 * 30 * 12 * time.Hour),
-			time.Now().Add(-6 * time.Hour),
-		}}
-	for _, date := range dates {
-		marketDataService := t.client.NewMarketDataServiceClient()
-		candlesResp, err := marketDataService.GetCandles(instrument.Uid, pb.CandleInterval(CandleIntervalDay), date[0], date[1], pb.GetCandlesRequest_CANDLE_SOURCE_UNSPECIFIED)
-		if err != nil {
-			return nil, fmt.Errorf("TinkoffService.getCandles: %w", err)
+	to := time.Now().Add(-6 * time.Hour)
+	marketDataService := t.client.NewMarketDataServiceClient()
+	for start := from; start.Before(to); start = start.Add(candlesRequestPeriod) {
+		end := start.Add(candlesRequestPeriod)
+		if end.After(to) {
+			end = to
 		}
-		ccc := Map(candlesResp.GetCandles())
+		candlesResp, err := marketDataService.GetCandles(instrument.Uid, pb.CandleInterval(CandleIntervalDay), start, end, pb.GetCandlesRequest_CANDLE_SOURCE_UNSPECIFIED)
 		if err != nil {
-			t.logger.Error("GetCandles error", "error", err)
-			return nil, fmt.Errorf("TinkoffService.getCandles: %w", err)
+			return nil, fmt.Errorf("TinkoffService.GetCandlesFrom: %w", err)
+		}
+		for _, c := range Map(candlesResp.GetCandles()) {
+			// свеча на границе периодов может прийти в обоих ответах
+			if len(candles) > 0 && !c.Time.After(candles[len(candles)-1].Time) {
+				continue
+			}
+			candles = append(candles, c)
 		}
-		// t.logger.Debug("GetCandles", "candles", ccc)
-		candles = append(candles, ccc...)
 	}
 	return candles, nil
 }
@@ -89,16 +99,252 @@ func (t *TinkoffService) GetInstrumentIdByQuery(q string) (*dto.Instrument, erro
 	for _, i := range instruments {
 		if i.ApiTradeAvailableFlag {
 			// t.logger.Debug("Instr", "i", i)
-			return &dto.Instrument{
+			instrument := &dto.Instrument{
 				Uid:  i.Uid,
 				Name: i.Name,
 				Isin: dto.Isin(i.Isin),
-			}, nil
+			}
+			if err := t.loadTradingParams(instrument); err != nil {
+				t.logger.Warn("Trading params are not loaded", "isin", instrument.Isin, "error", err)
+			}
+			return instrument, nil
 		}
 	}
 	return nil, nil
 }
 
+// Лот и шаг цены нужны для реалистичного исполнения заявок в бэктесте,
+// валюта - для пересчёта цен в рубли
+func (t *TinkoffService) loadTradingParams(instrument *dto.Instrument) error {
+	instrumentService := t.client.NewInstrumentsServiceClient()
+	resp, err := instrumentService.InstrumentByUid(instrument.Uid)
+	if err != nil {
+		return fmt.Errorf("TinkoffService.loadTradingParams: %w", err)
+	}
+	i := resp.GetInstrument()
+	instrument.Lot = int(i.GetLot())
+	instrument.Currency = i.GetCurrency()
+	if increment := i.GetMinPriceIncrement(); increment != nil {
+		instrument.MinPriceIncrement = increment.ToFloat()
+	}
+	return nil
+}
+
+// Индексы недоступны для торговли через API, поэтому флаг не проверяется.
+// Предпочтение отдаётся точному совпадению тикера.
+func (t *TinkoffService) GetBenchmarkByQuery(q string) (*dto.Instrument, error) {
+	instrumentService := t.client.NewInstrumentsServiceClient()
+	resp, err := instrumentService.FindInstrument(q)
+	if err != nil {
+		return nil, fmt.Errorf("TinkoffService.GetBenchmarkByQuery: %w", err)
+	}
+	instruments := resp.GetInstruments()
+	if len(instruments) == 0 {
+		return nil, fmt.Errorf("TinkoffService.GetBenchmarkByQuery: benchmark `%s` not found", q)
+	}
+	found := instruments[0]
+	for _, i := range instruments {
+		if i.Ticker == q {
+			found = i
+			break
+		}
+	}
+	return &dto.Instrument{
+		Uid:  found.Uid,
+		Name: found.Name,
+		Isin: dto.Isin(found.Isin),
+	}, nil
+}
+
+// IsSandbox reports whether the service works with the sandbox accounts.
+func (t *TinkoffService) IsSandbox() bool {
+	return t.config.Sandbox
+}
+
+// GetAccounts returns all accounts of the token.
+func (t *TinkoffService) GetAccounts() ([]dto.Account, error) {
+	status := pb.AccountStatus_ACCOUNT_STATUS_ALL
+	resp, err := t.client.NewUsersServiceClient().GetAccounts(&status)
+	if err != nil {
+		return nil, fmt.Errorf("TinkoffService.GetAccounts: %w", err)
+	}
+	var accounts []dto.Account
+	for _, a := range resp.GetAccounts() {
+		account := dto.Account{
+			Id:   a.GetId(),
+			Name: a.GetName(),
+			Type: a.GetType().String(),
+		}
+		if opened := a.GetOpenedDate(); opened != nil {
+			account.Opened = opened.AsTime()
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+// OpenSandboxAccount opens the sandbox account and pays in `amount` RUB.
+func (t *TinkoffService) OpenSandboxAccount(amount float64) (dto.Account, error) {
+	if !t.config.Sandbox {
+		return dto.Account{}, fmt.Errorf("TinkoffService.OpenSandboxAccount: sandbox mode is off")
+	}
+	sandbox := t.client.NewSandboxServiceClient()
+	resp, err := sandbox.OpenSandboxAccount()
+	if err != nil {
+		return dto.Account{}, fmt.Errorf("TinkoffService.OpenSandboxAccount: %w", err)
+	}
+	account := dto.Account{Id: resp.GetAccountId(), Name: "sandbox", Opened: time.Now()}
+	if amount > 0 {
+		units, nano := math.Modf(amount)
+		_, err := sandbox.SandboxPayIn(&investgo.SandboxPayInRequest{
+			AccountId: account.Id,
+			Currency:  "RUB",
+			Unit:      int64(units),
+			Nano:      int32(math.Round(nano * 1e9)),
+		})
+		if err != nil {
+			return account, fmt.Errorf("TinkoffService.OpenSandboxAccount: pay in: %w", err)
+		}
+	}
+	return account, nil
+}
+
+// GetPortfolio returns the positions of the account. Итоги пересчитаны брокером в рубли,
+// валютные позиции считаются деньгами.
+func (t *TinkoffService) GetPortfolio(accountId string) (dto.PortfolioSnapshot, error) {
+	resp, err := t.client.NewOperationsServiceClient().GetPortfolio(accountId, pb.PortfolioRequest_RUB)
+	if err != nil {
+		return dto.PortfolioSnapshot{}, fmt.Errorf("TinkoffService.GetPortfolio: %w", err)
+	}
+	snapshot := dto.PortfolioSnapshot{
+		AccountId:     accountId,
+		Time:          time.Now(),
+		Total:         money(resp.GetTotalAmountPortfolio()),
+		Cash:          money(resp.GetTotalAmountCurrencies()),
+		ExpectedYield: quotation(resp.GetExpectedYield()),
+	}
+	for _, p := range resp.GetPositions() {
+		if p.GetInstrumentType() == "currency" {
+			continue
+		}
+		position := dto.PortfolioPosition{
+			Uid:            p.GetInstrumentUid(),
+			InstrumentType: p.GetInstrumentType(),
+			Quantity:       quotation(p.GetQuantity()),
+			AveragePrice:   money(p.GetAveragePositionPrice()),
+			CurrentPrice:   money(p.GetCurrentPrice()),
+			ExpectedYield:  quotation(p.GetExpectedYield()),
+			Currency:       p.GetCurrentPrice().GetCurrency(),
+		}
+		if instrument, err := t.GetInstrumentByUid(position.Uid); err != nil {
+			t.logger.Warn("Position instrument is not loaded", "uid", position.Uid, "error", err)
+		} else {
+			position.Isin = instrument.Isin
+		}
+		snapshot.Positions = append(snapshot.Positions, position)
+	}
+	return snapshot, nil
+}
+
+// GetOperations returns executed operations of the account for the period.
+func (t *TinkoffService) GetOperations(accountId string, from, to time.Time) ([]dto.Operation, error) {
+	resp, err := t.client.NewOperationsServiceClient().GetOperations(&investgo.GetOperationsRequest{
+		AccountId: accountId,
+		State:     pb.OperationState_OPERATION_STATE_EXECUTED,
+		From:      from,
+		To:        to,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("TinkoffService.GetOperations: %w", err)
+	}
+	var operations []dto.Operation
+	for _, o := range resp.GetOperations() {
+		operation := dto.Operation{
+			Id:          o.GetId(),
+			AccountId:   accountId,
+			Type:        operationType(o.GetOperationType()),
+			Description: o.GetType(),
+			Uid:         o.GetInstrumentUid(),
+			Quantity:    float64(o.GetQuantity()),
+			Price:       money(o.GetPrice()),
+			Payment:     money(o.GetPayment()),
+			Currency:    o.GetCurrency(),
+		}
+		if date := o.GetDate(); date != nil {
+			operation.Time = date.AsTime()
+		}
+		if operation.Uid != "" {
+			if instrument, err := t.GetInstrumentByUid(operation.Uid); err != nil {
+				t.logger.Warn("Operation instrument is not loaded", "uid", operation.Uid, "error", err)
+			} else {
+				operation.Isin = instrument.Isin
+			}
+		}
+		operations = append(operations, operation)
+	}
+	return operations, nil
+}
+
+func operationType(t pb.OperationType) dto.OperationType {
+	switch t {
+	case pb.OperationType_OPERATION_TYPE_BUY, pb.OperationType_OPERATION_TYPE_BUY_CARD:
+		return dto.OperationBuy
+	case pb.OperationType_OPERATION_TYPE_SELL, pb.OperationType_OPERATION_TYPE_SELL_CARD:
+		return dto.OperationSell
+	case pb.OperationType_OPERATION_TYPE_DIVIDEND:
+		return dto.OperationDividend
+	case pb.OperationType_OPERATION_TYPE_COUPON:
+		return dto.OperationCoupon
+	case pb.OperationType_OPERATION_TYPE_BROKER_FEE, pb.OperationType_OPERATION_TYPE_SERVICE_FEE,
+		pb.OperationType_OPERATION_TYPE_MARGIN_FEE:
+		return dto.OperationFee
+	case pb.OperationType_OPERATION_TYPE_TAX, pb.OperationType_OPERATION_TYPE_DIVIDEND_TAX,
+		pb.OperationType_OPERATION_TYPE_BOND_TAX:
+		return dto.OperationTax
+	case pb.OperationType_OPERATION_TYPE_INPUT:
+		return dto.OperationDeposit
+	case pb.OperationType_OPERATION_TYPE_OUTPUT:
+		return dto.OperationWithdrawal
+	}
+	return dto.OperationOther
+}
+
+// Необязательные поля ответа могут быть пустыми
+func money(m *pb.MoneyValue) float64 {
+	if m == nil {
+		return 0
+	}
+	return m.ToFloat()
+}
+
+func quotation(q *pb.Quotation) float64 {
+	if q == nil {
+		return 0
+	}
+	return q.ToFloat()
+}
+
+// GetInstrumentByUid loads the instrument once and keeps it for next calls.
+func (t *TinkoffService) GetInstrumentByUid(uid string) (*dto.Instrument, error) {
+	if instrument, exists := t.instruments[uid]; exists {
+		return instrument, nil
+	}
+	resp, err := t.client.NewInstrumentsServiceClient().InstrumentByUid(uid)
+	if err != nil {
+		return nil, fmt.Errorf("TinkoffService.GetInstrumentByUid: %w", err)
+	}
+	i := resp.GetInstrument()
+	instrument := &dto.Instrument{
+		Uid:      uid,
+		Name:     i.GetName(),
+		Isin:     dto.Isin(i.GetIsin()),
+		Lot:      int(i.GetLot()),
+		Currency: i.GetCurrency(),
+	}
+	t.instruments[uid] = instrument
+	return instrument, nil
+}
+
 // Candles
 type CandleInterval int32
 
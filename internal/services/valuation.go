@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/analytics"
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg/config"
+	"github.com/tikhomirovv/lazy-investor/pkg/logging"
+)
+
+// Рубль - базовая единица, в которой ведётся учёт
+const RUB = "RUB"
+
+type ValuationService struct {
+	config  config.ValuationConf
+	logger  logging.Logger
+	tinkoff *TinkoffService
+}
+
+func NewValuationService(config *config.Config, logger logging.Logger, tinkoff *TinkoffService) *ValuationService {
+	return &ValuationService{
+		config:  config.Valuation,
+		logger:  logger,
+		tinkoff: tinkoff,
+	}
+}
+
+// loadCandles loads candles of the instrument found by the query since `from`, нулевое - за последний год.
+func (vs *ValuationService) loadCandles(query string, from time.Time) ([]dto.Candle, error) {
+	instrument, err := vs.tinkoff.GetBenchmarkByQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("ValuationService.loadCandles: %w", err)
+	}
+	var candles []dto.Candle
+	if from.IsZero() {
+		candles, err = vs.tinkoff.GetCandles(instrument)
+	} else {
+		candles, err = vs.tinkoff.GetCandlesFrom(instrument, from)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ValuationService.loadCandles: %w", err)
+	}
+	return candles, nil
+}
+
+// Numeraires loads prices of the configured numeraires. RUB goes first with the given
+// risk-free rate. Единицы, цены которых не загрузились, пропускаются.
+func (vs *ValuationService) Numeraires(riskFree float64) []dto.Numeraire {
+	return vs.numeraires(riskFree, time.Time{})
+}
+
+// numeraires loads prices of the numeraires since `from`.
+func (vs *ValuationService) numeraires(riskFree float64, from time.Time) []dto.Numeraire {
+	numeraires := []dto.Numeraire{{Name: RUB, RiskFree: riskFree}}
+	for _, n := range vs.config.Numeraires {
+		candles, err := vs.loadCandles(n.Query, from)
+		if err != nil || len(candles) == 0 {
+			vs.logger.Error("Load numeraire", "name", n.Name, "query", n.Query, "error", err)
+			continue
+		}
+		numeraires = append(numeraires, dto.Numeraire{Name: n.Name, Prices: candles, RiskFree: n.RiskFree})
+	}
+	return numeraires
+}
+
+// Holders returns names of the numeraires by ISIN of the instruments holding them.
+func (vs *ValuationService) Holders() map[dto.Isin]string {
+	holders := make(map[dto.Isin]string)
+	for _, n := range vs.config.Numeraires {
+		if n.Isin != "" {
+			holders[dto.Isin(n.Isin)] = n.Name
+		}
+	}
+	return holders
+}
+
+// ToRUB converts candles of instruments priced in other currencies into RUB by the
+// currency pair candles. Инструменты без курса валюты исключаются.
+func (vs *ValuationService) ToRUB(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle) map[dto.Isin][]dto.Candle {
+	return vs.toRUB(instruments, candlesByIsin, time.Time{})
+}
+
+// toRUB converts candles by the rates since `from`.
+func (vs *ValuationService) toRUB(instruments []*dto.Instrument, candlesByIsin map[dto.Isin][]dto.Candle, from time.Time) map[dto.Isin][]dto.Candle {
+	converted := make(map[dto.Isin][]dto.Candle, len(candlesByIsin))
+	for isin, candles := range candlesByIsin {
+		converted[isin] = candles
+	}
+	rates := make(map[string][]dto.Candle)
+	for _, i := range instruments {
+		if i == nil || i.Currency == "" || i.Currency == "rub" {
+			continue
+		}
+		if _, loaded := rates[i.Currency]; !loaded {
+			rates[i.Currency] = vs.rates(i.Currency, from)
+		}
+		if len(rates[i.Currency]) == 0 {
+			vs.logger.Warn("Instrument is excluded: no exchange rate", "isin", i.Isin, "currency", i.Currency)
+			delete(converted, i.Isin)
+			continue
+		}
+		converted[i.Isin] = analytics.ConvertCandles(candlesByIsin[i.Isin], rates[i.Currency])
+	}
+	return converted
+}
+
+// rates loads candles of the currency pair to RUB since `from`.
+func (vs *ValuationService) rates(currency string, from time.Time) []dto.Candle {
+	query, exists := vs.config.Currencies[currency]
+	if !exists {
+		vs.logger.Warn("No currency pair", "currency", currency)
+		return nil
+	}
+	candles, err := vs.loadCandles(query, from)
+	if err != nil {
+		vs.logger.Error("Load currency pair", "currency", currency, "error", err)
+		return nil
+	}
+	return candles
+}
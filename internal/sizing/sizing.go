@@ -0,0 +1,166 @@
+package sizing
+
+import (
+	"math"
+
+	"github.com/tikhomirovv/lazy-investor/pkg"
+)
+
+// Количество торговых дней в году для годовой волатильности
+const tradingDays = 252
+
+// Input describes the account and the instrument at the moment of the decision.
+type Input struct {
+	Equity float64 // RUB
+	Cash   float64 // RUB
+	Price  float64
+	Stop   float64 // цена защитного стопа, 0 - нет
+	ATR    float64
+	// Дневные доходности инструмента и портфеля за окно оценки
+	Returns          []float64
+	PortfolioReturns []float64
+	Slots            int // на сколько позиций делится капитал, 0 - одна
+}
+
+// Policy decides how much of the equity goes into a new position.
+type Policy interface {
+	// Value returns the position value in RUB before limits
+	Value(in Input) float64
+}
+
+func (in Input) share() float64 {
+	if in.Slots <= 1 {
+		return in.Equity
+	}
+	return in.Equity / float64(in.Slots)
+}
+
+// Size returns the position value by the policy limited by the share `max` of the equity
+// and by the cash: без маржи. max <= 0 - без ограничения доли.
+func Size(p Policy, in Input, max float64) float64 {
+	value := p.Value(in)
+	if math.IsNaN(value) || math.IsInf(value, 0) || value <= 0 {
+		return 0
+	}
+	if max > 0 {
+		value = math.Min(value, in.Equity*max)
+	}
+	return math.Max(0, math.Min(value, in.Cash))
+}
+
+// Quantity rounds the position value down to whole lots at the price. lot <= 0 - дробное количество.
+func Quantity(value, price float64, lot int) float64 {
+	if price <= 0 || value <= 0 {
+		return 0
+	}
+	quantity := value / price
+	if lot <= 0 {
+		return quantity
+	}
+	return math.Floor(quantity/float64(lot)+1e-9) * float64(lot)
+}
+
+// Volatility returns the annual volatility of daily returns.
+func Volatility(returns []float64) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+	return pkg.StandardDeviation(returns) * math.Sqrt(tradingDays)
+}
+
+// EqualShare splits the equity equally between the slots.
+type EqualShare struct{}
+
+func (EqualShare) Value(in Input) float64 {
+	return in.share()
+}
+
+// FixedFraction invests the fraction of the equity.
+type FixedFraction struct {
+	Fraction float64
+}
+
+func (p FixedFraction) Value(in Input) float64 {
+	return in.Equity * p.Fraction
+}
+
+// FixedRisk loses the fraction `Risk` of the equity when the stop is hit.
+// Без стопа позиция не открывается.
+type FixedRisk struct {
+	Risk float64
+}
+
+func (p FixedRisk) Value(in Input) float64 {
+	distance := in.Price - in.Stop
+	if in.Stop <= 0 || distance <= 0 {
+		return 0
+	}
+	return in.Equity * p.Risk / distance * in.Price
+}
+
+// ATRRisk loses the fraction `Risk` of the equity on the move of `Multiplier` ATR.
+type ATRRisk struct {
+	Risk       float64
+	Multiplier float64
+}
+
+func (p ATRRisk) Value(in Input) float64 {
+	move := in.ATR * p.Multiplier
+	if move <= 0 {
+		return 0
+	}
+	return in.Equity * p.Risk / move * in.Price
+}
+
+// InverseVolatility sizes each slot so that its annual volatility equals the target.
+type InverseVolatility struct {
+	Target float64
+}
+
+func (p InverseVolatility) Value(in Input) float64 {
+	volatility := Volatility(in.Returns)
+	if volatility <= 1e-9 {
+		return 0
+	}
+	return in.share() * p.Target / volatility
+}
+
+// VolatilityTarget scales equal slots so that the annual volatility of the portfolio equals
+// the target. Без истории портфеля - по волатильности инструмента.
+type VolatilityTarget struct {
+	Target float64
+}
+
+func (p VolatilityTarget) Value(in Input) float64 {
+	volatility := Volatility(in.PortfolioReturns)
+	if volatility <= 1e-9 {
+		volatility = Volatility(in.Returns)
+	}
+	if volatility <= 1e-9 {
+		return 0
+	}
+	return in.share() * p.Target / volatility
+}
+
+// Kelly invests the fraction of the Kelly criterion by daily returns mean / variance
+// but not more than `Cap` of the equity. Полный Kelly слишком агрессивен из-за ошибки оценки,
+// поэтому обычно берут половину или меньше.
+type Kelly struct {
+	Fraction float64
+	Cap      float64
+}
+
+func (p Kelly) Value(in Input) float64 {
+	if len(in.Returns) < 2 {
+		return 0
+	}
+	variance := math.Pow(pkg.StandardDeviation(in.Returns), 2)
+	if variance <= 1e-12 {
+		return 0
+	}
+	f := p.Fraction * pkg.Average(in.Returns) / variance
+	if p.Cap > 0 {
+		f = math.Min(f, p.Cap)
+	}
+	return in.Equity * math.Max(0, f)
+}
@@ -0,0 +1,247 @@
+package synthetic
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/tikhomirovv/lazy-investor/internal/dto"
+	"github.com/tikhomirovv/lazy-investor/pkg"
+)
+
+// Количество торговых дней в году для перевода годовых параметров в дневные
+const tradingDays = 252
+
+// Asset describes the price process of one instrument. Доходность и волатильность - годовые.
+type Asset struct {
+	Isin       dto.Isin
+	Price      float64 // начальная цена
+	Drift      float64
+	Volatility float64
+	Volume     float64 // средний дневной объём, лотов
+}
+
+// Jumps of the Merton model: logarithm of the jump size is normal.
+type Jumps struct {
+	Intensity float64 // скачков в год, 0 - без скачков
+	Mean      float64
+	StdDev    float64
+}
+
+// GARCH(1,1) daily variance: ω + α·r² + β·σ², ω подбирается под волатильность актива.
+type GARCH struct {
+	Alpha float64 // 0 - постоянная волатильность
+	Beta  float64
+}
+
+// Regime shifts the drift and scales the volatility of all assets.
+type Regime struct {
+	Name            string
+	Drift           float64 // прибавляется к годовой доходности активов
+	VolatilityScale float64
+}
+
+type Options struct {
+	Start         time.Time
+	Days          int // торговых дней, выходные пропускаются
+	StepsPerDay   int // шагов внутри дня для High и Low
+	Seed          int64
+	Assets        []Asset
+	Correlation   [][]float64 // корреляция шоков активов, nil - независимые
+	Jumps         Jumps
+	GARCH         GARCH
+	Regimes       []Regime
+	Transitions   [][]float64 // вероятности перехода между режимами за день
+	InitialRegime int
+}
+
+// Market is the generated history.
+type Market struct {
+	Candles map[dto.Isin][]dto.Candle
+	Regimes []string // режим каждого дня, если режимы заданы
+}
+
+// Generate simulates daily candles of correlated assets by geometric Brownian motion with
+// optional jumps, GARCH volatility and regime switching. Одинаковый seed даёт одинаковую историю.
+func Generate(opts Options) (Market, error) {
+	n := len(opts.Assets)
+	market := Market{Candles: make(map[dto.Isin][]dto.Candle, n)}
+	if n == 0 || opts.Days <= 0 {
+		return market, nil
+	}
+	if err := validate(opts); err != nil {
+		return market, fmt.Errorf("synthetic.Generate: %w", err)
+	}
+	var cholesky [][]float64
+	if opts.Correlation != nil {
+		var err error
+		if cholesky, err = pkg.Cholesky(opts.Correlation); err != nil {
+			return market, fmt.Errorf("synthetic.Generate: %w", err)
+		}
+	}
+	steps := opts.StepsPerDay
+	if steps <= 0 {
+		steps = 1
+	}
+	dt := 1.0 / tradingDays / float64(steps)
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	prices := make([]float64, n)
+	variances := make([]float64, n) // дневная дисперсия GARCH
+	for i, a := range opts.Assets {
+		prices[i] = a.Price
+		variances[i] = a.Volatility * a.Volatility / tradingDays
+	}
+	// компенсация скачков, чтобы средняя доходность не менялась
+	jumpCompensation := opts.Jumps.Intensity * (math.Exp(opts.Jumps.Mean+opts.Jumps.StdDev*opts.Jumps.StdDev/2) - 1)
+
+	regime := opts.InitialRegime
+	day := opts.Start
+	for d := 0; d < opts.Days; d++ {
+		for day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			day = day.AddDate(0, 0, 1)
+		}
+		drift, scale := 0.0, 1.0
+		if len(opts.Regimes) > 0 {
+			if d > 0 && opts.Transitions != nil {
+				regime = nextRegime(rng, opts.Transitions[regime])
+			}
+			drift, scale = opts.Regimes[regime].Drift, opts.Regimes[regime].VolatilityScale
+			market.Regimes = append(market.Regimes, opts.Regimes[regime].Name)
+		}
+
+		candles := make([]dto.Candle, n)
+		for i := range opts.Assets {
+			candles[i] = dto.Candle{Open: prices[i], High: prices[i], Low: prices[i], Time: day, IsComplete: true}
+		}
+		opens := append([]float64(nil), prices...)
+		for s := 0; s < steps; s++ {
+			shocks := correlated(rng, n, cholesky)
+			for i, a := range opts.Assets {
+				sigma := math.Sqrt(variances[i]*tradingDays) * scale
+				mu := a.Drift + drift - jumpCompensation
+				logReturn := (mu-sigma*sigma/2)*dt + sigma*math.Sqrt(dt)*shocks[i]
+				if opts.Jumps.Intensity > 0 && rng.Float64() < opts.Jumps.Intensity*dt {
+					logReturn += opts.Jumps.Mean + opts.Jumps.StdDev*rng.NormFloat64()
+				}
+				prices[i] *= math.Exp(logReturn)
+				candles[i].High = math.Max(candles[i].High, prices[i])
+				candles[i].Low = math.Min(candles[i].Low, prices[i])
+			}
+		}
+		for i, a := range opts.Assets {
+			c := &candles[i]
+			c.Close = prices[i]
+			r := math.Log(c.Close / opens[i])
+			dailyVol := math.Sqrt(variances[i])
+			// объём растёт вместе с размером движения
+			volume := a.Volume * math.Exp(0.3*rng.NormFloat64())
+			if dailyVol > 0 {
+				volume *= 1 + math.Abs(r)/dailyVol/2
+			}
+			c.Volume = int64(volume)
+			if opts.GARCH.Alpha > 0 || opts.GARCH.Beta > 0 {
+				target := a.Volatility * a.Volatility / tradingDays
+				omega := target * (1 - opts.GARCH.Alpha - opts.GARCH.Beta)
+				variances[i] = omega + opts.GARCH.Alpha*r*r + opts.GARCH.Beta*variances[i]
+			}
+			market.Candles[a.Isin] = append(market.Candles[a.Isin], *c)
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return market, nil
+}
+
+// tolerance of sums and matrix elements compared with their exact values.
+const tolerance = 1e-9
+
+func validate(opts Options) error {
+	n := len(opts.Assets)
+	for _, a := range opts.Assets {
+		if a.Price <= 0 || a.Volatility < 0 {
+			return fmt.Errorf("asset %s: price must be positive and volatility not negative", a.Isin)
+		}
+	}
+	if opts.Correlation != nil && len(opts.Correlation) != n {
+		return fmt.Errorf("correlation matrix must be %dx%d", n, n)
+	}
+	for i, row := range opts.Correlation {
+		if len(row) != n {
+			return fmt.Errorf("correlation matrix must be %dx%d", n, n)
+		}
+		if math.Abs(row[i]-1) > tolerance {
+			return fmt.Errorf("correlation matrix must have unit diagonal")
+		}
+		for j := 0; j < i; j++ {
+			if math.Abs(row[j]-opts.Correlation[j][i]) > tolerance {
+				return fmt.Errorf("correlation matrix must be symmetric")
+			}
+		}
+	}
+	if opts.Jumps.Intensity < 0 || opts.Jumps.StdDev < 0 {
+		return fmt.Errorf("jumps: intensity and standard deviation must be not negative")
+	}
+	if opts.GARCH.Alpha < 0 || opts.GARCH.Beta < 0 || opts.GARCH.Alpha+opts.GARCH.Beta >= 1 {
+		return fmt.Errorf("GARCH: alpha and beta must be not negative with sum below 1")
+	}
+	if len(opts.Regimes) > 0 {
+		if opts.InitialRegime < 0 || opts.InitialRegime >= len(opts.Regimes) {
+			return fmt.Errorf("initial regime %d is out of range", opts.InitialRegime)
+		}
+		if opts.Transitions != nil && len(opts.Transitions) != len(opts.Regimes) {
+			return fmt.Errorf("transitions must be %dx%d", len(opts.Regimes), len(opts.Regimes))
+		}
+		for i, row := range opts.Transitions {
+			if len(row) != len(opts.Regimes) {
+				return fmt.Errorf("transitions must be %dx%d", len(opts.Regimes), len(opts.Regimes))
+			}
+			var sum float64
+			for _, p := range row {
+				if p < 0 {
+					return fmt.Errorf("transitions row %d: probabilities must be not negative", i)
+				}
+				sum += p
+			}
+			if math.Abs(sum-1) > tolerance {
+				return fmt.Errorf("transitions row %d: probabilities must sum to 1", i)
+			}
+		}
+		for _, r := range opts.Regimes {
+			if r.VolatilityScale < 0 {
+				return fmt.Errorf("regime volatility scale must be not negative")
+			}
+		}
+	}
+	return nil
+}
+
+// correlated returns standard normal shocks correlated by the Cholesky factor.
+func correlated(rng *rand.Rand, n int, cholesky [][]float64) []float64 {
+	z := make([]float64, n)
+	for i := range z {
+		z[i] = rng.NormFloat64()
+	}
+	if cholesky == nil {
+		return z
+	}
+	shocks := make([]float64, n)
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			shocks[i] += cholesky[i][j] * z[j]
+		}
+	}
+	return shocks
+}
+
+func nextRegime(rng *rand.Rand, probabilities []float64) int {
+	u := rng.Float64()
+	var sum float64
+	for i, p := range probabilities {
+		sum += p
+		if u < sum {
+			return i
+		}
+	}
+	return len(probabilities) - 1
+}
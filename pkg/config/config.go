@@ -10,9 +10,387 @@ import (
 type InstConf struct {
 	Isin string
 }
+
+// Индекс, с которым сравниваются инструменты (тикер, ISIN или FIGI)
+type BenchConf struct {
+	Query string `yaml:"query"`
+}
+
+// Правила движка рекомендаций
+type RecommendationConf struct {
+	SwingPeriod       int                `yaml:"swingPeriod"`
+	Timeframes        map[string]float64 `yaml:"timeframes"`     // вес тренда таймфрейма (day, week, month)
+	Phases            map[string]float64 `yaml:"phases"`         // множитель по фазе (breakout, movement, correction, range)
+	LevelTolerance    float64            `yaml:"levelTolerance"` // ширина уровня (доля цены)
+	LevelDistance     float64            `yaml:"levelDistance"`  // близость к уровню (доля цены)
+	LevelPenalty      float64            `yaml:"levelPenalty"`
+	ATRPeriod         int                `yaml:"atrPeriod"`
+	MaxVolatility     float64            `yaml:"maxVolatility"` // ATR / Close
+	VolatilityPenalty float64            `yaml:"volatilityPenalty"`
+	BenchmarkPenalty  float64            `yaml:"benchmarkPenalty"`
+	MinConfidence     float64            `yaml:"minConfidence"`
+}
+
+// Допуски свечных паттернов (доли диапазона свечи)
+type PatternConf struct {
+	DojiBody    float64 `yaml:"dojiBody"`
+	SmallBody   float64 `yaml:"smallBody"`
+	LongBody    float64 `yaml:"longBody"`
+	ShadowRatio float64 `yaml:"shadowRatio"` // относительно тела
+	MaxShadow   float64 `yaml:"maxShadow"`
+	Lookback    int     `yaml:"lookback"`
+	// Расстояние до уровня, на котором паттерн считается подтверждением
+	LevelDistance float64 `yaml:"levelDistance"`
+}
+
+// Определение режима рынка
+type RegimeConf struct {
+	Window             int     `yaml:"window"`
+	ADXPeriod          int     `yaml:"adxPeriod"`
+	ADXTrend           float64 `yaml:"adxTrend"`
+	HurstTrend         float64 `yaml:"hurstTrend"`
+	HurstMeanReversion float64 `yaml:"hurstMeanReversion"`
+	VarianceRatioLag   int     `yaml:"varianceRatioLag"`
+	MaxVolatility      float64 `yaml:"maxVolatility"` // годовая
+	HMMStates          int     `yaml:"hmmStates"`     // 0 - без HMM
+	HMMIterations      int     `yaml:"hmmIterations"`
+}
+
+type StrategyConf struct {
+	// Режимы рынка (trending, mean-reverting, volatile, unknown), в которых стратегия торгует.
+	// Пусто - торгует всегда
+	Regimes []string `yaml:"regimes"`
+	// Размер покупки по sizing, иначе на все свободные деньги
+	Sizing     bool           `yaml:"sizing"`
+	Cash       float64        `yaml:"cash"`     // начальный капитал бэктеста, RUB
+	RiskFree   float64        `yaml:"riskFree"` // годовая безрисковая ставка в рублях для Sharpe и Sortino
+	Report     string         `yaml:"report"`   // файл с метриками в JSON
+	Execution  ExecutionConf  `yaml:"execution"`
+	Optimize   OptimizeConf   `yaml:"optimize"`
+	MonteCarlo MonteCarloConf `yaml:"monteCarlo"`
+	Rebalance  RebalanceConf  `yaml:"rebalance"`
+	Pairs      PairsConf      `yaml:"pairs"`
+}
+
+// Ребалансировка к целевым весам для сравнения с основной стратегией
+type RebalanceConf struct {
+	// equal, custom, inverse-volatility, risk-parity, min-variance; пусто - не сравнивать
+	Methods   []string           `yaml:"methods"`
+	Weights   map[string]float64 `yaml:"weights"`   // ISIN -> вес для custom
+	Period    string             `yaml:"period"`    // week, month, quarter, year; пусто - только по порогу
+	Threshold float64            `yaml:"threshold"` // отклонение доли от целевой, 0 - только по календарю
+	Window    int                `yaml:"window"`    // дней для ковариации
+}
+
+// Поиск коинтегрированных пар и покупка дешёвой ноги при расхождении спреда: без шортов спред не хеджируется
+type PairsConf struct {
+	Enabled      bool    `yaml:"enabled"`
+	Formation    int     `yaml:"formation"`    // баров для теста коинтеграции и коэффициента хеджирования
+	Refit        int     `yaml:"refit"`        // баров между поисками пар в бэктесте
+	Entry        float64 `yaml:"entry"`        // отклонение спреда для входа, стандартных отклонений
+	Exit         float64 `yaml:"exit"`         // отклонение спреда для выхода
+	Stop         float64 `yaml:"stop"`         // отклонение спреда для стопа, 0 - без стопа
+	MaxPairs     int     `yaml:"maxPairs"`     // одновременно торгуемых пар
+	MaxLag       int     `yaml:"maxLag"`       // максимум лагов в ADF
+	Significance float64 `yaml:"significance"` // 0.01, 0.05 или 0.1
+	MaxHalfLife  float64 `yaml:"maxHalfLife"`  // баров, 0 - без ограничения
+}
+
+// Модель исполнения заявок в бэктесте
+type ExecutionConf struct {
+	Tariff        string  `yaml:"tariff"`        // investor, trader, premium; пусто - commission
+	Commission    float64 `yaml:"commission"`    // доля от суммы сделки
+	MinCommission float64 `yaml:"minCommission"` // RUB
+	Slippage      string  `yaml:"slippage"`      // none, fixed, atr, volume
+	SlippageBps   float64 `yaml:"slippageBps"`
+	ATRPeriod     int     `yaml:"atrPeriod"`
+	ATRFraction   float64 `yaml:"atrFraction"`  // доля ATR
+	VolumeImpact  float64 `yaml:"volumeImpact"` // множитель корня из доли в объёме
+}
+
+// Размер новой позиции в бэктесте трендовой стратегии и в рекомендациях
+type SizingConf struct {
+	// equal, fixed-fraction, fixed-risk, atr, inverse-volatility, volatility-target, kelly
+	Policy        string  `yaml:"policy"`
+	Fraction      float64 `yaml:"fraction"`      // доля капитала для fixed-fraction, доля Kelly для kelly
+	Risk          float64 `yaml:"risk"`          // доля капитала под риском на сделку для fixed-risk и atr
+	ATRMultiplier float64 `yaml:"atrMultiplier"` // движение в ATR, на котором теряется risk
+	ATRPeriod     int     `yaml:"atrPeriod"`
+	Target        float64 `yaml:"target"`    // годовая волатильность для inverse-volatility и volatility-target
+	MaxWeight     float64 `yaml:"maxWeight"` // максимальная доля капитала в позиции, 0 - без ограничения
+	Window        int     `yaml:"window"`    // дней для оценки волатильности и Kelly
+	Capital       float64 `yaml:"capital"`   // капитал для рекомендаций, RUB
+}
+
+// Оптимизация долей по среднему и дисперсии доходностей
+type FrontierConf struct {
+	Enabled    bool               `yaml:"enabled"`
+	Window     int                `yaml:"window"`     // дней истории, 0 - вся общая история
+	RiskFree   float64            `yaml:"riskFree"`   // годовая ставка для Sharpe
+	Points     int                `yaml:"points"`     // точек границы
+	Shrinkage  bool               `yaml:"shrinkage"`  // ковариация по Ледуа-Вулфу
+	MaxWeight  float64            `yaml:"maxWeight"`  // для всех инструментов, 0 - без ограничения
+	MinWeights map[string]float64 `yaml:"minWeights"` // ISIN -> минимальная доля
+	MaxWeights map[string]float64 `yaml:"maxWeights"` // ISIN -> максимальная доля
+	Chart      string             `yaml:"chart"`      // файл графика границы
+}
+
+// Матрицы корреляции и ковариации доходностей инструментов
+type CorrelationConf struct {
+	Window   int    `yaml:"window"`  // окно, дней
+	Step     int    `yaml:"step"`    // шаг скользящего окна
+	Returns  string `yaml:"returns"` // simple | log
+	Clusters int    `yaml:"clusters"`
+}
+
+// Рейтинг инструментов по моментуму
+type RankingConf struct {
+	Periods     []int     `yaml:"periods"` // торговых дней
+	Weights     []float64 `yaml:"weights"` // вес моментума каждого периода
+	RSPeriod    int       `yaml:"rsPeriod"`
+	RSWeight    float64   `yaml:"rsWeight"`
+	TrendWeight float64   `yaml:"trendWeight"`
+	SwingPeriod int       `yaml:"swingPeriod"`
+	StateFile   string    `yaml:"stateFile"` // прошлый рейтинг для изменения мест
+	History     int       `yaml:"history"`   // месяцев свечей: моментуму за 252 дня нужно больше года
+}
+
+// Сглаженные представления свечей для сравнения определения тренда
+type TransformConf struct {
+	Types     []string `yaml:"types"` // heikin-ashi, renko, range
+	Size      float64  `yaml:"size"`  // размер кирпича Renko и range-бара, 0 - по ATR
+	ATRPeriod int      `yaml:"atrPeriod"`
+}
+
+// Уровни Фибоначчи и пивоты, оповещение о касаниях
+type LevelsConf struct {
+	Fibonacci       bool     `yaml:"fibonacci"`
+	Pivots          []string `yaml:"pivots"`          // classic, camarilla, woodie
+	PivotsTimeframe string   `yaml:"pivotsTimeframe"` // week, month
+	TouchTolerance  float64  `yaml:"touchTolerance"`
+}
+
+// Подбор параметров трендовой стратегии с проверкой walk-forward
+type OptimizeConf struct {
+	Enabled     bool        `yaml:"enabled"`
+	Method      string      `yaml:"method"`  // grid | random
+	Samples     int         `yaml:"samples"` // количество наборов для random
+	Seed        int64       `yaml:"seed"`
+	Metric      string      `yaml:"metric"`      // return, cagr, sharpe, sortino, calmar, maxDrawdown, profitFactor, winRate
+	Workers     int         `yaml:"workers"`     // 0 - по числу процессоров
+	InSample    int         `yaml:"inSample"`    // баров для оптимизации
+	OutOfSample int         `yaml:"outOfSample"` // баров для проверки
+	Params      []ParamConf `yaml:"params"`
+	// Режимы рынка, в которых трендовая стратегия открывает позиции; пусто - торговать всегда
+	Regimes []string `yaml:"regimes"`
+}
+
+type ParamConf struct {
+	Name string  `yaml:"name"` // swing, fast, slow, trail (трейлинг-стоп в ATR, 0 - без него)
+	Min  float64 `yaml:"min"`
+	Max  float64 `yaml:"max"`
+	Step float64 `yaml:"step"`
+}
+
+// Устойчивость результата бэктеста к случайности
+type MonteCarloConf struct {
+	Iterations int     `yaml:"iterations"`
+	Confidence float64 `yaml:"confidence"`
+	BlockSize  int     `yaml:"blockSize"` // баров в блоке бутстрепа
+	Seed       int64   `yaml:"seed"`
+	Workers    int     `yaml:"workers"` // 0 - по числу процессоров
+}
+
+// Единицы оценки капитала кроме рубля и валютные пары для пересчёта цен в рубли
+type ValuationConf struct {
+	Numeraires []NumeraireConf   `yaml:"numeraires"`
+	Currencies map[string]string `yaml:"currencies"` // валюта -> запрос пары к рублю
+}
+
+type NumeraireConf struct {
+	Name     string  `yaml:"name"`
+	Query    string  `yaml:"query"`    // инструмент с ценой единицы в рублях
+	RiskFree float64 `yaml:"riskFree"` // годовая безрисковая ставка в этой единице
+	// Инструмент из списка, хранящий эту единицу (фонд на золото): основная и трендовая стратегии им не торгуют,
+	// а его buy-and-hold подписывается именем единицы
+	Isin string `yaml:"isin"`
+}
+
+// Синхронизация счетов, позиций и операций у брокера
+type PortfolioConf struct {
+	Enabled      bool     `yaml:"enabled"`
+	Accounts     []string `yaml:"accounts"`     // ID счетов, пусто - все
+	From         string   `yaml:"from"`         // начало истории операций, YYYY-MM-DD; пусто - с открытия счёта
+	File         string   `yaml:"file"`         // локальная копия портфеля и операций
+	SandboxPayIn float64  `yaml:"sandboxPayIn"` // RUB на новый счёт песочницы
+	// Доходность счетов по операциям (TWR, MWR) и сравнение с теми же вложениями в единицы оценки
+	Performance bool `yaml:"performance"`
+}
+
 type Config struct {
-	LogLevel    string     `yaml:"logLevel"`
-	Instruments []InstConf `yaml:"instruments"`
+	LogLevel       string             `yaml:"logLevel"`
+	Instruments    []InstConf         `yaml:"instruments"`
+	Benchmarks     []BenchConf        `yaml:"benchmarks"`
+	Recommendation RecommendationConf `yaml:"recommendation"`
+	Patterns       PatternConf        `yaml:"patterns"`
+	Regime         RegimeConf         `yaml:"regime"`
+	Strategy       StrategyConf       `yaml:"strategy"`
+	Correlation    CorrelationConf    `yaml:"correlation"`
+	Ranking        RankingConf        `yaml:"ranking"`
+	Transform      TransformConf      `yaml:"transform"`
+	Levels         LevelsConf         `yaml:"levels"`
+	Valuation      ValuationConf      `yaml:"valuation"`
+	Sizing         SizingConf         `yaml:"sizing"`
+	Frontier       FrontierConf       `yaml:"frontier"`
+	Portfolio      PortfolioConf      `yaml:"portfolio"`
+}
+
+func DefaultRecommendationConf() RecommendationConf {
+	return RecommendationConf{
+		SwingPeriod: 2,
+		Timeframes: map[string]float64{
+			"month": 3,
+			"week":  2,
+			"day":   1,
+		},
+		Phases: map[string]float64{
+			"breakout":   1,
+			"movement":   0.8,
+			"correction": 0.5,
+			"range":      0,
+		},
+		LevelTolerance:    0.01,
+		LevelDistance:     0.02,
+		LevelPenalty:      0.3,
+		ATRPeriod:         14,
+		MaxVolatility:     0.05,
+		VolatilityPenalty: 0.5,
+		BenchmarkPenalty:  0.3,
+		MinConfidence:     0.4,
+	}
+}
+
+func DefaultPatternConf() PatternConf {
+	return PatternConf{
+		DojiBody:      0.1,
+		SmallBody:     0.3,
+		LongBody:      0.6,
+		ShadowRatio:   2,
+		MaxShadow:     0.1,
+		Lookback:      3,
+		LevelDistance: 0.01,
+	}
+}
+
+func DefaultRegimeConf() RegimeConf {
+	return RegimeConf{
+		Window:             50,
+		ADXPeriod:          14,
+		ADXTrend:           25,
+		HurstTrend:         0.55,
+		HurstMeanReversion: 0.45,
+		VarianceRatioLag:   5,
+		MaxVolatility:      0.6,
+		HMMIterations:      20,
+	}
+}
+
+func DefaultStrategyConf() StrategyConf {
+	return StrategyConf{
+		Cash:   100000,
+		Report: ".files/backtest.json",
+		Execution: ExecutionConf{
+			Tariff:       "investor",
+			Slippage:     "fixed",
+			SlippageBps:  5,
+			ATRPeriod:    14,
+			ATRFraction:  0.05,
+			VolumeImpact: 0.1,
+		},
+		Optimize: OptimizeConf{
+			Method:      "grid",
+			Samples:     50,
+			Seed:        1,
+			Metric:      "sharpe",
+			InSample:    126,
+			OutOfSample: 42,
+		},
+		MonteCarlo: MonteCarloConf{
+			Iterations: 5000,
+			Confidence: 0.95,
+			BlockSize:  10,
+			Seed:       1,
+		},
+		Rebalance: RebalanceConf{
+			Period:    "quarter",
+			Threshold: 0.05,
+			Window:    60,
+		},
+		Pairs: PairsConf{
+			Formation:    120,
+			Refit:        20,
+			Entry:        2,
+			Exit:         0.5,
+			Stop:         3.5,
+			MaxPairs:     3,
+			MaxLag:       1,
+			Significance: 0.05,
+			MaxHalfLife:  30,
+		},
+	}
+}
+
+func DefaultSizingConf() SizingConf {
+	return SizingConf{
+		Policy:        "equal",
+		Fraction:      0.5,
+		Risk:          0.01,
+		ATRMultiplier: 2,
+		ATRPeriod:     14,
+		Target:        0.15,
+		MaxWeight:     0.5,
+		Window:        60,
+		Capital:       100000,
+	}
+}
+
+func DefaultFrontierConf() FrontierConf {
+	return FrontierConf{
+		Window:    252,
+		Points:    20,
+		Shrinkage: true,
+		Chart:     ".files/frontier.png",
+	}
+}
+
+func DefaultPortfolioConf() PortfolioConf {
+	return PortfolioConf{
+		File:         ".files/portfolio.json",
+		SandboxPayIn: 100000,
+		Performance:  true,
+	}
+}
+
+func DefaultCorrelationConf() CorrelationConf {
+	return CorrelationConf{
+		Window:   60,
+		Step:     20,
+		Returns:  "log",
+		Clusters: 2,
+	}
+}
+
+func DefaultRankingConf() RankingConf {
+	return RankingConf{
+		Periods:     []int{21, 63, 126, 252},
+		Weights:     []float64{0.4, 0.3, 0.2, 0.1},
+		RSPeriod:    63,
+		RSWeight:    0.2,
+		TrendWeight: 0.05,
+		SwingPeriod: 2,
+		StateFile:   ".files/ranking.json",
+		History:     13,
+	}
 }
 
 func NewConfig(configPath string) (*Config, error) {
@@ -20,7 +398,17 @@ func NewConfig(configPath string) (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("read config file: %w", err)
 	}
-	var cfg Config
+	cfg := Config{
+		Recommendation: DefaultRecommendationConf(),
+		Patterns:       DefaultPatternConf(),
+		Regime:         DefaultRegimeConf(),
+		Strategy:       DefaultStrategyConf(),
+		Correlation:    DefaultCorrelationConf(),
+		Ranking:        DefaultRankingConf(),
+		Sizing:         DefaultSizingConf(),
+		Frontier:       DefaultFrontierConf(),
+		Portfolio:      DefaultPortfolioConf(),
+	}
 	if err = yaml.Unmarshal(yamlFile, &cfg); err != nil {
 		return nil, fmt.Errorf("parse config: %w", err)
 	}
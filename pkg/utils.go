@@ -1,6 +1,9 @@
 package pkg
 
-import "math"
+import (
+	"math"
+	"sort"
+)
 
 // Функция для вычисления среднего значения массива
 func Average(values []float64) float64 {
@@ -34,3 +37,39 @@ func SharpeRatio(returns []float64, riskFreeRate float64) float64 {
 	// Коэффициент Шарпа: (доходность - безрисковая ставка) / риск
 	return (meanReturn - riskFreeRate) / risk
 }
+
+// Функция для вычисления ковариации двух рядов одинаковой длины
+func Covariance(a, b []float64) float64 {
+	meanA := Average(a)
+	meanB := Average(b)
+	var cov float64
+	for i := range a {
+		cov += (a[i] - meanA) * (b[i] - meanB)
+	}
+	return cov / float64(len(a))
+}
+
+// Функция для вычисления коэффициента корреляции Пирсона
+func Correlation(a, b []float64) float64 {
+	sd := StandardDeviation(a) * StandardDeviation(b)
+	if sd == 0 {
+		return 0
+	}
+	return Covariance(a, b) / sd
+}
+
+// Функция для вычисления перцентиля (p от 0 до 1) с линейной интерполяцией
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	p = math.Max(0, math.Min(1, p))
+	pos := p * float64(len(sorted)-1)
+	i := int(math.Floor(pos))
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (sorted[i+1]-sorted[i])*(pos-float64(i))
+}
@@ -26,6 +26,7 @@ func providerTinkoffConfig() services.TinkoffConfig {
 		AppName: os.Getenv("APP_NAME"),
 		Host:    os.Getenv("TINKOFF_API_HOST"),
 		Token:   os.Getenv("TINKOFF_API_TOKEN"),
+		Sandbox: os.Getenv("TINKOFF_SANDBOX") == "true",
 	}
 
 }
@@ -59,7 +60,14 @@ func InitApplication() (*application.Application, error) {
 		wire.Bind(new(logging.Logger), new(*logging.ZLogger)),
 		InitTinkoffService,
 		services.NewChartService,
+		services.NewRegimeService,
+		services.NewValuationService,
 		services.NewStrategyService,
+		services.NewRecommendationService,
+		services.NewCorrelationService,
+		services.NewRankingService,
+		services.NewAllocationService,
+		services.NewPortfolioService,
 		application.NewApplication,
 	)
 	return &application.Application{}, nil
@@ -50,8 +50,15 @@ func InitApplication() (*application.Application, error) {
 		return nil, err
 	}
 	chartService := services.NewChartService()
-	strategyService := services.NewStrategyService(zLogger, tinkoffService)
-	applicationApplication := application.NewApplication(configConfig, zLogger, tinkoffService, chartService, strategyService)
+	regimeService := services.NewRegimeService(configConfig, zLogger)
+	valuationService := services.NewValuationService(configConfig, zLogger, tinkoffService)
+	strategyService := services.NewStrategyService(configConfig, zLogger, tinkoffService, regimeService, valuationService)
+	recommendationService := services.NewRecommendationService(configConfig, zLogger, valuationService)
+	correlationService := services.NewCorrelationService(configConfig, zLogger)
+	rankingService := services.NewRankingService(configConfig, zLogger)
+	allocationService := services.NewAllocationService(configConfig, zLogger, chartService, valuationService)
+	portfolioService := services.NewPortfolioService(configConfig, zLogger, tinkoffService, valuationService)
+	applicationApplication := application.NewApplication(configConfig, zLogger, tinkoffService, chartService, strategyService, recommendationService, regimeService, correlationService, rankingService, allocationService, portfolioService)
 	return applicationApplication, nil
 }
 
@@ -70,6 +77,7 @@ func providerTinkoffConfig() services.TinkoffConfig {
 		AppName: os.Getenv("APP_NAME"),
 		Host:    os.Getenv("TINKOFF_API_HOST"),
 		Token:   os.Getenv("TINKOFF_API_TOKEN"),
+		Sandbox: os.Getenv("TINKOFF_SANDBOX") == "true",
 	}
 
 }